@@ -0,0 +1,131 @@
+// Package audio provides WAV and PCM helpers for the audio sent to and received from the Coze
+// realtime APIs. The formats are taken from the websocket configs, so the audio always matches the
+// negotiated format.
+package audio
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// The defaults of the websocket APIs.
+const (
+	DefaultSampleRate = 24000
+	DefaultChannels   = 1
+	DefaultBitDepth   = 16
+)
+
+// Format describes linear PCM audio. Samples are little endian signed integers, except 8-bit
+// samples which are unsigned as in WAV files.
+type Format struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int
+}
+
+// DefaultFormat is the 24kHz mono 16-bit format used by the websocket APIs by default.
+var DefaultFormat = Format{SampleRate: DefaultSampleRate, Channels: DefaultChannels, BitDepth: DefaultBitDepth}
+
+// FormatFromInputAudio returns the format of WebSocketInputAudio, unset fields use the defaults.
+func FormatFromInputAudio(in *coze.WebSocketInputAudio) Format {
+	f := DefaultFormat
+	if in == nil {
+		return f
+	}
+	if in.SampleRate != nil {
+		f.SampleRate = *in.SampleRate
+	}
+	if in.Channel != nil {
+		f.Channels = *in.Channel
+	}
+	if in.BitDepth != nil {
+		f.BitDepth = *in.BitDepth
+	}
+	return f
+}
+
+// FormatFromPCMConfig returns the format of the pcm output, which is always mono 16-bit.
+func FormatFromPCMConfig(cfg *coze.WebSocketPCMConfig) Format {
+	f := DefaultFormat
+	if cfg != nil && cfg.SampleRate != nil {
+		f.SampleRate = *cfg.SampleRate
+	}
+	return f
+}
+
+// FormatFromOutputAudio returns the pcm format of WebSocketOutputAudio.
+func FormatFromOutputAudio(out *coze.WebSocketOutputAudio) Format {
+	if out == nil {
+		return DefaultFormat
+	}
+	return FormatFromPCMConfig(out.PCMConfig)
+}
+
+// InputAudio returns the WebSocketInputAudio for sending raw pcm in this format.
+func (f Format) InputAudio() *coze.WebSocketInputAudio {
+	return &coze.WebSocketInputAudio{
+		Format:     ptr("pcm"),
+		Codec:      ptr("pcm"),
+		SampleRate: ptr(f.SampleRate),
+		Channel:    ptr(f.Channels),
+		BitDepth:   ptr(f.BitDepth),
+	}
+}
+
+// PCMConfig returns the WebSocketPCMConfig for receiving pcm at this sample rate.
+func (f Format) PCMConfig() *coze.WebSocketPCMConfig {
+	return &coze.WebSocketPCMConfig{SampleRate: ptr(f.SampleRate)}
+}
+
+// Validate checks the format can be encoded.
+func (f Format) Validate() error {
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %d", f.SampleRate)
+	}
+	if f.Channels <= 0 {
+		return fmt.Errorf("invalid channel count %d", f.Channels)
+	}
+	switch f.BitDepth {
+	case 8, 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("unsupported bit depth %d", f.BitDepth)
+}
+
+// BytesPerSample returns the size of one sample of one channel.
+func (f Format) BytesPerSample() int {
+	return (f.BitDepth + 7) / 8
+}
+
+// FrameSize returns the size of one sample of all channels.
+func (f Format) FrameSize() int {
+	return f.BytesPerSample() * f.Channels
+}
+
+// ByteRate returns the number of bytes per second.
+func (f Format) ByteRate() int {
+	return f.SampleRate * f.FrameSize()
+}
+
+// Duration returns the duration of n bytes of audio.
+func (f Format) Duration(n int) time.Duration {
+	if f.ByteRate() == 0 {
+		return 0
+	}
+	return time.Duration(int64(n/f.FrameSize()) * int64(time.Second) / int64(f.SampleRate))
+}
+
+// Bytes returns the size of d of audio, rounded down to whole frames.
+func (f Format) Bytes(d time.Duration) int {
+	return int(int64(d)*int64(f.SampleRate)/int64(time.Second)) * f.FrameSize()
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%dHz %dch %dbit", f.SampleRate, f.Channels, f.BitDepth)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,28 @@
+package audio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	as := assert.New(t)
+
+	as.Equal(DefaultFormat, FormatFromInputAudio(nil))
+	f := FormatFromInputAudio(&coze.WebSocketInputAudio{SampleRate: ptr(48000), Channel: ptr(2), BitDepth: ptr(24)})
+	as.Equal(Format{SampleRate: 48000, Channels: 2, BitDepth: 24}, f)
+	as.Equal(6, f.FrameSize())
+	as.Equal(288000, f.ByteRate())
+	as.Equal(time.Second, f.Duration(288000))
+	as.Equal(2880, f.Bytes(10*time.Millisecond))
+	as.Equal(48000, *f.InputAudio().SampleRate)
+
+	out := FormatFromOutputAudio(&coze.WebSocketOutputAudio{PCMConfig: &coze.WebSocketPCMConfig{SampleRate: ptr(16000)}})
+	as.Equal(Format{SampleRate: 16000, Channels: 1, BitDepth: 16}, out)
+	as.Equal(16000, *out.PCMConfig().SampleRate)
+
+	as.NotNil(Format{SampleRate: 16000, Channels: 1, BitDepth: 12}.Validate())
+}
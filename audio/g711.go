@@ -0,0 +1,480 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// Codec is the audio codec of WebSocketInputAudio.Codec and WebSocketOutputAudio.Codec.
+type Codec string
+
+const (
+	CodecPCM   Codec = "pcm"
+	CodecOpus  Codec = "opus"
+	CodecG711A Codec = "g711a"
+	CodecG711U Codec = "g711u"
+)
+
+// G711SampleRate is the sample rate of G.711 audio, which is always mono.
+const G711SampleRate = 8000
+
+// G711Format is the pcm format G.711 audio is decoded to.
+var G711Format = Format{SampleRate: G711SampleRate, Channels: 1, BitDepth: 16}
+
+// IsG711 returns whether the codec is a-law or u-law.
+func (c Codec) IsG711() bool {
+	return c == CodecG711A || c == CodecG711U
+}
+
+// silence returns the encoded zero sample.
+func (c Codec) silence() byte {
+	if c == CodecG711A {
+		return 0xD5
+	}
+	return 0xFF
+}
+
+// G711InputAudio returns the WebSocketInputAudio for sending G.711 audio.
+func G711InputAudio(codec Codec) *coze.WebSocketInputAudio {
+	return &coze.WebSocketInputAudio{
+		Format:     ptr("pcm"),
+		Codec:      ptr(string(codec)),
+		SampleRate: ptr(G711SampleRate),
+		Channel:    ptr(1),
+	}
+}
+
+// G711OutputAudio returns the WebSocketOutputAudio for receiving G.711 audio in packets of
+// frameSize, 0 means the server default.
+func G711OutputAudio(codec Codec, frameSize time.Duration) *coze.WebSocketOutputAudio {
+	cfg := &coze.WebSocketPCMConfig{SampleRate: ptr(G711SampleRate)}
+	if frameSize > 0 {
+		cfg.FrameSizeMs = ptr(float64(frameSize) / float64(time.Millisecond))
+	}
+	return &coze.WebSocketOutputAudio{Codec: ptr(string(codec)), PCMConfig: cfg}
+}
+
+// LinearToALaw encodes a 16-bit sample as a-law.
+func LinearToALaw(sample int16) byte {
+	v := int(sample) >> 3
+	mask := 0xD5
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+	seg := g711Segment(v, 0x1F)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	a := seg << 4
+	if seg < 2 {
+		a |= (v >> 1) & 0x0F
+	} else {
+		a |= (v >> seg) & 0x0F
+	}
+	return byte(a ^ mask)
+}
+
+// ALawToLinear decodes an a-law sample.
+func ALawToLinear(a byte) int16 {
+	return alawTable[a]
+}
+
+// LinearToULaw encodes a 16-bit sample as u-law.
+func LinearToULaw(sample int16) byte {
+	const bias, clip = 0x84, 8159
+	v := int(sample) >> 2
+	mask := 0xFF
+	if v < 0 {
+		v = -v
+		mask = 0x7F
+	}
+	if v > clip {
+		v = clip
+	}
+	v += bias >> 2
+	seg := g711Segment(v, 0x3F)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	return byte(((seg << 4) | ((v >> (seg + 1)) & 0x0F)) ^ mask)
+}
+
+// ULawToLinear decodes a u-law sample.
+func ULawToLinear(u byte) int16 {
+	return ulawTable[u]
+}
+
+// g711Segment returns the segment of v, the segment ends are first, first*2+1...
+func g711Segment(v, first int) int {
+	end := first
+	for seg := 0; seg < 8; seg++ {
+		if v <= end {
+			return seg
+		}
+		end = end*2 + 1
+	}
+	return 8
+}
+
+var alawTable, ulawTable = func() ([256]int16, [256]int16) {
+	var alaw, ulaw [256]int16
+	for i := 0; i < 256; i++ {
+		a := i ^ 0x55
+		t := (a & 0x0F) << 4
+		switch seg := (a & 0x70) >> 4; seg {
+		case 0:
+			t += 8
+		case 1:
+			t += 0x108
+		default:
+			t += 0x108
+			t <<= seg - 1
+		}
+		if a&0x80 == 0 {
+			t = -t
+		}
+		alaw[i] = int16(t)
+
+		const bias = 0x84
+		u := ^i & 0xFF
+		t = ((u & 0x0F) << 3) + bias
+		t <<= (u & 0x70) >> 4
+		if u&0x80 != 0 {
+			ulaw[i] = int16(bias - t)
+		} else {
+			ulaw[i] = int16(t - bias)
+		}
+	}
+	return alaw, ulaw
+}()
+
+// EncodeG711 encodes 16-bit mono pcm as G.711, a trailing odd byte is ignored.
+func EncodeG711(codec Codec, pcm []byte) ([]byte, error) {
+	encode, err := g711Encoder(codec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(pcm)/2)
+	for i := range out {
+		out[i] = encode(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+	}
+	return out, nil
+}
+
+// DecodeG711 decodes G.711 to 16-bit mono pcm.
+func DecodeG711(codec Codec, data []byte) ([]byte, error) {
+	table, err := g711Table(codec)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)*2)
+	for i, b := range data {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(table[b]))
+	}
+	return out, nil
+}
+
+// TranscodeG711 converts between a-law and u-law.
+func TranscodeG711(from, to Codec, data []byte) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+	pcm, err := DecodeG711(from, data)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeG711(to, pcm)
+}
+
+func g711Encoder(codec Codec) (func(int16) byte, error) {
+	switch codec {
+	case CodecG711A:
+		return LinearToALaw, nil
+	case CodecG711U:
+		return LinearToULaw, nil
+	}
+	return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+}
+
+func g711Table(codec Codec) (*[256]int16, error) {
+	switch codec {
+	case CodecG711A:
+		return &alawTable, nil
+	case CodecG711U:
+		return &ulawTable, nil
+	}
+	return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+}
+
+// G711Encoder encodes a pcm stream of any format as 8kHz G.711.
+type G711Encoder struct {
+	codec     Codec
+	converter *Converter
+}
+
+// NewG711Encoder creates an encoder from the pcm format.
+func NewG711Encoder(codec Codec, from Format) (*G711Encoder, error) {
+	if !codec.IsG711() {
+		return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+	}
+	converter, err := NewConverter(from, G711Format)
+	if err != nil {
+		return nil, err
+	}
+	return &G711Encoder{codec: codec, converter: converter}, nil
+}
+
+// Process encodes a chunk.
+func (e *G711Encoder) Process(pcm []byte) []byte {
+	out, _ := EncodeG711(e.codec, e.converter.Process(pcm))
+	return out
+}
+
+// Flush returns the remaining output at the end of the stream.
+func (e *G711Encoder) Flush() []byte {
+	out, _ := EncodeG711(e.codec, e.converter.Flush())
+	return out
+}
+
+// G711Decoder decodes a G.711 stream to pcm of any format.
+type G711Decoder struct {
+	codec     Codec
+	converter *Converter
+}
+
+// NewG711Decoder creates a decoder to the pcm format.
+func NewG711Decoder(codec Codec, to Format) (*G711Decoder, error) {
+	if !codec.IsG711() {
+		return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+	}
+	converter, err := NewConverter(G711Format, to)
+	if err != nil {
+		return nil, err
+	}
+	return &G711Decoder{codec: codec, converter: converter}, nil
+}
+
+// Process decodes a chunk.
+func (d *G711Decoder) Process(data []byte) []byte {
+	pcm, _ := DecodeG711(d.codec, data)
+	return d.converter.Process(pcm)
+}
+
+// Flush returns the remaining output at the end of the stream.
+func (d *G711Decoder) Flush() []byte {
+	return d.converter.Flush()
+}
+
+// InputAudioAppender is implemented by coze.WebSocketChat and coze.WebSocketAudioTranscription.
+type InputAudioAppender interface {
+	InputAudioBufferAppend(data *coze.WebSocketInputAudioBufferAppendEventData) error
+}
+
+// G711InputWriter appends a G.711 stream, such as the payloads of a phone call, to the input audio
+// buffer. Every Write is sent as one InputAudioBufferAppend, converted to the input audio of the
+// session.
+type G711InputWriter struct {
+	appender InputAudioAppender
+	codec    Codec
+	target   Codec
+	decoder  *G711Decoder
+}
+
+// NewG711InputWriter creates a writer of codec audio for a session configured with input, which
+// may be G.711 of either law or pcm of any format.
+func NewG711InputWriter(appender InputAudioAppender, codec Codec, input *coze.WebSocketInputAudio) (*G711InputWriter, error) {
+	if !codec.IsG711() {
+		return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+	}
+	w := &G711InputWriter{appender: appender, codec: codec, target: CodecPCM}
+	if input != nil && input.Codec != nil {
+		w.target = Codec(*input.Codec)
+	}
+	switch {
+	case w.target.IsG711():
+	case w.target == CodecPCM:
+		decoder, err := NewG711Decoder(codec, FormatFromInputAudio(input))
+		if err != nil {
+			return nil, err
+		}
+		w.decoder = decoder
+	default:
+		return nil, fmt.Errorf("unsupported input codec %q", w.target)
+	}
+	return w, nil
+}
+
+func (w *G711InputWriter) Write(p []byte) (int, error) {
+	var delta []byte
+	var err error
+	if w.decoder != nil {
+		delta = w.decoder.Process(p)
+	} else if delta, err = TranscodeG711(w.codec, w.target, p); err != nil {
+		return 0, err
+	}
+	if len(delta) > 0 {
+		if err := w.appender.InputAudioBufferAppend(&coze.WebSocketInputAudioBufferAppendEventData{Delta: delta}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// G711Packetizer turns ConversationAudioDelta payloads into fixed size G.711 packets, for
+// example 160 bytes for the 20ms packets of RTP.
+type G711Packetizer struct {
+	codec  Codec
+	size   int
+	packet time.Duration
+
+	// one of them converts the output audio to codec
+	source  Codec
+	encoder *G711Encoder
+
+	mu     sync.Mutex
+	buf    []byte
+	closed bool
+	notify chan struct{}
+}
+
+// NewG711Packetizer creates a packetizer for a session configured with output, whose audio may be
+// G.711 of either law or pcm of any sample rate.
+func NewG711Packetizer(codec Codec, output *coze.WebSocketOutputAudio, packet time.Duration) (*G711Packetizer, error) {
+	if !codec.IsG711() {
+		return nil, fmt.Errorf("unsupported g711 codec %q", codec)
+	}
+	size := int(int64(packet) * G711SampleRate / int64(time.Second))
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid packet duration %s", packet)
+	}
+	p := &G711Packetizer{codec: codec, size: size, packet: packet, source: CodecPCM, notify: make(chan struct{}, 1)}
+	if output != nil && output.Codec != nil {
+		p.source = Codec(*output.Codec)
+	}
+	switch {
+	case p.source.IsG711():
+	case p.source == CodecPCM:
+		encoder, err := NewG711Encoder(codec, FormatFromOutputAudio(output))
+		if err != nil {
+			return nil, err
+		}
+		p.encoder = encoder
+	default:
+		return nil, fmt.Errorf("unsupported output codec %q", p.source)
+	}
+	return p, nil
+}
+
+// Write buffers the audio of a ConversationAudioDelta.
+func (p *G711Packetizer) Write(delta []byte) (int, error) {
+	// the encoder keeps the state of the resampler, which Close flushes
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, errors.New("packetizer is closed")
+	}
+	var data []byte
+	var err error
+	if p.encoder != nil {
+		data = p.encoder.Process(delta)
+	} else if data, err = TranscodeG711(p.source, p.codec, delta); err != nil {
+		return 0, err
+	}
+	p.buf = append(p.buf, data...)
+	p.signal()
+	return len(delta), nil
+}
+
+// Close ends the stream, the last packet is padded with silence.
+func (p *G711Packetizer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.encoder != nil {
+		p.buf = append(p.buf, p.encoder.Flush()...)
+	}
+	if rest := len(p.buf) % p.size; rest > 0 {
+		for i := rest; i < p.size; i++ {
+			p.buf = append(p.buf, p.codec.silence())
+		}
+	}
+	p.signal()
+	return nil
+}
+
+// Reset drops the buffered audio, for example when the chat is canceled.
+func (p *G711Packetizer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = nil
+}
+
+// Packets takes the complete packets buffered so far.
+func (p *G711Packetizer) Packets() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var packets [][]byte
+	for len(p.buf) >= p.size {
+		packets = append(packets, p.buf[:p.size:p.size])
+		p.buf = p.buf[p.size:]
+	}
+	return packets
+}
+
+// Run sends one packet per packet duration until the packetizer is closed and drained, or ctx is
+// done. When the buffer runs dry the cadence restarts with the next packet.
+func (p *G711Packetizer) Run(ctx context.Context, send func(packet []byte) error) error {
+	ticker := time.NewTicker(p.packet)
+	defer ticker.Stop()
+	for {
+		packet, done := p.next()
+		if packet == nil {
+			if done {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-p.notify:
+				ticker.Reset(p.packet)
+				continue
+			}
+		}
+		if err := send(packet); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *G711Packetizer) next() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) < p.size {
+		return nil, p.closed
+	}
+	packet := p.buf[:p.size:p.size]
+	p.buf = p.buf[p.size:]
+	return packet, false
+}
+
+func (p *G711Packetizer) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAppender struct {
+	deltas [][]byte
+}
+
+func (m *mockAppender) InputAudioBufferAppend(data *coze.WebSocketInputAudioBufferAppendEventData) error {
+	m.deltas = append(m.deltas, data.Delta)
+	return nil
+}
+
+func TestG711(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("samples", func(t *testing.T) {
+		as.Equal(byte(0xD5), LinearToALaw(0))
+		as.Equal(byte(0xFF), LinearToULaw(0))
+		as.Equal(byte(0xAA), LinearToALaw(math.MaxInt16))
+		as.Equal(byte(0x80), LinearToULaw(math.MaxInt16))
+		as.Equal(int16(-8), ALawToLinear(0x55))
+		as.Equal(int16(0), ULawToLinear(0xFF))
+		as.Equal(int16(32124), ULawToLinear(0x80))
+
+		for _, v := range []int16{-32768, -1000, -1, 1, 100, 1000, 12345, 32767} {
+			as.InDelta(float64(v), float64(ALawToLinear(LinearToALaw(v))), math.Abs(float64(v))/16+16, "a-law %d", v)
+			as.InDelta(float64(v), float64(ULawToLinear(LinearToULaw(v))), math.Abs(float64(v))/16+16, "u-law %d", v)
+		}
+		for i := 0; i < 256; i++ {
+			as.Equal(byte(i), LinearToALaw(ALawToLinear(byte(i))))
+		}
+
+		_, err := EncodeG711(CodecPCM, []byte{0, 0})
+		as.NotNil(err)
+	})
+
+	t.Run("encoder and decoder", func(t *testing.T) {
+		samples := make([]float64, 2400)
+		for i := range samples {
+			samples[i] = 0.5 * math.Sin(2*math.Pi*300*float64(i)/24000)
+		}
+		encoder, err := NewG711Encoder(CodecG711U, DefaultFormat)
+		as.Nil(err)
+		data := append(encoder.Process(EncodeSamples(samples, DefaultFormat)), encoder.Flush()...)
+		as.Len(data, 800)
+
+		decoder, err := NewG711Decoder(CodecG711U, DefaultFormat)
+		as.Nil(err)
+		pcm := append(decoder.Process(data), decoder.Flush()...)
+		decoded := DecodeSamples(pcm, DefaultFormat)
+		as.Len(decoded, 2400)
+		for i := 0; i < len(decoded); i += 50 {
+			as.InDelta(samples[i], decoded[i], 0.05)
+		}
+
+		alaw, err := TranscodeG711(CodecG711U, CodecG711A, data)
+		as.Nil(err)
+		as.Len(alaw, 800)
+	})
+
+	t.Run("input writer", func(t *testing.T) {
+		appender := &mockAppender{}
+		w, err := NewG711InputWriter(appender, CodecG711A, G711InputAudio(CodecG711A))
+		as.Nil(err)
+		_, err = w.Write([]byte{1, 2, 3})
+		as.Nil(err)
+		as.Equal([][]byte{{1, 2, 3}}, appender.deltas)
+
+		appender = &mockAppender{}
+		w, err = NewG711InputWriter(appender, CodecG711A, &coze.WebSocketInputAudio{SampleRate: ptr(16000)})
+		as.Nil(err)
+		_, err = w.Write(make([]byte, 160))
+		as.Nil(err)
+		as.Len(appender.deltas, 1)
+		as.InDelta(640, len(appender.deltas[0]), 4)
+
+		_, err = NewG711InputWriter(appender, CodecG711A, &coze.WebSocketInputAudio{Codec: ptr("opus")})
+		as.NotNil(err)
+	})
+
+	t.Run("packetizer", func(t *testing.T) {
+		p, err := NewG711Packetizer(CodecG711A, G711OutputAudio(CodecG711U, 20*time.Millisecond), 20*time.Millisecond)
+		as.Nil(err)
+		_, err = p.Write(make([]byte, 200))
+		as.Nil(err)
+		packets := p.Packets()
+		as.Len(packets, 1)
+		as.Len(packets[0], 160)
+		as.Nil(p.Close())
+		packets = p.Packets()
+		as.Len(packets, 1)
+		as.Equal(byte(0xD5), packets[0][159])
+
+		// 24kHz pcm output is resampled to 8kHz
+		p, err = NewG711Packetizer(CodecG711U, nil, 5*time.Millisecond)
+		as.Nil(err)
+		_, err = p.Write(make([]byte, DefaultFormat.Bytes(30*time.Millisecond)))
+		as.Nil(err)
+		as.Nil(p.Close())
+
+		var sent [][]byte
+		start := time.Now()
+		as.Nil(p.Run(context.Background(), func(packet []byte) error {
+			sent = append(sent, packet)
+			return nil
+		}))
+		as.Len(sent, 6)
+		as.Len(sent[0], 40)
+		as.GreaterOrEqual(time.Since(start), 25*time.Millisecond)
+
+		p, err = NewG711Packetizer(CodecG711U, nil, 5*time.Millisecond)
+		as.Nil(err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		as.Equal(context.DeadlineExceeded, p.Run(ctx, func([]byte) error { return nil }))
+	})
+
+	t.Run("packetizer concurrent write and close", func(t *testing.T) {
+		p, err := NewG711Packetizer(CodecG711U, nil, 20*time.Millisecond)
+		as.Nil(err)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					// fails once the packetizer is closed
+					_, _ = p.Write(make([]byte, DefaultFormat.Bytes(5*time.Millisecond)))
+				}
+			}()
+		}
+		as.Nil(p.Close())
+		wg.Wait()
+		_, err = p.Write(make([]byte, 2))
+		as.NotNil(err)
+		for _, packet := range p.Packets() {
+			as.Len(packet, 160)
+		}
+	})
+}
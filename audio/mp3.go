@@ -0,0 +1,92 @@
+package audio
+
+import "bytes"
+
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3Rates      = map[int][3]int{
+		3: {44100, 48000, 32000}, // MPEG 1
+		2: {22050, 24000, 16000}, // MPEG 2
+		0: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// StripMP3Metadata removes the ID3 tags and the Xing, Info or VBRI header frame of MPEG layer III
+// audio, so that mp3 files can be concatenated into one stream whose duration is read from its
+// frames. Other data is returned unchanged.
+func StripMP3Metadata(data []byte) []byte {
+	original := data
+	for len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		size += 10
+		if data[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		if size > len(data) {
+			// a truncated or invalid tag
+			return original
+		}
+		data = data[size:]
+	}
+	if len(data) >= 128 && bytes.HasPrefix(data[len(data)-128:], []byte("TAG")) {
+		data = data[:len(data)-128]
+	}
+	if size, info := mp3Frame(data); size > 0 && info {
+		data = data[size:]
+	}
+	return data
+}
+
+// mp3Frame returns the size of the layer III frame at the start of data, 0 if it is not one, and
+// whether it is an information frame of a VBR header.
+func mp3Frame(data []byte) (int, bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return 0, false
+	}
+	version := int(data[1]>>3) & 3
+	layer := int(data[1]>>1) & 3
+	rates, ok := mp3Rates[version]
+	if !ok || layer != 1 {
+		return 0, false
+	}
+	bitrateIndex, rateIndex := int(data[2]>>4), int(data[2]>>2)&3
+	if rateIndex == 3 {
+		return 0, false
+	}
+	bitrate := mp3BitratesV1[bitrateIndex]
+	coefficient, sideInfo := 144, 32
+	if version != 3 {
+		bitrate = mp3BitratesV2[bitrateIndex]
+		coefficient, sideInfo = 72, 17
+	}
+	if bitrate == 0 {
+		return 0, false
+	}
+	mono := data[3]>>6 == 3
+	if mono {
+		if version == 3 {
+			sideInfo = 17
+		} else {
+			sideInfo = 9
+		}
+	}
+	size := coefficient*bitrate*1000/rates[rateIndex] + int(data[2]>>1)&1
+	if size > len(data) {
+		return 0, false
+	}
+	frame := data[:size]
+	info := false
+	offset := 4 + sideInfo
+	if data[1]&1 == 0 {
+		offset += 2 // crc
+	}
+	if len(frame) >= offset+4 {
+		tag := string(frame[offset : offset+4])
+		info = tag == "Xing" || tag == "Info"
+	}
+	if len(frame) >= 40 && string(frame[36:40]) == "VBRI" {
+		info = true
+	}
+	return size, info
+}
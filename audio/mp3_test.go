@@ -0,0 +1,44 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mp3TestFrame returns a 417 byte MPEG 1 layer III frame of 128kbps at 44.1kHz.
+func mp3TestFrame(fill byte, tag string) []byte {
+	frame := bytes.Repeat([]byte{fill}, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	if tag != "" {
+		copy(frame[36:], tag)
+	}
+	return frame
+}
+
+func TestStripMP3Metadata(t *testing.T) {
+	as := assert.New(t)
+	id3 := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 5}, "abcde"...)
+	frames := append(mp3TestFrame(1, ""), mp3TestFrame(2, "")...)
+
+	t.Run("tags and info frame", func(t *testing.T) {
+		data := append(append(append([]byte{}, id3...), mp3TestFrame(0, "Info")...), frames...)
+		data = append(data, append([]byte("TAG"), make([]byte, 125)...)...)
+		as.Equal(frames, StripMP3Metadata(data))
+	})
+
+	t.Run("xing frame", func(t *testing.T) {
+		as.Equal(frames, StripMP3Metadata(append(mp3TestFrame(0, "Xing"), frames...)))
+	})
+
+	t.Run("audio frames are kept", func(t *testing.T) {
+		as.Equal(frames, StripMP3Metadata(frames))
+		as.Equal([]byte("not mp3"), StripMP3Metadata([]byte("not mp3")))
+	})
+
+	t.Run("truncated tag", func(t *testing.T) {
+		data := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 1, 0, 0}, frames...)
+		as.Equal(data, StripMP3Metadata(data))
+	})
+}
@@ -0,0 +1,441 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+const (
+	oggHeaderSize   = 27
+	oggMaxSegments  = 255
+	oggFlagContinue = 0x01
+	oggFlagBOS      = 0x02
+	oggFlagEOS      = 0x04
+
+	// opus granule positions always count 48kHz samples
+	opusGranuleRate = 48000
+
+	// the frame size of the websocket opus output when WebSocketOpusConfig.FrameSizeMs is not set
+	defaultOpusFrameSize = 10 * time.Millisecond
+
+	// a page is flushed when it holds this much audio
+	oggPageDuration = time.Second
+)
+
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04C11DB7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// OpusHead is the identification header of an Ogg/Opus stream.
+type OpusHead struct {
+	Version  uint8
+	Channels int
+	// The number of 48kHz samples to discard from the start of the decoded audio.
+	PreSkip int
+	// The sample rate of the original audio, informational only.
+	InputSampleRate int
+	// The gain to apply when decoding, in Q7.8 dB.
+	OutputGain    int16
+	MappingFamily uint8
+}
+
+func (h *OpusHead) marshal() []byte {
+	data := make([]byte, 19)
+	copy(data, "OpusHead")
+	data[8] = 1
+	data[9] = byte(h.Channels)
+	binary.LittleEndian.PutUint16(data[10:12], uint16(h.PreSkip))
+	binary.LittleEndian.PutUint32(data[12:16], uint32(h.InputSampleRate))
+	binary.LittleEndian.PutUint16(data[16:18], uint16(h.OutputGain))
+	data[18] = h.MappingFamily
+	return data
+}
+
+func parseOpusHead(data []byte) (*OpusHead, error) {
+	if len(data) < 19 || string(data[:8]) != "OpusHead" {
+		return nil, errors.New("not an opus stream")
+	}
+	head := &OpusHead{
+		Version:         data[8],
+		Channels:        int(data[9]),
+		PreSkip:         int(binary.LittleEndian.Uint16(data[10:12])),
+		InputSampleRate: int(binary.LittleEndian.Uint32(data[12:16])),
+		OutputGain:      int16(binary.LittleEndian.Uint16(data[16:18])),
+		MappingFamily:   data[18],
+	}
+	if head.Version>>4 != 0 {
+		return nil, fmt.Errorf("unsupported opus version %d", head.Version)
+	}
+	return head, nil
+}
+
+// OpusPacketDuration returns the duration of an opus packet from its TOC byte.
+func OpusPacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) == 0 {
+		return 0, errors.New("empty opus packet")
+	}
+	config := packet[0] >> 3
+	var frame time.Duration
+	switch {
+	case config < 12:
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+	frames := 1
+	switch packet[0] & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("invalid opus packet")
+		}
+		frames = int(packet[1] & 0x3F)
+	}
+	return frame * time.Duration(frames), nil
+}
+
+// OggOpusWriter muxes raw opus packets, such as the audio of ConversationAudioDelta and
+// SpeechAudioUpdate when the output codec is opus, into an Ogg/Opus file. Each Write is one packet.
+type OggOpusWriter struct {
+	writer    io.Writer
+	frameSize time.Duration
+	serial    uint32
+	sequence  uint32
+	granule   int64
+
+	segments []byte
+	body     []byte
+	duration time.Duration
+	closed   bool
+}
+
+// OggOpusConfig configures the stream written by OggOpusWriter.
+type OggOpusConfig struct {
+	// The sample rate of the source audio, default is 24000.
+	SampleRate int
+	// Default is 1.
+	Channels int
+	// The number of 48kHz samples of encoder delay, default is 0.
+	PreSkip int
+	// The duration of each packet, 0 means it is read from the TOC byte of the packet.
+	FrameSize time.Duration
+}
+
+// OggOpusConfigFromOutputAudio returns the config of the opus output of the session, the frame
+// size is WebSocketOpusConfig.FrameSizeMs or the server default of 10ms.
+func OggOpusConfigFromOutputAudio(out *coze.WebSocketOutputAudio) OggOpusConfig {
+	cfg := OggOpusConfig{SampleRate: DefaultSampleRate, Channels: 1, FrameSize: defaultOpusFrameSize}
+	if out != nil && out.OpusConfig != nil && out.OpusConfig.FrameSizeMs != nil {
+		cfg.FrameSize = time.Duration(*out.OpusConfig.FrameSizeMs * float64(time.Millisecond))
+	}
+	return cfg
+}
+
+// NewOggOpusWriter writes the Ogg/Opus headers and returns a writer for the packets. Close does
+// not close w.
+func NewOggOpusWriter(w io.Writer, cfg OggOpusConfig) (*OggOpusWriter, error) {
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultSampleRate
+	}
+	if cfg.Channels == 0 {
+		cfg.Channels = 1
+	}
+	if cfg.Channels > 2 {
+		return nil, fmt.Errorf("unsupported channel count %d", cfg.Channels)
+	}
+	writer := &OggOpusWriter{
+		writer:    w,
+		frameSize: cfg.FrameSize,
+		serial:    rand.Uint32(),
+		granule:   int64(cfg.PreSkip),
+	}
+	head := &OpusHead{Version: 1, Channels: cfg.Channels, PreSkip: cfg.PreSkip, InputSampleRate: cfg.SampleRate}
+	if err := writer.writePage([][]byte{head.marshal()}, 0, oggFlagBOS); err != nil {
+		return nil, err
+	}
+	if err := writer.writePage([][]byte{opusTags("coze-go")}, 0, 0); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Write adds an opus packet.
+func (w *OggOpusWriter) Write(packet []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("ogg writer is closed")
+	}
+	if len(packet) == 0 {
+		return 0, nil
+	}
+	if len(packet) >= 255*oggMaxSegments {
+		return 0, fmt.Errorf("opus packet of %d bytes is too large", len(packet))
+	}
+	duration := w.frameSize
+	if duration == 0 {
+		var err error
+		if duration, err = OpusPacketDuration(packet); err != nil {
+			return 0, err
+		}
+	}
+
+	lacing := oggLacing(len(packet))
+	if len(w.segments)+len(lacing) > oggMaxSegments {
+		if err := w.flush(0); err != nil {
+			return 0, err
+		}
+	}
+	w.segments = append(w.segments, lacing...)
+	w.body = append(w.body, packet...)
+	w.granule += int64(duration) * opusGranuleRate / int64(time.Second)
+	w.duration += duration
+	if w.duration >= oggPageDuration {
+		if err := w.flush(0); err != nil {
+			return 0, err
+		}
+	}
+	return len(packet), nil
+}
+
+// Flush writes the buffered packets as a page.
+func (w *OggOpusWriter) Flush() error {
+	if len(w.segments) == 0 {
+		return nil
+	}
+	return w.flush(0)
+}
+
+// Close writes the last page.
+func (w *OggOpusWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(oggFlagEOS)
+}
+
+func (w *OggOpusWriter) flush(flags byte) error {
+	err := w.writeSegments(w.segments, w.body, w.granule, flags)
+	w.segments, w.body, w.duration = w.segments[:0], w.body[:0], 0
+	return err
+}
+
+func (w *OggOpusWriter) writePage(packets [][]byte, granule int64, flags byte) error {
+	var segments, body []byte
+	for _, packet := range packets {
+		segments = append(segments, oggLacing(len(packet))...)
+		body = append(body, packet...)
+	}
+	return w.writeSegments(segments, body, granule, flags)
+}
+
+func (w *OggOpusWriter) writeSegments(segments, body []byte, granule int64, flags byte) error {
+	header := make([]byte, oggHeaderSize, oggHeaderSize+len(segments))
+	copy(header, "OggS")
+	header[5] = flags
+	binary.LittleEndian.PutUint64(header[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:18], w.serial)
+	binary.LittleEndian.PutUint32(header[18:22], w.sequence)
+	header[26] = byte(len(segments))
+	header = append(header, segments...)
+	binary.LittleEndian.PutUint32(header[22:26], oggCRC(oggCRC(0, header), body))
+	w.sequence++
+
+	if _, err := w.writer.Write(header); err != nil {
+		return err
+	}
+	_, err := w.writer.Write(body)
+	return err
+}
+
+func oggLacing(size int) []byte {
+	lacing := bytes.Repeat([]byte{255}, size/255)
+	return append(lacing, byte(size%255))
+}
+
+func opusTags(vendor string) []byte {
+	data := make([]byte, 16+len(vendor))
+	copy(data, "OpusTags")
+	binary.LittleEndian.PutUint32(data[8:12], uint32(len(vendor)))
+	copy(data[12:], vendor)
+	return data
+}
+
+// OggOpusReader demuxes an .ogg or .opus file into opus packets.
+type OggOpusReader struct {
+	reader  io.Reader
+	head    *OpusHead
+	serial  uint32
+	started bool
+	packets [][]byte
+	partial []byte
+	granule int64
+	eos     bool
+}
+
+// NewOggOpusReader reads the headers of the first logical stream, which must be opus.
+func NewOggOpusReader(r io.Reader) (*OggOpusReader, error) {
+	reader := &OggOpusReader{reader: r}
+	packet, err := reader.next()
+	if err != nil {
+		return nil, fmt.Errorf("read opus head: %w", err)
+	}
+	if reader.head, err = parseOpusHead(packet); err != nil {
+		return nil, err
+	}
+	packet, err = reader.next()
+	if err != nil {
+		return nil, fmt.Errorf("read opus tags: %w", err)
+	}
+	if !bytes.HasPrefix(packet, []byte("OpusTags")) {
+		return nil, errors.New("missing opus tags")
+	}
+	return reader, nil
+}
+
+// Head returns the identification header.
+func (r *OggOpusReader) Head() *OpusHead {
+	return r.head
+}
+
+// Granule returns the granule position of the last page read.
+func (r *OggOpusReader) Granule() int64 {
+	return r.granule
+}
+
+// InputAudio returns the WebSocketInputAudio for sending the file with format ogg.
+func (r *OggOpusReader) InputAudio() *coze.WebSocketInputAudio {
+	in := &coze.WebSocketInputAudio{Format: ptr("ogg"), Codec: ptr(string(CodecOpus)), Channel: ptr(r.head.Channels)}
+	if r.head.InputSampleRate > 0 {
+		in.SampleRate = ptr(r.head.InputSampleRate)
+	}
+	return in
+}
+
+// ReadPacket returns the next audio packet, io.EOF at the end of the stream.
+func (r *OggOpusReader) ReadPacket() ([]byte, error) {
+	return r.next()
+}
+
+func (r *OggOpusReader) next() ([]byte, error) {
+	for len(r.packets) == 0 {
+		if r.eos {
+			return nil, io.EOF
+		}
+		if err := r.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	packet := r.packets[0]
+	r.packets = r.packets[1:]
+	return packet, nil
+}
+
+func (r *OggOpusReader) readPage() error {
+	header := make([]byte, oggHeaderSize)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		if err == io.EOF && r.head != nil {
+			// a stream without an eos page
+			r.eos = true
+			return io.EOF
+		}
+		return err
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return errors.New("invalid ogg page")
+	}
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r.reader, segments); err != nil {
+		return err
+	}
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, body); err != nil {
+		return err
+	}
+
+	crc := binary.LittleEndian.Uint32(header[22:26])
+	binary.LittleEndian.PutUint32(header[22:26], 0)
+	if oggCRC(oggCRC(oggCRC(0, header), segments), body) != crc {
+		return errors.New("ogg page checksum mismatch")
+	}
+
+	flags := header[5]
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	if !r.started {
+		if flags&oggFlagBOS == 0 {
+			return errors.New("ogg stream does not start with a bos page")
+		}
+		r.serial, r.started = serial, true
+	} else if serial != r.serial {
+		// pages of other logical streams are skipped
+		return nil
+	}
+	if flags&oggFlagContinue == 0 {
+		r.partial = nil
+	}
+
+	offset := 0
+	for _, s := range segments {
+		r.partial = append(r.partial, body[offset:offset+int(s)]...)
+		offset += int(s)
+		if s < 255 {
+			r.packets = append(r.packets, r.partial)
+			r.partial = nil
+		}
+	}
+	if granule := int64(binary.LittleEndian.Uint64(header[6:14])); granule != -1 {
+		r.granule = granule
+	}
+	r.eos = flags&oggFlagEOS != 0
+	return nil
+}
+
+// ReadOggOpus reads all the packets of an Ogg/Opus stream.
+func ReadOggOpus(r io.Reader) (*OpusHead, [][]byte, error) {
+	reader, err := NewOggOpusReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var packets [][]byte
+	for {
+		packet, err := reader.ReadPacket()
+		if err == io.EOF {
+			return reader.Head(), packets, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		packets = append(packets, packet)
+	}
+}
@@ -0,0 +1,207 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOggOpus(t *testing.T) {
+	as := assert.New(t)
+	silence := []byte{0xF8, 0xFF, 0xFE}
+
+	// opus_silence.opus is a synthetic stream of silent celt packets, not the output of an encoder
+	t.Run("read testdata", func(t *testing.T) {
+		f, err := os.Open("../testdata/opus_silence.opus")
+		as.Nil(err)
+		defer f.Close()
+
+		reader, err := NewOggOpusReader(f)
+		as.Nil(err)
+		as.Equal(&OpusHead{Version: 1, Channels: 1, PreSkip: 312, InputSampleRate: 24000}, reader.Head())
+		as.Equal("ogg", *reader.InputAudio().Format)
+		as.Equal("opus", *reader.InputAudio().Codec)
+
+		var total time.Duration
+		count := 0
+		for {
+			packet, err := reader.ReadPacket()
+			if err == io.EOF {
+				break
+			}
+			as.Nil(err)
+			as.Equal(silence, packet)
+			duration, err := OpusPacketDuration(packet)
+			as.Nil(err)
+			total += duration
+			count++
+		}
+		as.Equal(50, count)
+		as.Equal(time.Second, total)
+		as.Equal(int64(312+48000), reader.Granule())
+	})
+
+	t.Run("read assembled pages", func(t *testing.T) {
+		// pages laid out like those of opusenc, built without the muxer: stereo 48kHz, mixed
+		// frame sizes, a packet continued on the next page and an end trimmed last page
+		head := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+		tags := append([]byte("OpusTags"), 13, 0, 0, 0)
+		tags = append(tags, "libopus 1.3.1"...)
+		tags = append(tags, 1, 0, 0, 0, 12, 0, 0, 0)
+		tags = append(tags, "ENCODER=test"...)
+		celt20 := []byte{0xFC, 1, 2, 3}                                // celt 20ms stereo
+		silk60 := []byte{0x1C, 4, 5}                                   // silk 60ms stereo
+		celt40 := []byte{0xFF, 0x02, 6, 7}                             // celt 20ms stereo, 2 frames
+		large := append([]byte{0xFC}, bytes.Repeat([]byte{8}, 599)...) // celt 20ms, 600 bytes
+		hybrid10 := []byte{0x64, 9}                                    // hybrid 10ms stereo
+
+		data := testOggPage(nil, oggFlagBOS, 0, 0, [][]byte{head}, false)
+		data = testOggPage(data, 0, 0, 1, [][]byte{tags}, false)
+		// the page ends within the large packet, its granule counts the completed packets
+		data = testOggPage(data, 0, 312+5760, 2, [][]byte{celt20, silk60, celt40, large[:510]}, true)
+		// 200 samples are trimmed from the end
+		data = testOggPage(data, oggFlagContinue|oggFlagEOS, 312+7200-200, 3, [][]byte{large[510:], hybrid10}, false)
+
+		reader, err := NewOggOpusReader(bytes.NewReader(data))
+		as.Nil(err)
+		as.Equal(&OpusHead{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 48000}, reader.Head())
+
+		expected := []struct {
+			packet   []byte
+			duration time.Duration
+			granule  int64
+		}{
+			{celt20, 20 * time.Millisecond, 312 + 5760},
+			{silk60, 60 * time.Millisecond, 312 + 5760},
+			{celt40, 40 * time.Millisecond, 312 + 5760},
+			{large, 20 * time.Millisecond, 312 + 7200 - 200},
+			{hybrid10, 10 * time.Millisecond, 312 + 7200 - 200},
+		}
+		for i, e := range expected {
+			packet, err := reader.ReadPacket()
+			as.Nil(err)
+			as.Equal(e.packet, packet, i)
+			duration, err := OpusPacketDuration(packet)
+			as.Nil(err)
+			as.Equal(e.duration, duration, i)
+			as.Equal(e.granule, reader.Granule(), i)
+		}
+		_, err = reader.ReadPacket()
+		as.Equal(io.EOF, err)
+	})
+
+	t.Run("write and read", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		cfg := OggOpusConfigFromOutputAudio(&coze.WebSocketOutputAudio{
+			Codec:      ptr("opus"),
+			OpusConfig: &coze.WebSocketOpusConfig{FrameSizeMs: ptr(20.0)},
+		})
+		as.Equal(20*time.Millisecond, cfg.FrameSize)
+		cfg.PreSkip = 312
+		w, err := NewOggOpusWriter(buf, cfg)
+		as.Nil(err)
+		large := bytes.Repeat([]byte{0xF8}, 600)
+		for i := 0; i < 60; i++ {
+			packet := silence
+			if i == 10 {
+				packet = large
+			}
+			_, err := w.Write(packet)
+			as.Nil(err)
+		}
+		as.Nil(w.Close())
+		_, err = w.Write(silence)
+		as.NotNil(err)
+
+		// the first audio page is flushed after a second of audio
+		data := buf.Bytes()
+		pages := splitOggPages(data)
+		as.Len(pages, 4)
+		as.Equal(byte(oggFlagBOS), pages[0][5])
+		as.Equal(byte(oggFlagEOS), pages[3][5])
+		as.Equal(uint64(312+50*960), binary.LittleEndian.Uint64(pages[2][6:14]))
+		as.Equal(uint64(312+60*960), binary.LittleEndian.Uint64(pages[3][6:14]))
+
+		head, packets, err := ReadOggOpus(bytes.NewReader(data))
+		as.Nil(err)
+		as.Equal(312, head.PreSkip)
+		as.Len(packets, 60)
+		as.Equal(large, packets[10])
+
+		data[len(data)-1] ^= 0xFF
+		_, _, err = ReadOggOpus(bytes.NewReader(data))
+		as.NotNil(err)
+	})
+
+	t.Run("packet duration", func(t *testing.T) {
+		for packet, expected := range map[string]time.Duration{
+			"\x08":     20 * time.Millisecond,   // silk 20ms
+			"\x69":     40 * time.Millisecond,   // hybrid 20ms, 2 frames
+			"\x80":     2500 * time.Microsecond, // celt 2.5ms
+			"\xfb\x03": 60 * time.Millisecond,   // celt 20ms, 3 frames
+		} {
+			duration, err := OpusPacketDuration([]byte(packet))
+			as.Nil(err)
+			as.Equal(expected, duration)
+		}
+		_, err := OpusPacketDuration(nil)
+		as.NotNil(err)
+	})
+}
+
+func splitOggPages(data []byte) [][]byte {
+	var pages [][]byte
+	for len(data) > 0 {
+		size := oggHeaderSize + int(data[26])
+		for _, s := range data[oggHeaderSize:size] {
+			size += int(s)
+		}
+		pages = append(pages, data[:size])
+		data = data[size:]
+	}
+	return pages
+}
+
+// testOggPage appends an ogg page holding packets to data, the last packet is left open when
+// continued is set. The checksum is computed bit by bit, independently of oggCRC.
+func testOggPage(data []byte, flags byte, granule int64, sequence uint32, packets [][]byte, continued bool) []byte {
+	var segments, body []byte
+	for i, packet := range packets {
+		size := len(packet)
+		for ; size >= 255; size -= 255 {
+			segments = append(segments, 255)
+		}
+		if !continued || i < len(packets)-1 {
+			segments = append(segments, byte(size))
+		}
+		body = append(body, packet...)
+	}
+	page := make([]byte, 27, 27+len(segments)+len(body))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:18], 0x1234)
+	binary.LittleEndian.PutUint32(page[18:22], sequence)
+	page[26] = byte(len(segments))
+	page = append(append(page, segments...), body...)
+
+	var crc uint32
+	for _, b := range page {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+	return append(data, page...)
+}
@@ -0,0 +1,269 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// DecodeSamples converts pcm data to interleaved samples in [-1, 1], a trailing partial frame is
+// ignored.
+func DecodeSamples(pcm []byte, f Format) []float64 {
+	size := f.BytesPerSample()
+	frames := len(pcm) / f.FrameSize()
+	samples := make([]float64, frames*f.Channels)
+	for i := range samples {
+		samples[i] = decodeSample(pcm[i*size:], f.BitDepth)
+	}
+	return samples
+}
+
+// EncodeSamples converts interleaved samples in [-1, 1] to pcm data, samples out of range are
+// clipped.
+func EncodeSamples(samples []float64, f Format) []byte {
+	size := f.BytesPerSample()
+	pcm := make([]byte, len(samples)*size)
+	for i, sample := range samples {
+		encodeSample(pcm[i*size:], sample, f.BitDepth)
+	}
+	return pcm
+}
+
+func decodeSample(b []byte, bitDepth int) float64 {
+	switch bitDepth {
+	case 8:
+		return float64(int(b[0])-128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608
+	case 32:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+	return 0
+}
+
+func encodeSample(b []byte, sample float64, bitDepth int) {
+	if sample > 1 {
+		sample = 1
+	} else if sample < -1 {
+		sample = -1
+	}
+	switch bitDepth {
+	case 8:
+		b[0] = uint8(clampInt(math.Round(sample*128), -128, 127) + 128)
+	case 16:
+		binary.LittleEndian.PutUint16(b, uint16(int16(clampInt(math.Round(sample*32768), math.MinInt16, math.MaxInt16))))
+	case 24:
+		v := int32(clampInt(math.Round(sample*8388608), -8388608, 8388607))
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+	case 32:
+		binary.LittleEndian.PutUint32(b, uint32(int32(clampInt(math.Round(sample*2147483648), math.MinInt32, math.MaxInt32))))
+	}
+}
+
+func clampInt(v float64, lo, hi int64) int64 {
+	if v < float64(lo) {
+		return lo
+	}
+	if v > float64(hi) {
+		return hi
+	}
+	return int64(v)
+}
+
+// Remix changes the channel count of interleaved samples. Down-mixing to mono averages the
+// channels, mono is duplicated to every channel, otherwise the first channels are kept and missing
+// channels are silent.
+func Remix(samples []float64, from, to int) []float64 {
+	if from == to || from <= 0 || to <= 0 {
+		return samples
+	}
+	frames := len(samples) / from
+	out := make([]float64, frames*to)
+	for i := 0; i < frames; i++ {
+		frame := samples[i*from : (i+1)*from]
+		switch {
+		case to == 1:
+			sum := 0.0
+			for _, v := range frame {
+				sum += v
+			}
+			out[i] = sum / float64(from)
+		case from == 1:
+			for c := 0; c < to; c++ {
+				out[i*to+c] = frame[0]
+			}
+		default:
+			copy(out[i*to:(i+1)*to], frame)
+		}
+	}
+	return out
+}
+
+// DownmixToMono averages the channels of the pcm data.
+func DownmixToMono(pcm []byte, f Format) []byte {
+	if f.Channels == 1 {
+		return pcm
+	}
+	mono := f
+	mono.Channels = 1
+	return EncodeSamples(Remix(DecodeSamples(pcm, f), f.Channels, 1), mono)
+}
+
+// Resample converts the pcm data to the sample rate with linear interpolation.
+func Resample(pcm []byte, f Format, sampleRate int) ([]byte, error) {
+	resampler, err := NewResampler(f, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	out := resampler.Process(pcm)
+	return append(out, resampler.Flush()...), nil
+}
+
+// Convert converts the pcm data between formats.
+func Convert(pcm []byte, from, to Format) ([]byte, error) {
+	converter, err := NewConverter(from, to)
+	if err != nil {
+		return nil, err
+	}
+	out := converter.Process(pcm)
+	return append(out, converter.Flush()...), nil
+}
+
+// Resampler resamples a pcm stream which arrives in chunks, such as audio deltas. The state
+// between chunks is kept, so the output is the same as resampling the whole stream at once.
+type Resampler struct {
+	format  Format
+	rate    int
+	step    float64
+	pos     float64   // position of the next output frame, relative to prev
+	prev    []float64 // last input frame, nil before the first frame
+	partial []byte
+}
+
+// NewResampler creates a resampler from the format to the sample rate.
+func NewResampler(f Format, sampleRate int) (*Resampler, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	return &Resampler{
+		format: f,
+		rate:   sampleRate,
+		step:   float64(f.SampleRate) / float64(sampleRate),
+	}, nil
+}
+
+// Process resamples a chunk, a trailing partial frame is kept for the next chunk.
+func (r *Resampler) Process(pcm []byte) []byte {
+	if len(r.partial) > 0 {
+		pcm = append(r.partial, pcm...)
+		r.partial = nil
+	}
+	frameSize := r.format.FrameSize()
+	if rest := len(pcm) % frameSize; rest > 0 {
+		r.partial = append([]byte(nil), pcm[len(pcm)-rest:]...)
+		pcm = pcm[:len(pcm)-rest]
+	}
+	if r.format.SampleRate == r.rate {
+		return pcm
+	}
+	return EncodeSamples(r.process(DecodeSamples(pcm, r.format)), r.format)
+}
+
+// Flush returns the remaining output at the end of the stream.
+func (r *Resampler) Flush() []byte {
+	r.partial = nil
+	if r.prev == nil || r.format.SampleRate == r.rate {
+		return nil
+	}
+	var out []float64
+	for r.pos < 1 {
+		out = append(out, r.prev...)
+		r.pos += r.step
+	}
+	r.pos = 0
+	r.prev = nil
+	return EncodeSamples(out, r.format)
+}
+
+func (r *Resampler) process(samples []float64) []float64 {
+	channels := r.format.Channels
+	frames := len(samples) / channels
+	if frames == 0 {
+		return nil
+	}
+	// frame i of the buffer is prev for i == 0 and samples[i-1] otherwise
+	frame := func(i int) []float64 {
+		if r.prev != nil {
+			if i == 0 {
+				return r.prev
+			}
+			i--
+		}
+		return samples[i*channels : (i+1)*channels]
+	}
+	total := frames
+	if r.prev != nil {
+		total++
+	}
+
+	out := make([]float64, 0, int(float64(frames)/r.step+1)*channels)
+	for {
+		i := int(r.pos)
+		if i+1 >= total {
+			break
+		}
+		t := r.pos - float64(i)
+		a, b := frame(i), frame(i+1)
+		for c := 0; c < channels; c++ {
+			out = append(out, a[c]+(b[c]-a[c])*t)
+		}
+		r.pos += r.step
+	}
+	r.pos -= float64(total - 1)
+	r.prev = append([]float64(nil), frame(total-1)...)
+	return out
+}
+
+// Converter converts a pcm stream between formats, see Resampler.
+type Converter struct {
+	from, to  Format
+	resampler *Resampler
+}
+
+// NewConverter creates a converter between formats.
+func NewConverter(from, to Format) (*Converter, error) {
+	if err := from.Validate(); err != nil {
+		return nil, err
+	}
+	if err := to.Validate(); err != nil {
+		return nil, err
+	}
+	resampler, err := NewResampler(from, to.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return &Converter{from: from, to: to, resampler: resampler}, nil
+}
+
+// Process converts a chunk.
+func (c *Converter) Process(pcm []byte) []byte {
+	return c.convert(c.resampler.Process(pcm))
+}
+
+// Flush returns the remaining output at the end of the stream.
+func (c *Converter) Flush() []byte {
+	return c.convert(c.resampler.Flush())
+}
+
+func (c *Converter) convert(pcm []byte) []byte {
+	if c.from.Channels == c.to.Channels && c.from.BitDepth == c.to.BitDepth {
+		return pcm
+	}
+	return EncodeSamples(Remix(DecodeSamples(pcm, c.from), c.from.Channels, c.to.Channels), c.to)
+}
@@ -0,0 +1,80 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPCM(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("samples", func(t *testing.T) {
+		samples := []float64{-1, -0.5, 0, 0.5, 0.99}
+		for _, bitDepth := range []int{8, 16, 24, 32} {
+			f := Format{SampleRate: 8000, Channels: 1, BitDepth: bitDepth}
+			decoded := DecodeSamples(EncodeSamples(samples, f), f)
+			for i := range samples {
+				as.InDelta(samples[i], decoded[i], 0.01, "bit depth %d", bitDepth)
+			}
+		}
+		f := Format{SampleRate: 8000, Channels: 1, BitDepth: 16}
+		as.Equal([]byte{0xff, 0x7f, 0x00, 0x80}, EncodeSamples([]float64{2, -2}, f))
+	})
+
+	t.Run("downmix", func(t *testing.T) {
+		f := Format{SampleRate: 8000, Channels: 2, BitDepth: 16}
+		mono := DownmixToMono(EncodeSamples([]float64{0.5, 0, -0.5, -0.5}, f), f)
+		as.Equal([]float64{0.25, -0.5}, DecodeSamples(mono, Format{SampleRate: 8000, Channels: 1, BitDepth: 16}))
+		as.Equal([]float64{1, 1, 2, 2}, Remix([]float64{1, 2}, 1, 2))
+		as.Equal([]float64{1, 2, 0, 4, 5, 0}, Remix([]float64{1, 2, 4, 5}, 2, 3))
+	})
+
+	t.Run("resample", func(t *testing.T) {
+		f := Format{SampleRate: 8000, Channels: 1, BitDepth: 16}
+		samples := make([]float64, 800)
+		for i := range samples {
+			samples[i] = math.Sin(2 * math.Pi * 440 * float64(i) / 8000)
+		}
+		pcm := EncodeSamples(samples, f)
+
+		up, err := Resample(pcm, f, 24000)
+		as.Nil(err)
+		as.Len(up, len(pcm)*3)
+		down, err := Resample(up, Format{SampleRate: 24000, Channels: 1, BitDepth: 16}, 8000)
+		as.Nil(err)
+		as.Len(down, len(pcm))
+		for i, v := range DecodeSamples(down, f) {
+			as.InDelta(samples[i], v, 0.001)
+		}
+
+		// chunked input gives the same output as a single call
+		resampler, err := NewResampler(f, 22050)
+		as.Nil(err)
+		var chunked []byte
+		for i := 0; i < len(pcm); i += 333 {
+			end := i + 333
+			if end > len(pcm) {
+				end = len(pcm)
+			}
+			chunked = append(chunked, resampler.Process(pcm[i:end])...)
+		}
+		chunked = append(chunked, resampler.Flush()...)
+		whole, err := Resample(pcm, f, 22050)
+		as.Nil(err)
+		as.Equal(whole, chunked)
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		from := Format{SampleRate: 48000, Channels: 2, BitDepth: 24}
+		to := DefaultFormat
+		pcm := EncodeSamples(make([]float64, 4800*2), from)
+		out, err := Convert(pcm, from, to)
+		as.Nil(err)
+		as.Len(out, 2400*2)
+
+		_, err = Convert(pcm, from, Format{SampleRate: 16000, Channels: 1, BitDepth: 4})
+		as.NotNil(err)
+	})
+}
@@ -0,0 +1,436 @@
+package audio
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// Sink plays the pcm audio of a Player, Write is called with one frame at a time at real-time
+// pace.
+type Sink interface {
+	Write(pcm []byte) (int, error)
+}
+
+// SinkFlusher is implemented by sinks which buffer audio, Flush drops the buffered audio when the
+// playback is interrupted.
+type SinkFlusher interface {
+	Flush() error
+}
+
+// PlaybackSentence is a sentence of a played message, the offsets are relative to the start of the
+// message audio.
+type PlaybackSentence struct {
+	Text  string
+	Start time.Duration
+	End   time.Duration
+	// Whether the sentence was played to the end.
+	Complete bool
+}
+
+// PlaybackReport reports what the user heard of a message.
+type PlaybackReport struct {
+	MessageID      string
+	ChatID         string
+	ConversationID string
+
+	// The duration of the received audio.
+	Duration time.Duration
+	// The duration of the audio heard before the playback ended.
+	Played time.Duration
+	// Whether the playback was interrupted.
+	Interrupted bool
+	// The sentences which started playing, the last one may be incomplete.
+	Sentences []*PlaybackSentence
+}
+
+// Text returns the text of the sentences which started playing, which is the transcript of what
+// the user heard.
+func (r *PlaybackReport) Text() string {
+	texts := make([]string, 0, len(r.Sentences))
+	for _, s := range r.Sentences {
+		texts = append(texts, s.Text)
+	}
+	return strings.Join(texts, "")
+}
+
+const (
+	defaultPlaybackFrame     = 20 * time.Millisecond
+	defaultPlaybackPrebuffer = 100 * time.Millisecond
+	// the number of ended messages and interrupted chats remembered to drop their late deltas
+	maxRecentPlaybackIDs = 64
+)
+
+// Player is a playback buffer for the answer audio of a WebSocketChat. The handlers of the chat
+// feed it with AudioDelta, SentenceStart, AudioCompleted and Interrupt, and Run plays the buffered
+// messages in order at real-time pace on the sink.
+type Player struct {
+	sink   Sink
+	format Format
+
+	// The duration of each write to the sink, default is 20ms.
+	FrameDuration time.Duration
+
+	// The audio buffered before a message starts playing, to absorb the network jitter, default is
+	// 100ms. A completed message starts playing at once.
+	Prebuffer time.Duration
+
+	// The delay of the sink between a write and the audio being heard, subtracted from the played
+	// duration when the playback is interrupted.
+	Latency time.Duration
+
+	// Called when a message starts playing and when its playback ends or is interrupted. OnEnd is
+	// called from the goroutine calling Interrupt for an interrupted message, and from the goroutine
+	// calling Run otherwise.
+	OnStart func(messageID string)
+	OnEnd   func(report *PlaybackReport)
+
+	mu       sync.Mutex
+	notify   chan struct{}
+	queue    []*playbackMessage
+	pending  []*playbackSentence // sentences received before the audio of their message
+	done     *recentIDs          // messages which were played or dropped
+	canceled *recentIDs          // chats which were interrupted
+	chatID   string              // the chat of the last delta
+	flush    bool
+	deadline time.Time // when the audio written to the sink ends
+}
+
+type playbackMessage struct {
+	id, chatID, conversationID string
+
+	audio     []byte
+	played    int
+	sentences []*playbackSentence
+	completed bool
+	started   bool
+}
+
+type playbackSentence struct {
+	text   string
+	offset int
+}
+
+// NewPlayer creates a player which plays pcm audio in the format on the sink, the format is the
+// output audio of the chat, see FormatFromOutputAudio.
+func NewPlayer(sink Sink, f Format) (*Player, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &Player{
+		sink:     sink,
+		format:   f,
+		notify:   make(chan struct{}, 1),
+		done:     newRecentIDs(maxRecentPlaybackIDs),
+		canceled: newRecentIDs(maxRecentPlaybackIDs),
+	}, nil
+}
+
+// SentenceStart starts a sentence at the current end of the audio, call it from
+// WebSocketChat.OnConversationAudioSentenceStart.
+func (p *Player) SentenceStart(event *coze.WebSocketConversationAudioSentenceStartEvent) {
+	if event == nil || event.Data == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m := p.last(); m != nil && !m.completed {
+		m.sentences = append(m.sentences, &playbackSentence{text: event.Data.Text, offset: len(m.audio)})
+		return
+	}
+	p.pending = append(p.pending, &playbackSentence{text: event.Data.Text})
+}
+
+// AudioDelta buffers the audio of a message, call it from WebSocketChat.OnConversationAudioDelta.
+// Messages are played in the order of their first delta, the deltas of an interrupted chat or of a
+// message which already ended are dropped.
+func (p *Player) AudioDelta(event *coze.WebSocketConversationAudioDeltaEvent) {
+	if event == nil || event.Data == nil || len(event.Data.Content) == 0 {
+		return
+	}
+	data := event.Data
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done.has(data.ID) || (data.ChatID != "" && p.canceled.has(data.ChatID)) {
+		return
+	}
+	p.chatID = data.ChatID
+	m := p.find(data.ID)
+	if m == nil {
+		m = &playbackMessage{id: data.ID, chatID: data.ChatID, conversationID: data.ConversationID}
+		// a sentence which started at the end of the previous message belongs to this one
+		if prev := p.last(); prev != nil {
+			for len(prev.sentences) > 0 && prev.sentences[len(prev.sentences)-1].offset == len(prev.audio) {
+				s := prev.sentences[len(prev.sentences)-1]
+				prev.sentences = prev.sentences[:len(prev.sentences)-1]
+				p.pending = append([]*playbackSentence{s}, p.pending...)
+			}
+		}
+		for _, s := range p.pending {
+			s.offset = 0
+		}
+		m.sentences, p.pending = p.pending, nil
+		p.queue = append(p.queue, m)
+	}
+	m.audio = append(m.audio, data.Content...)
+	p.signal()
+}
+
+// AudioCompleted marks the audio of a message as complete, call it from
+// WebSocketChat.OnConversationAudioCompleted. Without it a message ends when its audio is played
+// and the audio of the next message arrives.
+func (p *Player) AudioCompleted(event *coze.WebSocketConversationAudioCompletedEvent) {
+	if event == nil || event.Data == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m := p.find(event.Data.ID); m != nil {
+		m.completed = true
+		p.signal()
+	}
+}
+
+// Interrupt drops the buffered audio and ends the playback, the remaining deltas of the
+// interrupted chats are dropped. The chat of the last delta is interrupted even when its audio was
+// all played. Call it from WebSocketChat.OnInputAudioBufferSpeechStarted and
+// OnConversationChatCanceled. It returns the reports of the dropped messages.
+func (p *Player) Interrupt() []*PlaybackReport {
+	p.mu.Lock()
+	now := time.Now()
+	unheard := p.Latency
+	if p.deadline.After(now) {
+		unheard += p.deadline.Sub(now)
+	}
+	reports := make([]*PlaybackReport, 0, len(p.queue))
+	for _, m := range p.queue {
+		played := 0
+		if m.started {
+			played = m.played - p.format.Bytes(unheard)
+			if played < 0 {
+				played = 0
+			}
+		}
+		report := p.report(m, played)
+		report.Interrupted = true
+		reports = append(reports, report)
+		p.done.add(m.id)
+		if m.chatID != "" {
+			p.canceled.add(m.chatID)
+		}
+	}
+	if p.chatID != "" {
+		p.canceled.add(p.chatID)
+	}
+	p.queue, p.pending, p.chatID = nil, nil, ""
+	p.flush = len(reports) > 0
+	p.deadline = time.Time{}
+	p.signal()
+	p.mu.Unlock()
+
+	if p.OnEnd != nil {
+		for _, report := range reports {
+			p.OnEnd(report)
+		}
+	}
+	return reports
+}
+
+// Playing returns the message being played and the duration of its audio written to the sink.
+func (p *Player) Playing() (string, time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 || !p.queue[0].started {
+		return "", 0, false
+	}
+	m := p.queue[0]
+	return m.id, p.format.Duration(m.played), true
+}
+
+// Run plays the buffered messages until ctx is done or the sink fails.
+func (p *Player) Run(ctx context.Context) error {
+	frameDuration := p.FrameDuration
+	if frameDuration <= 0 {
+		frameDuration = defaultPlaybackFrame
+	}
+	frameSize := p.format.Bytes(frameDuration)
+	if frameSize <= 0 {
+		frameSize = p.format.FrameSize()
+	}
+	prebuffer := p.Prebuffer
+	if prebuffer <= 0 {
+		prebuffer = defaultPlaybackPrebuffer
+	}
+	prebufferSize := p.format.Bytes(prebuffer)
+
+	var next time.Time
+	for {
+		p.mu.Lock()
+		flush := p.flush
+		p.flush = false
+		frame, started, ended := p.next(frameSize, prebufferSize)
+		if frame != nil {
+			if next.IsZero() {
+				next = time.Now()
+			}
+			next = next.Add(p.format.Duration(len(frame)))
+			p.deadline = next
+		}
+		p.mu.Unlock()
+
+		if flush {
+			if f, ok := p.sink.(SinkFlusher); ok {
+				if err := f.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		for _, report := range ended {
+			if p.OnEnd != nil {
+				p.OnEnd(report)
+			}
+		}
+		if started != "" && p.OnStart != nil {
+			p.OnStart(started)
+		}
+
+		if frame == nil {
+			next = time.Time{}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-p.notify:
+			}
+			continue
+		}
+		if _, err := p.sink.Write(frame); err != nil {
+			return err
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns the next frame to play, the message which started playing and the reports of the
+// messages which ended.
+func (p *Player) next(frameSize, prebufferSize int) ([]byte, string, []*PlaybackReport) {
+	var ended []*PlaybackReport
+	for len(p.queue) > 0 {
+		m := p.queue[0]
+		// the audio of a message ends when it is completed or the next message has started
+		final := m.completed || len(p.queue) > 1
+		if avail := len(m.audio) - m.played; avail > 0 {
+			started := ""
+			if !m.started {
+				if !final && avail < prebufferSize {
+					return nil, "", ended
+				}
+				m.started = true
+				started = m.id
+			}
+			n := frameSize
+			if avail < n {
+				if !final {
+					return nil, started, ended
+				}
+				n = avail
+			}
+			frame := m.audio[m.played : m.played+n]
+			m.played += n
+			return frame, started, ended
+		}
+		if !final {
+			return nil, "", ended
+		}
+		p.queue = p.queue[1:]
+		p.done.add(m.id)
+		if m.started {
+			ended = append(ended, p.report(m, m.played))
+		}
+	}
+	return nil, "", ended
+}
+
+func (p *Player) report(m *playbackMessage, played int) *PlaybackReport {
+	report := &PlaybackReport{
+		MessageID:      m.id,
+		ChatID:         m.chatID,
+		ConversationID: m.conversationID,
+		Duration:       p.format.Duration(len(m.audio)),
+		Played:         p.format.Duration(played),
+	}
+	for i, s := range m.sentences {
+		if s.offset > played || (s.offset == played && played < len(m.audio)) {
+			break
+		}
+		end := len(m.audio)
+		if i+1 < len(m.sentences) {
+			end = m.sentences[i+1].offset
+		}
+		report.Sentences = append(report.Sentences, &PlaybackSentence{
+			Text:     s.text,
+			Start:    p.format.Duration(s.offset),
+			End:      p.format.Duration(end),
+			Complete: end <= played,
+		})
+	}
+	return report
+}
+
+func (p *Player) find(id string) *playbackMessage {
+	for _, m := range p.queue {
+		if m.id == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (p *Player) last() *playbackMessage {
+	if len(p.queue) == 0 {
+		return nil
+	}
+	return p.queue[len(p.queue)-1]
+}
+
+func (p *Player) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// recentIDs is a set which keeps the last limit ids.
+type recentIDs struct {
+	limit int
+	ids   map[string]bool
+	order []string
+}
+
+func newRecentIDs(limit int) *recentIDs {
+	return &recentIDs{limit: limit, ids: map[string]bool{}}
+}
+
+func (r *recentIDs) has(id string) bool {
+	return r.ids[id]
+}
+
+func (r *recentIDs) add(id string) {
+	if r.ids[id] {
+		return
+	}
+	r.ids[id] = true
+	r.order = append(r.order, id)
+	if len(r.order) > r.limit {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+}
@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSink struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	writes  int
+	flushes int
+}
+
+func (m *mockSink) Write(pcm []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes++
+	return m.buf.Write(pcm)
+}
+
+func (m *mockSink) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushes++
+	return nil
+}
+
+func (m *mockSink) Bytes() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.buf.Bytes()...)
+}
+
+func audioDelta(id, chatID string, content []byte) *coze.WebSocketConversationAudioDeltaEvent {
+	return &coze.WebSocketConversationAudioDeltaEvent{
+		Data: &coze.WebSocketConversationAudioDeltaEventData{ID: id, ChatID: chatID, Content: content},
+	}
+}
+
+func sentenceStart(text string) *coze.WebSocketConversationAudioSentenceStartEvent {
+	return &coze.WebSocketConversationAudioSentenceStartEvent{
+		Data: &coze.WebSocketConversationAudioSentenceStartEventData{Text: text},
+	}
+}
+
+func audioCompleted(id string) *coze.WebSocketConversationAudioCompletedEvent {
+	return &coze.WebSocketConversationAudioCompletedEvent{Data: &coze.Message{ID: id}}
+}
+
+func TestPlayer(t *testing.T) {
+	as := assert.New(t)
+	f := Format{SampleRate: 8000, Channels: 1, BitDepth: 16}
+	fill := func(b byte, d time.Duration) []byte { return bytes.Repeat([]byte{b}, f.Bytes(d)) }
+
+	t.Run("order", func(t *testing.T) {
+		sink := &mockSink{}
+		player, err := NewPlayer(sink, f)
+		as.Nil(err)
+		player.FrameDuration = 10 * time.Millisecond
+		reports := make(chan *PlaybackReport, 4)
+		player.OnEnd = func(report *PlaybackReport) { reports <- report }
+
+		player.SentenceStart(sentenceStart("Hello. "))
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 40*time.Millisecond)))
+		player.SentenceStart(sentenceStart("World."))
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 20*time.Millisecond)))
+		player.AudioDelta(audioDelta("b", "c1", fill(2, 20*time.Millisecond)))
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 20*time.Millisecond)))
+		player.AudioCompleted(audioCompleted("a"))
+		player.AudioCompleted(audioCompleted("b"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go player.Run(ctx)
+
+		a, b := <-reports, <-reports
+		as.Equal("a", a.MessageID)
+		as.Equal("c1", a.ChatID)
+		as.False(a.Interrupted)
+		as.Equal(80*time.Millisecond, a.Duration)
+		as.Equal(80*time.Millisecond, a.Played)
+		as.Equal("Hello. World.", a.Text())
+		as.Len(a.Sentences, 2)
+		as.Equal(40*time.Millisecond, a.Sentences[1].Start)
+		as.Equal(80*time.Millisecond, a.Sentences[1].End)
+		as.True(a.Sentences[1].Complete)
+		as.Equal("b", b.MessageID)
+		as.Equal(20*time.Millisecond, b.Played)
+
+		as.Equal(append(fill(1, 80*time.Millisecond), fill(2, 20*time.Millisecond)...), sink.Bytes())
+		as.Equal(10, sink.writes)
+		as.Equal(0, sink.flushes)
+
+		// a message which already ended is not played again
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 20*time.Millisecond)))
+		_, _, playing := player.Playing()
+		as.False(playing)
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		sink := &mockSink{}
+		player, err := NewPlayer(sink, f)
+		as.Nil(err)
+		started := make(chan string, 1)
+		player.OnStart = func(messageID string) { started <- messageID }
+
+		player.SentenceStart(sentenceStart("First."))
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 500*time.Millisecond)))
+		player.SentenceStart(sentenceStart("Second."))
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 500*time.Millisecond)))
+		player.AudioDelta(audioDelta("b", "c1", fill(2, 100*time.Millisecond)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go player.Run(ctx)
+		as.Equal("a", <-started)
+		time.Sleep(150 * time.Millisecond)
+
+		id, position, playing := player.Playing()
+		as.True(playing)
+		as.Equal("a", id)
+		as.True(position > 100*time.Millisecond)
+
+		reports := player.Interrupt()
+		as.Len(reports, 2)
+		a := reports[0]
+		as.True(a.Interrupted)
+		as.True(a.Played > 100*time.Millisecond && a.Played < 300*time.Millisecond, a.Played)
+		as.Equal(time.Second, a.Duration)
+		as.Equal("First.", a.Text())
+		as.False(a.Sentences[0].Complete)
+		as.Equal(time.Duration(0), reports[1].Played)
+		as.Empty(reports[1].Sentences)
+
+		// the remaining audio of the interrupted chat is dropped
+		player.AudioDelta(audioDelta("c", "c1", fill(3, 100*time.Millisecond)))
+		_, _, playing = player.Playing()
+		as.False(playing)
+
+		player.AudioDelta(audioDelta("d", "c2", fill(4, 100*time.Millisecond)))
+		player.AudioCompleted(audioCompleted("d"))
+		as.Equal("d", <-started)
+		sink.mu.Lock()
+		as.Equal(1, sink.flushes)
+		sink.mu.Unlock()
+		as.NotContains(sink.Bytes(), byte(2))
+		as.NotContains(sink.Bytes(), byte(3))
+	})
+
+	t.Run("interrupt played chat", func(t *testing.T) {
+		player, err := NewPlayer(&mockSink{}, f)
+		as.Nil(err)
+		ended := make(chan *PlaybackReport, 1)
+		player.OnEnd = func(report *PlaybackReport) { ended <- report }
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go player.Run(ctx)
+
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 20*time.Millisecond)))
+		player.AudioCompleted(audioCompleted("a"))
+		as.Equal("a", (<-ended).MessageID)
+
+		// the queue is empty, but the chat is still interrupted
+		as.Empty(player.Interrupt())
+		player.AudioDelta(audioDelta("b", "c1", fill(2, 100*time.Millisecond)))
+		_, _, playing := player.Playing()
+		as.False(playing)
+		player.mu.Lock()
+		as.Empty(player.queue)
+		player.mu.Unlock()
+	})
+
+	t.Run("recent ids", func(t *testing.T) {
+		ids := newRecentIDs(2)
+		ids.add("a")
+		ids.add("b")
+		ids.add("b")
+		as.True(ids.has("a"))
+		ids.add("c")
+		as.False(ids.has("a"))
+		as.True(ids.has("b"))
+		as.True(ids.has("c"))
+		as.Len(ids.ids, 2)
+	})
+
+	t.Run("prebuffer", func(t *testing.T) {
+		sink := &mockSink{}
+		player, err := NewPlayer(sink, f)
+		as.Nil(err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go player.Run(ctx)
+
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 50*time.Millisecond)))
+		time.Sleep(30 * time.Millisecond)
+		_, _, playing := player.Playing()
+		as.False(playing)
+		as.Empty(sink.Bytes())
+
+		player.AudioDelta(audioDelta("a", "c1", fill(1, 50*time.Millisecond)))
+		time.Sleep(30 * time.Millisecond)
+		_, _, playing = player.Playing()
+		as.True(playing)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := NewPlayer(&mockSink{}, Format{})
+		as.NotNil(err)
+	})
+}
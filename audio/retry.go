@@ -0,0 +1,57 @@
+package audio
+
+import (
+	"context"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+const (
+	defaultRetries    = 2
+	defaultRetryDelay = time.Second
+
+	// the coze error code of a request rejected by the rate limit
+	rateLimitErrorCode = 4013
+)
+
+// retry calls f until it succeeds, at most retries more times with the delay doubled each time.
+// retries 0 means the default and a negative value disables retries. Errors which fail again on
+// retry are returned at once, see retryable. It returns the number of attempts.
+func retry(ctx context.Context, retries int, delay time.Duration, f func() error) (int, error) {
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt > retries || ctx.Err() != nil || !retryable(err) {
+			return attempt, err
+		}
+		timer := time.NewTimer(delay << (attempt - 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable returns whether a request which failed with err may succeed when retried. The 4xxx
+// coze errors, such as invalid parameters and permission errors, and the auth errors are caused by
+// the request, except the rate limit.
+func retryable(err error) bool {
+	if _, ok := coze.AsAuthError(err); ok {
+		return false
+	}
+	if cozeErr, ok := coze.AsCozeError(err); ok {
+		return cozeErr.Code < 4000 || cozeErr.Code >= 5000 || cozeErr.Code == rateLimitErrorCode
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	failing := func(err error) func() error {
+		return func() error { return err }
+	}
+
+	t.Run("retryable", func(t *testing.T) {
+		for _, err := range []error{
+			errors.New("connection reset"),
+			coze.NewError(5000, "internal error", ""),
+			coze.NewError(rateLimitErrorCode, "too many requests", ""),
+		} {
+			attempts, got := retry(ctx, 2, time.Millisecond, failing(err))
+			as.Equal(3, attempts, err.Error())
+			as.Equal(err, got)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		for _, err := range []error{
+			coze.NewError(4000, "invalid param", ""),
+			coze.NewError(4100, "authentication is invalid", ""),
+			&coze.AuthError{HttpCode: 401, Code: coze.AccessDenied},
+		} {
+			attempts, got := retry(ctx, 2, time.Millisecond, failing(err))
+			as.Equal(1, attempts, err.Error())
+			as.Equal(err, got)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		calls := 0
+		attempts, err := retry(ctx, 2, time.Millisecond, func() error {
+			calls++
+			if calls < 2 {
+				return errors.New("timeout")
+			}
+			return nil
+		})
+		as.Nil(err)
+		as.Equal(2, attempts)
+	})
+}
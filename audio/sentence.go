@@ -0,0 +1,149 @@
+package audio
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitSentences splits text after sentence terminators and line breaks. CJK terminators always
+// end a sentence, Latin ones only before a space or the end, so decimals and abbreviations such as
+// "3.14" or "Node.js" are kept. Closing quotes and brackets stay with their sentence and the
+// sentences are trimmed.
+func SplitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(string(runes[start:end])); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = end
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' || r == '\r' {
+			add(i + 1)
+			continue
+		}
+		if !isSentenceTerminator(r) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (isSentenceTerminator(runes[end]) || isClosingPunct(runes[end])) {
+			end++
+		}
+		if isLatinTerminator(r) && end < len(runes) && !unicode.IsSpace(runes[end]) {
+			i = end - 1
+			continue
+		}
+		add(end)
+		i = end - 1
+	}
+	add(len(runes))
+	return sentences
+}
+
+func isSentenceTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '…', '．':
+		return true
+	}
+	return isLatinTerminator(r)
+}
+
+func isLatinTerminator(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == ';'
+}
+
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '”', '’', '）', '」', '』', '】', '》':
+		return true
+	}
+	return false
+}
+
+// isCJK returns whether r is a Chinese, Japanese or Korean character, each one is about a syllable.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isWide returns whether r is a CJK character or punctuation, which is written without spaces.
+func isWide(r rune) bool {
+	return isCJK(r) || (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// speechWeight estimates the relative speaking time of text.
+func speechWeight(text string) int {
+	weight := 0
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			weight += 3
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			weight++
+		}
+	}
+	return weight
+}
+
+// SplitText splits text into segments of at most maxLength runes at sentence boundaries, for
+// APIs which limit the length of their input. A longer sentence is split at a comma, then at a
+// space, and cut as a last resort. Latin sentences in a segment are joined with a space, 0 means no
+// limit.
+func SplitText(text string, maxLength int) []string {
+	var segments []string
+	var current []rune
+	add := func(part []rune) {
+		if maxLength > 0 && len(current) > 0 && len(current)+len(part)+1 > maxLength {
+			segments = append(segments, string(current))
+			current = nil
+		}
+		if len(current) > 0 && !isWide(current[len(current)-1]) && !isWide(part[0]) {
+			current = append(current, ' ')
+		}
+		current = append(current, part...)
+	}
+	for _, sentence := range SplitSentences(text) {
+		for _, part := range splitLong([]rune(sentence), maxLength) {
+			add(part)
+		}
+	}
+	if len(current) > 0 {
+		segments = append(segments, string(current))
+	}
+	return segments
+}
+
+// splitLong splits a sentence longer than maxLength.
+func splitLong(runes []rune, maxLength int) [][]rune {
+	var parts [][]rune
+	for maxLength > 0 && len(runes) > maxLength {
+		cut := lastIndexRune(runes[:maxLength], func(r rune) bool {
+			return r == ',' || r == '，' || r == '、' || r == ':' || r == '：'
+		})
+		if cut < 0 {
+			cut = lastIndexRune(runes[:maxLength], unicode.IsSpace)
+		}
+		if cut <= 0 {
+			cut = maxLength - 1
+		}
+		if part := []rune(strings.TrimSpace(string(runes[:cut+1]))); len(part) > 0 {
+			parts = append(parts, part)
+		}
+		runes = []rune(strings.TrimSpace(string(runes[cut+1:])))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, runes)
+	}
+	return parts
+}
+
+func lastIndexRune(runes []rune, f func(rune) bool) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if f(runes[i]) {
+			return i
+		}
+	}
+	return -1
+}
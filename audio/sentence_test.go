@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSentences(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("latin", func(t *testing.T) {
+		as.Equal([]string{"Hello world.", "Pi is 3.14, see Node.js!", "Really?"},
+			SplitSentences("Hello world. Pi is 3.14, see Node.js! Really?"))
+		as.Equal([]string{`He said "stop."`, "Then left."}, SplitSentences(`He said "stop." Then left.`))
+		as.Equal([]string{"Wait...", "ok"}, SplitSentences("Wait... ok"))
+	})
+
+	t.Run("cjk", func(t *testing.T) {
+		as.Equal([]string{"你好。", "今天天气怎么样？", "「很好！」", "走吧"},
+			SplitSentences("你好。今天天气怎么样？「很好！」走吧"))
+		as.Equal([]string{"第一行", "第二行。"}, SplitSentences("第一行\n\n第二行。"))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		as.Empty(SplitSentences(""))
+		as.Empty(SplitSentences(" \n "))
+	})
+
+	t.Run("split text", func(t *testing.T) {
+		as.Equal([]string{"One two. Three.", "你好。世界。", "Four five six"},
+			SplitText("One two. Three. 你好。世界。Four five six", 16))
+		as.Equal([]string{"一二三，", "四五六七八", "九"}, SplitText("一二三，四五六七八九", 5))
+		as.Equal([]string{"alpha beta", "gamma"}, SplitText("alpha beta gamma", 12))
+		as.Equal([]string{"a. b."}, SplitText("a. b.", 0))
+	})
+
+	t.Run("weight", func(t *testing.T) {
+		as.Equal(6, speechWeight("你好"))
+		as.Equal(5, speechWeight("Hello, "))
+		as.Equal(0, speechWeight("!?"))
+	})
+}
@@ -0,0 +1,449 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// SpeechTextSender is implemented by coze.WebSocketAudioSpeech.
+type SpeechTextSender interface {
+	InputTextBufferAppend(data *coze.WebSocketInputTextBufferAppendEventData) error
+	InputTextBufferComplete(data *coze.WebSocketInputTextBufferCompleteEventData) error
+}
+
+const (
+	defaultPhraseLength       = 10
+	defaultMaxPhraseLength    = 120
+	defaultSpeechBufferLength = 1 << 20
+)
+
+// SpeechPipeline speaks a streamed chat answer while it is generated. Run groups the message deltas
+// into phrases, strips markdown and emoji and appends them to a WebSocketAudioSpeech, and the
+// synthesized audio is read from the pipeline as it arrives. Call SpeechAudioUpdate,
+// SpeechAudioCompleted and SpeechError from the handlers of the speech client:
+//
+//	p := audio.NewSpeechPipeline(speech)
+//	speech.OnSpeechAudioUpdate(func(ctx context.Context, cli *coze.WebSocketAudioSpeech, event *coze.WebSocketSpeechAudioUpdateEvent) error {
+//		p.SpeechAudioUpdate(event)
+//		return nil
+//	})
+//	go p.Run(ctx, stream)
+//	io.Copy(speaker, p)
+type SpeechPipeline struct {
+	// The length in runes from which a phrase also ends at a comma or a colon, default is 10. A
+	// sentence terminator or a line break always ends a phrase.
+	MinPhraseLength int
+
+	// The length in runes at which a phrase without a boundary is cut at a space, default is 120.
+	MaxPhraseLength int
+
+	// The number of audio bytes buffered before SpeechAudioUpdate blocks until they are read,
+	// default is 1MB.
+	BufferSize int
+
+	// Filter cleans a phrase before synthesis, default strips markdown and emoji. lineStart is
+	// whether the phrase starts a line. A phrase is dropped if it returns an empty string.
+	Filter func(phrase string, lineStart bool) string
+
+	// OnPhrase is called with each phrase appended to the speech.
+	OnPhrase func(phrase string)
+
+	speech SpeechTextSender
+
+	// text state, owned by Run
+	pending   []rune
+	lineStart bool
+	inCode    bool
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       bytes.Buffer
+	completed bool
+	err       error
+	closed    chan struct{}
+}
+
+// NewSpeechPipeline creates a pipeline which appends the text to speech.
+func NewSpeechPipeline(speech SpeechTextSender) *SpeechPipeline {
+	p := &SpeechPipeline{
+		speech:    speech,
+		lineStart: true,
+		closed:    make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Run reads the answer deltas of stream and appends them to the speech phrase by phrase, then
+// completes the input text buffer. It closes stream when it returns, and stops when ctx is done or
+// the pipeline is closed. Errors are also returned by Read.
+func (p *SpeechPipeline) Run(ctx context.Context, stream coze.Stream[coze.ChatEvent]) error {
+	defer stream.Close()
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			p.CloseWithError(ctx.Err())
+			_ = stream.Close()
+		case <-p.closed:
+			_ = stream.Close()
+		case <-stop:
+		}
+	}()
+
+	err := p.run(stream)
+	close(stop)
+	<-stopped
+	if err != nil {
+		p.CloseWithError(err)
+		return p.readErr()
+	}
+	return nil
+}
+
+func (p *SpeechPipeline) run(stream coze.Stream[coze.ChatEvent]) error {
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if p.isClosed() {
+			return io.ErrClosedPipe
+		}
+		switch event.Event {
+		case coze.ChatEventConversationMessageDelta:
+			if event.Message != nil && event.Message.Type == coze.MessageTypeAnswer {
+				p.pending = append(p.pending, []rune(event.Message.Content)...)
+				if err := p.flush(false); err != nil {
+					return err
+				}
+			}
+		case coze.ChatEventConversationMessageCompleted:
+			if event.Message != nil && event.Message.Type == coze.MessageTypeAnswer {
+				if err := p.flush(true); err != nil {
+					return err
+				}
+			}
+		case coze.ChatEventConversationChatFailed:
+			if event.Chat != nil && event.Chat.LastError != nil {
+				return fmt.Errorf("chat failed: %d %s", event.Chat.LastError.Code, event.Chat.LastError.Msg)
+			}
+			return errors.New("chat failed")
+		}
+		if event.IsDone() {
+			break
+		}
+	}
+	if err := p.flush(true); err != nil {
+		return err
+	}
+	return p.speech.InputTextBufferComplete(&coze.WebSocketInputTextBufferCompleteEventData{})
+}
+
+// flush appends the complete phrases of the pending text, and the rest if final.
+func (p *SpeechPipeline) flush(final bool) error {
+	for len(p.pending) > 0 {
+		end := p.phraseEnd(p.pending, final)
+		if end == 0 {
+			return nil
+		}
+		phrase := string(p.pending[:end])
+		p.pending = p.pending[end:]
+		lineStart := p.lineStart
+		p.lineStart = strings.HasSuffix(phrase, "\n")
+		if err := p.appendPhrase(phrase, lineStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *SpeechPipeline) appendPhrase(phrase string, lineStart bool) error {
+	// code blocks are not spoken
+	if lineStart && strings.HasPrefix(strings.TrimSpace(phrase), "```") {
+		p.inCode = !p.inCode
+		return nil
+	}
+	if p.inCode {
+		return nil
+	}
+	filter := p.Filter
+	if filter == nil {
+		filter = stripSpeechText
+	}
+	text := filter(phrase, lineStart)
+	if text == "" {
+		return nil
+	}
+	if p.OnPhrase != nil {
+		p.OnPhrase(text)
+	}
+	// the phrases are concatenated by the server
+	if last := []rune(text); !isWide(last[len(last)-1]) {
+		text += " "
+	}
+	return p.speech.InputTextBufferAppend(&coze.WebSocketInputTextBufferAppendEventData{Delta: text})
+}
+
+// phraseEnd returns the length of the first phrase of runes, or 0 if it may not be complete yet.
+func (p *SpeechPipeline) phraseEnd(runes []rune, final bool) int {
+	minLength := p.MinPhraseLength
+	if minLength <= 0 {
+		minLength = defaultPhraseLength
+	}
+	maxLength := p.MaxPhraseLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxPhraseLength
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			return i + 1
+		}
+		switch {
+		case isSentenceTerminator(r):
+			// the number of an ordered list item
+			if r == '.' && p.lineStart && isListNumber(runes[:i]) {
+				continue
+			}
+		case isPhraseSeparator(r):
+			if i+1 < minLength {
+				continue
+			}
+		default:
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (isSentenceTerminator(runes[end]) || isClosingPunct(runes[end])) {
+			end++
+		}
+		if isWide(r) {
+			return end
+		}
+		// a Latin terminator or comma ends a phrase only before a space, as in SplitSentences
+		if end == len(runes) {
+			if final {
+				return end
+			}
+			return 0
+		}
+		if unicode.IsSpace(runes[end]) {
+			return end
+		}
+		i = end - 1
+	}
+	if len(runes) >= maxLength {
+		if cut := lastIndexRune(runes[:maxLength], unicode.IsSpace); cut > 0 {
+			return cut + 1
+		}
+		return maxLength
+	}
+	if final {
+		return len(runes)
+	}
+	return 0
+}
+
+func isPhraseSeparator(r rune) bool {
+	switch r {
+	case ',', '，', '、', ':', '：':
+		return true
+	}
+	return false
+}
+
+func isListNumber(runes []rune) bool {
+	s := strings.TrimSpace(string(runes))
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SpeechAudioUpdate buffers the audio of the event, call it from
+// WebSocketAudioSpeech.OnSpeechAudioUpdate. It blocks while the buffer is full, which holds back
+// the speech client until the audio is read, and drops the audio if the pipeline is closed.
+func (p *SpeechPipeline) SpeechAudioUpdate(event *coze.WebSocketSpeechAudioUpdateEvent) {
+	if event == nil || event.Data == nil || len(event.Data.Delta) == 0 {
+		return
+	}
+	size := p.BufferSize
+	if size <= 0 {
+		size = defaultSpeechBufferLength
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() >= size && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return
+	}
+	p.buf.Write(event.Data.Delta)
+	p.cond.Broadcast()
+}
+
+// SpeechAudioCompleted ends the audio, Read returns io.EOF once the buffer is drained. Call it from
+// WebSocketAudioSpeech.OnSpeechAudioCompleted.
+func (p *SpeechPipeline) SpeechAudioCompleted(event *coze.WebSocketSpeechAudioCompletedEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.completed = true
+	p.cond.Broadcast()
+}
+
+// SpeechError fails the pipeline with the error of the event, call it from
+// WebSocketAudioSpeech.OnError.
+func (p *SpeechPipeline) SpeechError(event *coze.WebSocketErrorEvent) {
+	if event == nil || event.Data == nil {
+		p.CloseWithError(errors.New("speech error"))
+		return
+	}
+	p.CloseWithError(event.Data)
+}
+
+// Read reads the synthesized audio. It returns as soon as any audio is buffered, io.EOF after the
+// audio is completed and the error of the pipeline if it failed.
+func (p *SpeechPipeline) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && !p.completed && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	n, _ := p.buf.Read(b)
+	p.cond.Broadcast()
+	return n, nil
+}
+
+// Close stops the pipeline and drops the buffered audio, Read returns io.ErrClosedPipe.
+func (p *SpeechPipeline) Close() error {
+	p.CloseWithError(nil)
+	return nil
+}
+
+// CloseWithError stops the pipeline and drops the buffered audio, Read returns err or
+// io.ErrClosedPipe if err is nil. Only the first error is kept.
+func (p *SpeechPipeline) CloseWithError(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	p.err = err
+	p.buf.Reset()
+	close(p.closed)
+	p.cond.Broadcast()
+}
+
+func (p *SpeechPipeline) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *SpeechPipeline) readErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+var (
+	codeBlockPattern   = regexp.MustCompile("(?s)```.*?(```|$)")
+	imagePattern       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	htmlTagPattern     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	rulePattern        = regexp.MustCompile(`(?m)^[ \t]*[-*_=]{3,}[ \t]*$`)
+	lineMarkupPattern  = regexp.MustCompile(`(?m)^[ \t]*(#{1,6}[ \t]+|>+[ \t]?|[-*+][ \t]+|\d+[.)][ \t]+)`)
+	emphasisPattern    = regexp.MustCompile("\\*+|~~|`+")
+	spacePattern       = regexp.MustCompile(`\s+`)
+	tableBorderPattern = regexp.MustCompile(`(?m)^[ \t]*\|[ \t:|-]*\|[ \t]*$`)
+	tablePipes         = strings.NewReplacer("|", " ")
+)
+
+// StripForSpeech removes markdown and emoji from text so it is read naturally by speech synthesis.
+// Code blocks, the URLs of images and links, emphasis, headings, quotes, list markers, tables and HTML
+// tags are removed and the whitespace is collapsed.
+func StripForSpeech(text string) string {
+	return stripSpeechText(codeBlockPattern.ReplaceAllString(text, " "), true)
+}
+
+func stripSpeechText(text string, lineStart bool) string {
+	text = tableBorderPattern.ReplaceAllString(text, "")
+	text = rulePattern.ReplaceAllString(text, "")
+	if lineStart {
+		text = lineMarkupPattern.ReplaceAllString(text, "")
+	}
+	text = imagePattern.ReplaceAllString(text, "$1")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = emphasisPattern.ReplaceAllString(text, "")
+	text = tablePipes.Replace(text)
+
+	runes := []rune(text)
+	var b strings.Builder
+	for i, r := range runes {
+		if isEmoji(r) {
+			continue
+		}
+		// underscores of emphasis, but not of identifiers such as snake_case
+		if r == '_' && (i == 0 || i == len(runes)-1 || !isWordRune(runes[i-1]) || !isWordRune(runes[i+1])) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(spacePattern.ReplaceAllString(b.String(), " "))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isEmoji returns whether r is an emoji or a part of an emoji sequence. Other symbols such as ℃ and
+// © are read aloud, so they are kept.
+func isEmoji(r rune) bool {
+	switch {
+	case r == 0x200d || r == 0xfe0f || r == 0xfe0e || r == 0x20e3:
+		// zero width joiner, variation selectors and keycap
+		return true
+	case r >= 0xe0020 && r <= 0xe007f:
+		// tags of flags
+		return true
+	case r >= 0x1f000 && r <= 0x1faff:
+		// pictographs, flags and skin tones
+		return true
+	case r >= 0x2600 && r <= 0x27bf:
+		// miscellaneous symbols and dingbats
+		return true
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ SpeechTextSender = &coze.WebSocketAudioSpeech{}
+
+type mockSpeechTextSender struct {
+	mu        sync.Mutex
+	deltas    []string
+	completed bool
+}
+
+func (m *mockSpeechTextSender) InputTextBufferAppend(data *coze.WebSocketInputTextBufferAppendEventData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deltas = append(m.deltas, data.Delta)
+	return nil
+}
+
+func (m *mockSpeechTextSender) InputTextBufferComplete(data *coze.WebSocketInputTextBufferCompleteEventData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completed = true
+	return nil
+}
+
+// blockingChatStream blocks in Recv until it is closed.
+type blockingChatStream struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (m *blockingChatStream) Response() coze.HTTPResponse { return nil }
+
+func (m *blockingChatStream) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+func (m *blockingChatStream) Recv() (*coze.ChatEvent, error) {
+	<-m.closed
+	return nil, errors.New("stream closed")
+}
+
+func answerDelta(content string) *coze.ChatEvent {
+	return &coze.ChatEvent{Event: coze.ChatEventConversationMessageDelta, Message: &coze.Message{Type: coze.MessageTypeAnswer, Content: content}}
+}
+
+func speechAudioUpdate(delta []byte) *coze.WebSocketSpeechAudioUpdateEvent {
+	return &coze.WebSocketSpeechAudioUpdateEvent{Data: &coze.WebSocketSpeechAudioUpdateEventData{Delta: delta}}
+}
+
+func TestSpeechPipeline(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+
+	t.Run("phrases", func(t *testing.T) {
+		speech := &mockSpeechTextSender{}
+		stream := &mockChatStream{events: []*coze.ChatEvent{
+			{Event: coze.ChatEventConversationChatCreated, Chat: &coze.Chat{}},
+			answerDelta("# Title\n"),
+			answerDelta("Hello **world**! Here"),
+			answerDelta(" is 3.14"),
+			answerDelta(" and [a link](http://x.y). "),
+			answerDelta("\n```go\nx := 1. y\n```\n"),
+			answerDelta("1. First item, second"),
+			answerDelta(" item\n你好，"),
+			answerDelta("世界。😀 Done"),
+			{Event: coze.ChatEventConversationMessageDelta, Message: &coze.Message{Type: coze.MessageTypeFollowUp, Content: "Ignored."}},
+			{Event: coze.ChatEventConversationChatCompleted, Chat: &coze.Chat{}},
+			{Event: coze.ChatEventDone},
+		}}
+		p := NewSpeechPipeline(speech)
+		var phrases []string
+		p.OnPhrase = func(phrase string) { phrases = append(phrases, phrase) }
+		as.Nil(p.Run(ctx, stream))
+		as.True(stream.closed)
+		as.True(speech.completed)
+		as.Equal([]string{
+			"Title ", "Hello world! ", "Here is 3.14 and a link. ", "First item, ", "second item ", "你好，世界。", "Done ",
+		}, speech.deltas)
+		as.Equal("Title", phrases[0])
+	})
+
+	t.Run("long phrase", func(t *testing.T) {
+		p := NewSpeechPipeline(nil)
+		p.MaxPhraseLength = 12
+		as.Equal(0, p.phraseEnd([]rune("one two"), false))
+		as.Equal(8, p.phraseEnd([]rune("one two three four"), false))
+		as.Equal(12, p.phraseEnd([]rune("abcdefghijklmnop"), false))
+		as.Equal(7, p.phraseEnd([]rune("one two"), true))
+		// a Latin terminator waits for the next delta
+		as.Equal(0, p.phraseEnd([]rune("Hi."), false))
+		as.Equal(3, p.phraseEnd([]rune("Hi. "), false))
+		as.Equal(3, p.phraseEnd([]rune("Hi."), true))
+	})
+
+	t.Run("chat failed", func(t *testing.T) {
+		speech := &mockSpeechTextSender{}
+		stream := &mockChatStream{events: []*coze.ChatEvent{
+			answerDelta("Hello. "),
+			{Event: coze.ChatEventConversationChatFailed, Chat: &coze.Chat{LastError: &coze.ChatError{Code: 1, Msg: "failed"}}},
+		}}
+		p := NewSpeechPipeline(speech)
+		err := p.Run(ctx, stream)
+		as.NotNil(err)
+		as.Contains(err.Error(), "failed")
+		as.False(speech.completed)
+		_, err = p.Read(make([]byte, 1))
+		as.Contains(err.Error(), "failed")
+	})
+
+	t.Run("backpressure", func(t *testing.T) {
+		p := NewSpeechPipeline(&mockSpeechTextSender{})
+		p.BufferSize = 4
+		p.SpeechAudioUpdate(speechAudioUpdate([]byte{1, 2, 3}))
+		p.SpeechAudioUpdate(speechAudioUpdate([]byte{4, 5, 6}))
+		done := make(chan struct{})
+		go func() {
+			p.SpeechAudioUpdate(speechAudioUpdate([]byte{7, 8}))
+			p.SpeechAudioCompleted(&coze.WebSocketSpeechAudioCompletedEvent{})
+			close(done)
+		}()
+		select {
+		case <-done:
+			as.Fail("update is not blocked")
+		case <-time.After(20 * time.Millisecond):
+		}
+		b := make([]byte, 6)
+		n, err := p.Read(b)
+		as.Nil(err)
+		as.Equal([]byte{1, 2, 3, 4, 5, 6}, b[:n])
+		<-done
+		rest, err := io.ReadAll(p)
+		as.Nil(err)
+		as.Equal([]byte{7, 8}, rest)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		p := NewSpeechPipeline(&mockSpeechTextSender{})
+		p.BufferSize = 1
+		p.SpeechAudioUpdate(speechAudioUpdate([]byte{1}))
+		stream := &blockingChatStream{closed: make(chan struct{})}
+		result := make(chan error)
+		go func() { result <- p.Run(ctx, stream) }()
+		updated := make(chan struct{})
+		go func() {
+			p.SpeechAudioUpdate(speechAudioUpdate([]byte{2}))
+			close(updated)
+		}()
+		as.Nil(p.Close())
+		as.Equal(io.ErrClosedPipe, <-result)
+		<-updated
+		_, err := p.Read(make([]byte, 1))
+		as.Equal(io.ErrClosedPipe, err)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		p := NewSpeechPipeline(&mockSpeechTextSender{})
+		ctx, cancel := context.WithCancel(ctx)
+		stream := &blockingChatStream{closed: make(chan struct{})}
+		result := make(chan error)
+		go func() { result <- p.Run(ctx, stream) }()
+		cancel()
+		as.Equal(context.Canceled, <-result)
+		_, err := io.ReadAll(p)
+		as.Equal(context.Canceled, err)
+	})
+
+	t.Run("speech error", func(t *testing.T) {
+		p := NewSpeechPipeline(&mockSpeechTextSender{})
+		p.SpeechAudioUpdate(speechAudioUpdate([]byte{1}))
+		p.SpeechError(&coze.WebSocketErrorEvent{Data: coze.NewError(4000, "invalid voice", "")})
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, p)
+		as.Contains(err.Error(), "invalid voice")
+	})
+}
+
+func TestStripForSpeech(t *testing.T) {
+	as := assert.New(t)
+	as.Equal("Title quote item one img code bold snake_case under a b",
+		StripForSpeech("## Title\n> quote\n- item *one*\n![img](u) `code` <b>bold</b> snake_case __under__ 👍🏽 ❤️ 🇨🇳\n```\ncode\n```\n|a|b|\n|---|:-:|\n---"))
+	as.Equal("see the docs.", StripForSpeech("see [the docs](https://example.com/a_b)."))
+	as.Equal("你好世界", StripForSpeech("你好😀世界✨"))
+	// symbols which are not emoji are kept
+	as.Equal("25℃ and 90° are fine™ © ®", StripForSpeech("25℃ and 90° are fine™ © ® ☀️"))
+	// markers are only removed at the start of a line
+	as.Equal("a - b", stripSpeechText("a - b", false))
+	as.Equal("b", stripSpeechText("- b", true))
+}
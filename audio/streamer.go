@@ -0,0 +1,234 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+var (
+	_ InputAudioSender = (*coze.WebSocketChat)(nil)
+	_ InputAudioSender = (*coze.WebSocketAudioTranscription)(nil)
+)
+
+// InputAudioSender is implemented by coze.WebSocketChat and coze.WebSocketAudioTranscription.
+type InputAudioSender interface {
+	InputAudioAppender
+	InputAudioBufferComplete(data *coze.WebSocketInputAudioBufferCompleteEventData) error
+}
+
+// StreamStopReason tells why a Streamer stopped.
+type StreamStopReason string
+
+const (
+	StreamStopEOF           StreamStopReason = "eof"
+	StreamStopContext       StreamStopReason = "context"
+	StreamStopSpeechStarted StreamStopReason = "speech_started"
+)
+
+const defaultStreamChunk = 100 * time.Millisecond
+
+// Streamer sends audio from a reader through InputAudioBufferAppend at real-time pace, to
+// simulate a live microphone from a file.
+type Streamer struct {
+	sender InputAudioSender
+	input  *coze.WebSocketInputAudio
+
+	// The duration of each InputAudioBufferAppend, default is 100ms.
+	ChunkDuration time.Duration
+
+	// The pace relative to real time, default is 1. 2 sends twice as fast, a negative value sends
+	// without waiting.
+	Speed float64
+
+	// Stop when SpeechStarted is called, for example to let the user interrupt an answer.
+	StopOnSpeechStarted bool
+
+	// Send InputAudioBufferComplete when the stream stops, needed when the server VAD is disabled.
+	Complete bool
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// StreamResult reports what a Streamer sent.
+type StreamResult struct {
+	Reason StreamStopReason
+	// The number of audio bytes sent, including a wav header.
+	Bytes int64
+	// The duration of the audio sent.
+	Duration time.Duration
+	Chunks   int
+}
+
+// NewStreamer creates a streamer for a session configured with input, which may be pcm, wav or
+// G.711. Opus is not supported as its chunks cannot be derived from the format.
+func NewStreamer(sender InputAudioSender, input *coze.WebSocketInputAudio) *Streamer {
+	return &Streamer{sender: sender, input: input}
+}
+
+// SpeechStarted stops a running Stream when StopOnSpeechStarted is set. Call it from
+// WebSocketChat.OnInputAudioBufferSpeechStarted.
+func (s *Streamer) SpeechStarted() {
+	if !s.StopOnSpeechStarted {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Stream sends the audio of r until it ends, ctx is done or the speech starts. If r is a wav file,
+// the header is sent first and the chunks are derived from its format.
+func (s *Streamer) Stream(ctx context.Context, r io.Reader) (*StreamResult, error) {
+	stop := make(chan struct{})
+	s.mu.Lock()
+	s.stop = stop
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.stop == stop {
+			s.stop = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	result := &StreamResult{}
+	frameSize, rate, header, reader, err := s.prepare(r)
+	if err != nil {
+		return result, err
+	}
+	chunk := s.ChunkDuration
+	if chunk <= 0 {
+		chunk = defaultStreamChunk
+	}
+	chunkSize := int(int64(chunk)*int64(rate)/int64(time.Second)) * frameSize
+	if chunkSize <= 0 {
+		chunkSize = frameSize
+	}
+	speed := s.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	if len(header) > 0 {
+		if err := s.append(result, header, 0); err != nil {
+			return result, err
+		}
+	}
+
+	start := time.Now()
+	buf := make([]byte, chunkSize)
+	var frames int64
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		if n > 0 {
+			frames += int64(n / frameSize)
+			if err := s.append(result, buf[:n], time.Duration(frames*int64(time.Second)/int64(rate))); err != nil {
+				return result, err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			result.Reason = StreamStopEOF
+			break
+		} else if readErr != nil {
+			return result, readErr
+		}
+
+		result.Reason = s.wait(ctx, stop, start, speed, result.Duration)
+		if result.Reason != "" {
+			break
+		}
+	}
+
+	if s.Complete {
+		if err := s.sender.InputAudioBufferComplete(nil); err != nil {
+			return result, err
+		}
+	}
+	if result.Reason == StreamStopContext {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// wait waits until sent is due at the speed, it returns the reason if the stream must stop.
+func (s *Streamer) wait(ctx context.Context, stop chan struct{}, start time.Time, speed float64, sent time.Duration) StreamStopReason {
+	if speed < 0 {
+		select {
+		case <-ctx.Done():
+			return StreamStopContext
+		case <-stop:
+			return StreamStopSpeechStarted
+		default:
+			return ""
+		}
+	}
+	timer := time.NewTimer(time.Until(start.Add(time.Duration(float64(sent) / speed))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return StreamStopContext
+	case <-stop:
+		return StreamStopSpeechStarted
+	case <-timer.C:
+		return ""
+	}
+}
+
+func (s *Streamer) append(result *StreamResult, data []byte, duration time.Duration) error {
+	// the buffer is reused, the event is encoded asynchronously
+	delta := append([]byte(nil), data...)
+	if err := s.sender.InputAudioBufferAppend(&coze.WebSocketInputAudioBufferAppendEventData{Delta: delta}); err != nil {
+		return err
+	}
+	result.Bytes += int64(len(data))
+	result.Chunks++
+	if duration > 0 {
+		result.Duration = duration
+	}
+	return nil
+}
+
+// prepare returns the frame size and sample rate of the audio, and the wav header to send first.
+func (s *Streamer) prepare(r io.Reader) (int, int, []byte, io.Reader, error) {
+	format, codec := "wav", CodecPCM
+	if s.input != nil && s.input.Format != nil {
+		format = *s.input.Format
+	}
+	if s.input != nil && s.input.Codec != nil {
+		codec = Codec(*s.input.Codec)
+	}
+	switch {
+	case codec.IsG711():
+		return 1, G711SampleRate, nil, r, nil
+	case codec != CodecPCM:
+		return 0, 0, nil, nil, fmt.Errorf("unsupported input codec %q", codec)
+	case format == "pcm":
+		f := FormatFromInputAudio(s.input)
+		if err := f.Validate(); err != nil {
+			return 0, 0, nil, nil, err
+		}
+		return f.FrameSize(), f.SampleRate, nil, r, nil
+	case format == "wav":
+		header := &bytes.Buffer{}
+		reader, err := NewWAVReader(io.TeeReader(r, header))
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+		// data read after the header goes to the server unchanged
+		reader.reader = r
+		f := reader.Format()
+		return f.FrameSize(), f.SampleRate, header.Bytes(), reader, nil
+	}
+	return 0, 0, nil, nil, errors.New("unsupported input format " + format)
+}
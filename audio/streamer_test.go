@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSender struct {
+	mu        sync.Mutex
+	deltas    [][]byte
+	completed int
+	onAppend  func(n int)
+}
+
+func (m *mockSender) InputAudioBufferAppend(data *coze.WebSocketInputAudioBufferAppendEventData) error {
+	m.mu.Lock()
+	m.deltas = append(m.deltas, data.Delta)
+	n := len(m.deltas)
+	m.mu.Unlock()
+	if m.onAppend != nil {
+		m.onAppend(n)
+	}
+	return nil
+}
+
+func (m *mockSender) InputAudioBufferComplete(data *coze.WebSocketInputAudioBufferCompleteEventData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completed++
+	return nil
+}
+
+func TestStreamer(t *testing.T) {
+	as := assert.New(t)
+	pcmInput := &coze.WebSocketInputAudio{Format: ptr("pcm"), SampleRate: ptr(16000)}
+
+	t.Run("pcm unpaced", func(t *testing.T) {
+		sender := &mockSender{}
+		streamer := NewStreamer(sender, pcmInput)
+		streamer.Speed = -1
+		streamer.ChunkDuration = 20 * time.Millisecond
+		streamer.Complete = true
+		result, err := streamer.Stream(context.Background(), bytes.NewReader(make([]byte, 16000*2+100)))
+		as.Nil(err)
+		as.Equal(StreamStopEOF, result.Reason)
+		as.Equal(51, result.Chunks)
+		as.Len(sender.deltas[0], 640)
+		as.Len(sender.deltas[50], 100)
+		as.Equal(time.Second+3125*time.Microsecond, result.Duration)
+		as.Equal(1, sender.completed)
+	})
+
+	t.Run("real time", func(t *testing.T) {
+		sender := &mockSender{}
+		streamer := NewStreamer(sender, pcmInput)
+		streamer.Speed = 2
+		start := time.Now()
+		result, err := streamer.Stream(context.Background(), bytes.NewReader(make([]byte, 16000*2*4/10)))
+		as.Nil(err)
+		as.Equal(4, result.Chunks)
+		as.Equal(400*time.Millisecond, result.Duration)
+		as.GreaterOrEqual(time.Since(start), 150*time.Millisecond)
+		as.Less(time.Since(start), 400*time.Millisecond)
+		as.Equal(0, sender.completed)
+	})
+
+	t.Run("wav header", func(t *testing.T) {
+		sender := &mockSender{}
+		data, err := EncodeWAV(Format{SampleRate: 8000, Channels: 2, BitDepth: 16}, make([]byte, 8000*4/5))
+		as.Nil(err)
+		streamer := NewStreamer(sender, nil)
+		streamer.Speed = -1
+		result, err := streamer.Stream(context.Background(), bytes.NewReader(data))
+		as.Nil(err)
+		as.Len(sender.deltas, 3)
+		as.Len(sender.deltas[0], 44)
+		as.Len(sender.deltas[1], 3200)
+		as.Equal(int64(len(data)), result.Bytes)
+		as.Equal(200*time.Millisecond, result.Duration)
+	})
+
+	t.Run("speech started", func(t *testing.T) {
+		sender := &mockSender{}
+		streamer := NewStreamer(sender, G711InputAudio(CodecG711U))
+		streamer.StopOnSpeechStarted = true
+		streamer.Complete = true
+		streamer.Speed = 10
+		sender.onAppend = func(n int) {
+			if n == 2 {
+				streamer.SpeechStarted()
+			}
+		}
+		result, err := streamer.Stream(context.Background(), bytes.NewReader(make([]byte, 8000)))
+		as.Nil(err)
+		as.Equal(StreamStopSpeechStarted, result.Reason)
+		as.Len(sender.deltas, 2)
+		as.Len(sender.deltas[0], 800)
+		as.Equal(1, sender.completed)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		sender := &mockSender{}
+		streamer := NewStreamer(sender, pcmInput)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		result, err := streamer.Stream(ctx, bytes.NewReader(make([]byte, 16000*2*10)))
+		as.Equal(context.DeadlineExceeded, err)
+		as.Equal(StreamStopContext, result.Reason)
+		as.Len(sender.deltas, 1)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		streamer := NewStreamer(&mockSender{}, &coze.WebSocketInputAudio{Format: ptr("ogg"), Codec: ptr("opus")})
+		_, err := streamer.Stream(context.Background(), bytes.NewReader(nil))
+		as.NotNil(err)
+	})
+}
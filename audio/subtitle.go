@@ -0,0 +1,292 @@
+package audio
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// SubtitleCue is a subtitle, the times are relative to the start of the audio.
+type SubtitleCue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// SubtitleBuilder computes subtitle cues from the duration of the received audio. It is fed from
+// the handlers of a WebSocketChat, whose sentence start events give exact cue boundaries, or of a
+// WebSocketAudioSpeech, whose text is spread over its audio by the estimated speaking time of each
+// sentence.
+type SubtitleBuilder struct {
+	duration func(delta []byte) time.Duration
+
+	mu       sync.Mutex
+	cues     []*SubtitleCue
+	open     *SubtitleCue // the cue of the last sentence start, until the next one
+	position time.Duration
+	texts    []string      // text of the audio since segment
+	segment  time.Duration // the start of the audio of texts
+}
+
+// NewSubtitleBuilder creates a builder for audio received with the output audio config of the
+// session, which may be pcm, G.711 or opus with one packet per delta. nil means the default pcm.
+func NewSubtitleBuilder(out *coze.WebSocketOutputAudio) (*SubtitleBuilder, error) {
+	codec := CodecPCM
+	if out != nil && out.Codec != nil {
+		codec = Codec(*out.Codec)
+	}
+	var duration func([]byte) time.Duration
+	switch {
+	case codec == CodecPCM:
+		f := FormatFromOutputAudio(out)
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		duration = func(delta []byte) time.Duration { return f.Duration(len(delta)) }
+	case codec.IsG711():
+		duration = func(delta []byte) time.Duration { return time.Duration(len(delta)) * time.Second / G711SampleRate }
+	case codec == CodecOpus:
+		duration = func(delta []byte) time.Duration {
+			d, _ := OpusPacketDuration(delta)
+			return d
+		}
+	default:
+		return nil, fmt.Errorf("unsupported output codec %q", codec)
+	}
+	return &SubtitleBuilder{duration: duration}, nil
+}
+
+// SentenceStart starts a cue at the current position, call it from
+// WebSocketChat.OnConversationAudioSentenceStart.
+func (b *SubtitleBuilder) SentenceStart(event *coze.WebSocketConversationAudioSentenceStartEvent) {
+	if event == nil || event.Data == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeCue()
+	b.open = &SubtitleCue{Start: b.position, Text: strings.TrimSpace(event.Data.Text)}
+}
+
+// AudioDelta advances the position, call it from WebSocketChat.OnConversationAudioDelta.
+func (b *SubtitleBuilder) AudioDelta(event *coze.WebSocketConversationAudioDeltaEvent) {
+	if event == nil || event.Data == nil {
+		return
+	}
+	b.Audio(event.Data.Content)
+}
+
+// AudioCompleted ends the cue of the last sentence, call it from
+// WebSocketChat.OnConversationAudioCompleted.
+func (b *SubtitleBuilder) AudioCompleted(event *coze.WebSocketConversationAudioCompletedEvent) {
+	b.Complete()
+}
+
+// SpeechAudioUpdate advances the position, call it from WebSocketAudioSpeech.OnSpeechAudioUpdate.
+func (b *SubtitleBuilder) SpeechAudioUpdate(event *coze.WebSocketSpeechAudioUpdateEvent) {
+	if event == nil || event.Data == nil {
+		return
+	}
+	b.Audio(event.Data.Delta)
+}
+
+// SpeechAudioCompleted spreads the text over the audio, call it from
+// WebSocketAudioSpeech.OnSpeechAudioCompleted.
+func (b *SubtitleBuilder) SpeechAudioCompleted(event *coze.WebSocketSpeechAudioCompletedEvent) {
+	b.Complete()
+}
+
+// Text adds text of the audio which has no sentence start events, such as the deltas sent with
+// WebSocketAudioSpeech.InputTextBufferAppend. It is split into cues by Complete.
+func (b *SubtitleBuilder) Text(text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.texts = append(b.texts, text)
+}
+
+// Audio advances the position by the duration of an audio delta.
+func (b *SubtitleBuilder) Audio(delta []byte) {
+	d := b.duration(delta)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.position += d
+}
+
+// Complete ends the cue of the last sentence and spreads the text added since the last Complete
+// over the audio received since then. Completing each sentence separately gives exact cues.
+func (b *SubtitleBuilder) Complete() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeCue()
+	b.spread()
+}
+
+// ChatEvent feeds an event of a streamed chat, the answer text is spread over the audio of the
+// ConversationAudioDelta events, whose content is base64 encoded, when the chat completes.
+func (b *SubtitleBuilder) ChatEvent(event *coze.ChatEvent) error {
+	if event == nil {
+		return nil
+	}
+	switch event.Event {
+	case coze.ChatEventConversationMessageDelta:
+		if event.Message != nil && event.Message.Type == coze.MessageTypeAnswer {
+			b.Text(event.Message.Content)
+		}
+	case coze.ChatEventConversationAudioDelta:
+		if event.Message == nil {
+			return nil
+		}
+		delta, err := base64.StdEncoding.DecodeString(event.Message.Content)
+		if err != nil {
+			return fmt.Errorf("decode audio delta: %w", err)
+		}
+		b.Audio(delta)
+	case coze.ChatEventConversationChatCompleted, coze.ChatEventDone:
+		b.Complete()
+	}
+	return nil
+}
+
+// ChatStreamSubtitles reads a streamed chat to the end and returns its subtitles, out describes the
+// audio of the ConversationAudioDelta events.
+func ChatStreamSubtitles(stream coze.Stream[coze.ChatEvent], out *coze.WebSocketOutputAudio) ([]*SubtitleCue, error) {
+	b, err := NewSubtitleBuilder(out)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := b.ChatEvent(event); err != nil {
+			return nil, err
+		}
+		if event.IsDone() {
+			break
+		}
+	}
+	b.Complete()
+	return b.Cues(), nil
+}
+
+// Position returns the duration of the received audio.
+func (b *SubtitleBuilder) Position() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.position
+}
+
+// Cues returns the cues so far, the cue of a sentence in progress ends at the current position.
+func (b *SubtitleBuilder) Cues() []*SubtitleCue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cues := make([]*SubtitleCue, 0, len(b.cues)+1)
+	for _, cue := range b.cues {
+		c := *cue
+		cues = append(cues, &c)
+	}
+	if b.open != nil && b.open.Text != "" && b.position > b.open.Start {
+		cues = append(cues, &SubtitleCue{Start: b.open.Start, End: b.position, Text: b.open.Text})
+	}
+	return cues
+}
+
+// SRT returns the cues in the SubRip format.
+func (b *SubtitleBuilder) SRT() string {
+	s := &strings.Builder{}
+	_ = WriteSRT(s, b.Cues())
+	return s.String()
+}
+
+// WebVTT returns the cues in the WebVTT format.
+func (b *SubtitleBuilder) WebVTT() string {
+	s := &strings.Builder{}
+	_ = WriteWebVTT(s, b.Cues())
+	return s.String()
+}
+
+// Reset clears the cues and restarts the position at zero, for example to subtitle the audio of
+// each answer separately.
+func (b *SubtitleBuilder) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cues, b.open, b.texts = nil, nil, nil
+	b.position, b.segment = 0, 0
+}
+
+func (b *SubtitleBuilder) closeCue() {
+	if b.open != nil && b.open.Text != "" && b.position > b.open.Start {
+		b.open.End = b.position
+		b.cues = append(b.cues, b.open)
+	}
+	b.open = nil
+}
+
+// spread splits the pending text into sentences and gives each a share of the pending audio
+// proportional to its speaking time.
+func (b *SubtitleBuilder) spread() {
+	sentences := SplitSentences(strings.Join(b.texts, ""))
+	start, end := b.segment, b.position
+	b.texts, b.segment = nil, b.position
+	if len(sentences) == 0 || end <= start {
+		return
+	}
+	weights := make([]int, len(sentences))
+	total := 0
+	for i, s := range sentences {
+		weights[i] = speechWeight(s)
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+		total += weights[i]
+	}
+	acc := 0
+	for i, s := range sentences {
+		cueStart := start + (end-start)*time.Duration(acc)/time.Duration(total)
+		acc += weights[i]
+		cueEnd := start + (end-start)*time.Duration(acc)/time.Duration(total)
+		b.cues = append(b.cues, &SubtitleCue{Start: cueStart, End: cueEnd, Text: s})
+	}
+}
+
+// WriteSRT writes the cues in the SubRip format.
+func WriteSRT(w io.Writer, cues []*SubtitleCue) error {
+	for i, cue := range cues {
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1,
+			formatCueTime(cue.Start, ','), formatCueTime(cue.End, ','), cue.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWebVTT writes the cues in the WebVTT format.
+func WriteWebVTT(w io.Writer, cues []*SubtitleCue) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, cue := range cues {
+		// a blank line or "-->" in the text would end the cue
+		text := strings.ReplaceAll(strings.ReplaceAll(cue.Text, "\n\n", "\n"), "-->", "->")
+		if _, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n",
+			formatCueTime(cue.Start, '.'), formatCueTime(cue.End, '.'), text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatCueTime(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,124 @@
+package audio
+
+import (
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockChatStream struct {
+	events []*coze.ChatEvent
+	closed bool
+}
+
+func (m *mockChatStream) Response() coze.HTTPResponse { return nil }
+
+func (m *mockChatStream) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *mockChatStream) Recv() (*coze.ChatEvent, error) {
+	if len(m.events) == 0 {
+		return nil, io.EOF
+	}
+	event := m.events[0]
+	m.events = m.events[1:]
+	return event, nil
+}
+
+func TestSubtitleBuilder(t *testing.T) {
+	as := assert.New(t)
+	f := DefaultFormat
+
+	t.Run("chat", func(t *testing.T) {
+		b, err := NewSubtitleBuilder(nil)
+		as.Nil(err)
+		delta := func(d time.Duration) *coze.WebSocketConversationAudioDeltaEvent {
+			return audioDelta("a", "c", make([]byte, f.Bytes(d)))
+		}
+		b.SentenceStart(sentenceStart("Hello there."))
+		b.AudioDelta(delta(800 * time.Millisecond))
+		b.AudioDelta(delta(700 * time.Millisecond))
+		b.SentenceStart(sentenceStart("How are you?"))
+		b.AudioDelta(delta(1234 * time.Millisecond))
+
+		// the sentence in progress ends at the current position
+		cues := b.Cues()
+		as.Len(cues, 2)
+		as.Equal(2734*time.Millisecond, cues[1].End)
+
+		b.AudioCompleted(audioCompleted("a"))
+		b.AudioDelta(delta(time.Second))
+		as.Equal(3734*time.Millisecond, b.Position())
+		as.Equal("1\n00:00:00,000 --> 00:00:01,500\nHello there.\n\n"+
+			"2\n00:00:01,500 --> 00:00:02,734\nHow are you?\n\n", b.SRT())
+		as.Equal("WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello there.\n\n"+
+			"00:00:01.500 --> 00:00:02.734\nHow are you?\n\n", b.WebVTT())
+
+		b.Reset()
+		as.Empty(b.Cues())
+		as.Equal(time.Duration(0), b.Position())
+	})
+
+	t.Run("speech", func(t *testing.T) {
+		b, err := NewSubtitleBuilder(G711OutputAudio(CodecG711A, 0))
+		as.Nil(err)
+		b.Text("你好。")
+		b.Text("Good day.")
+		b.SpeechAudioUpdate(&coze.WebSocketSpeechAudioUpdateEvent{
+			Data: &coze.WebSocketSpeechAudioUpdateEventData{Delta: make([]byte, 8000)},
+		})
+		b.SpeechAudioCompleted(nil)
+
+		// 6 for the two CJK characters and 7 for the letters
+		cues := b.Cues()
+		as.Len(cues, 2)
+		as.Equal(&SubtitleCue{Start: 0, End: time.Second * 6 / 13, Text: "你好。"}, cues[0])
+		as.Equal(&SubtitleCue{Start: time.Second * 6 / 13, End: time.Second, Text: "Good day."}, cues[1])
+	})
+
+	t.Run("opus", func(t *testing.T) {
+		b, err := NewSubtitleBuilder(&coze.WebSocketOutputAudio{Codec: ptr("opus")})
+		as.Nil(err)
+		for i := 0; i < 5; i++ {
+			b.Audio([]byte{0xF8, 0xFF, 0xFE})
+		}
+		as.Equal(100*time.Millisecond, b.Position())
+	})
+
+	t.Run("chat stream", func(t *testing.T) {
+		audio := base64.StdEncoding.EncodeToString(make([]byte, f.Bytes(2*time.Second)))
+		stream := &mockChatStream{events: []*coze.ChatEvent{
+			{Event: coze.ChatEventConversationChatCreated, Chat: &coze.Chat{}},
+			{Event: coze.ChatEventConversationMessageDelta, Message: &coze.Message{Type: coze.MessageTypeAnswer, Content: "One two. "}},
+			{Event: coze.ChatEventConversationMessageDelta, Message: &coze.Message{Type: coze.MessageTypeAnswer, Content: "Three four."}},
+			{Event: coze.ChatEventConversationMessageDelta, Message: &coze.Message{Type: coze.MessageTypeFollowUp, Content: "Ignored."}},
+			{Event: coze.ChatEventConversationAudioDelta, Message: &coze.Message{Content: audio}},
+			{Event: coze.ChatEventConversationChatCompleted, Chat: &coze.Chat{}},
+			{Event: coze.ChatEventDone},
+		}}
+		cues, err := ChatStreamSubtitles(stream, nil)
+		as.Nil(err)
+		as.True(stream.closed)
+		as.Equal([]*SubtitleCue{
+			{Start: 0, End: 800 * time.Millisecond, Text: "One two."},
+			{Start: 800 * time.Millisecond, End: 2 * time.Second, Text: "Three four."},
+		}, cues)
+
+		stream = &mockChatStream{events: []*coze.ChatEvent{
+			{Event: coze.ChatEventConversationAudioDelta, Message: &coze.Message{Content: "!"}},
+		}}
+		_, err = ChatStreamSubtitles(stream, nil)
+		as.NotNil(err)
+	})
+
+	t.Run("unsupported codec", func(t *testing.T) {
+		_, err := NewSubtitleBuilder(&coze.WebSocketOutputAudio{Codec: ptr("mp3")})
+		as.NotNil(err)
+	})
+}
@@ -0,0 +1,233 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// SpeechCreator is implemented by the Audio.Speech service of coze.CozeAPI.
+type SpeechCreator interface {
+	Create(ctx context.Context, req *coze.CreateAudioSpeechReq, options ...coze.CozeAPIOption) (*coze.CreateAudioSpeechResp, error)
+}
+
+// LongSpeechReq represents the request for synthesizing a text of any length.
+type LongSpeechReq struct {
+	// The text to synthesize.
+	Input string
+
+	// The settings of every segment, see coze.CreateAudioSpeechReq. ResponseFormat may be wav,
+	// pcm or mp3, default is mp3.
+	VoiceID        string
+	ResponseFormat *coze.AudioFormat
+	Speed          *float32
+	SampleRate     *int
+	LoudnessRate   *int
+	Emotion        *string
+	EmotionScale   *float32
+
+	// The maximum length of a segment in runes, default is 300.
+	MaxSegmentLength int
+
+	// The maximum number of segments synthesized at the same time, default is 3.
+	Concurrency int
+
+	// The number of retries of a failed segment, default is 2, a negative value disables retries.
+	// Invalid requests, such as 4xxx coze errors other than the rate limit, are not retried.
+	MaxRetries int
+
+	// The delay before the first retry, doubled for each retry, default is 1s.
+	RetryDelay time.Duration
+
+	// Options of each Create request.
+	Options []coze.CozeAPIOption
+
+	// OnSegment is called after each segment is written, in order.
+	OnSegment func(segment *LongSpeechSegment)
+}
+
+// LongSpeechSegment represents a synthesized segment of the text.
+type LongSpeechSegment struct {
+	Index int
+	Text  string
+	// The number of audio bytes written, without the headers of the segment.
+	Bytes int
+	// The number of Create requests, more than 1 if the segment was retried.
+	Attempts int
+}
+
+// LongSpeechResp represents the response of SynthesizeLongSpeech.
+type LongSpeechResp struct {
+	Segments []*LongSpeechSegment
+	// The number of bytes written.
+	Bytes int64
+}
+
+const (
+	defaultSpeechSegmentLength = 300
+	defaultSpeechConcurrency   = 3
+)
+
+// SynthesizeLongSpeech splits the input at sentence boundaries, synthesizes the segments
+// concurrently and writes them to w in order as one stream. Wav segments are merged under one
+// header, which is patched on completion if w is an io.WriteSeeker. Mp3 segments are stripped of
+// their tags and VBR headers so the frames play as one file.
+func SynthesizeLongSpeech(ctx context.Context, speech SpeechCreator, req *LongSpeechReq, w io.Writer) (*LongSpeechResp, error) {
+	format := coze.AudioFormatMP3
+	if req.ResponseFormat != nil {
+		format = *req.ResponseFormat
+	}
+	if format != coze.AudioFormatMP3 && format != coze.AudioFormatWAV && format != coze.AudioFormatPCM {
+		return nil, fmt.Errorf("unsupported response format %q", format)
+	}
+	maxLength := req.MaxSegmentLength
+	if maxLength <= 0 {
+		maxLength = defaultSpeechSegmentLength
+	}
+	texts := SplitText(req.Input, maxLength)
+	if len(texts) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSpeechConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data     []byte
+		attempts int
+		err      error
+	}
+	results := make([]chan *result, len(texts))
+	for i := range results {
+		results[i] = make(chan *result, 1)
+	}
+	// a slot is taken in order and released when the segment is written, which bounds the
+	// segments held in memory
+	sem := make(chan struct{}, concurrency)
+	go func() {
+		for i, text := range texts {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, text string) {
+				data, attempts, err := createSpeechSegment(ctx, speech, req, format, text)
+				results[i] <- &result{data: data, attempts: attempts, err: err}
+			}(i, text)
+		}
+	}()
+
+	stitcher := &speechStitcher{format: format, writer: w}
+	resp := &LongSpeechResp{}
+	for i, text := range texts {
+		var res *result
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+		<-sem
+		if res.err != nil {
+			return resp, fmt.Errorf("synthesize segment %d: %w", i, res.err)
+		}
+		n, err := stitcher.write(res.data)
+		resp.Bytes += int64(n)
+		if err != nil {
+			return resp, err
+		}
+		segment := &LongSpeechSegment{Index: i, Text: text, Bytes: n, Attempts: res.attempts}
+		resp.Segments = append(resp.Segments, segment)
+		if req.OnSegment != nil {
+			req.OnSegment(segment)
+		}
+	}
+	return resp, stitcher.close()
+}
+
+// createSpeechSegment synthesizes a segment with retries, it returns the audio and the number of
+// attempts.
+func createSpeechSegment(ctx context.Context, speech SpeechCreator, req *LongSpeechReq, format coze.AudioFormat, text string) ([]byte, int, error) {
+	segmentReq := &coze.CreateAudioSpeechReq{
+		Input:          text,
+		VoiceID:        req.VoiceID,
+		ResponseFormat: format.Ptr(),
+		Speed:          req.Speed,
+		SampleRate:     req.SampleRate,
+		LoudnessRate:   req.LoudnessRate,
+		Emotion:        req.Emotion,
+		EmotionScale:   req.EmotionScale,
+	}
+	var data []byte
+	attempts, err := retry(ctx, req.MaxRetries, req.RetryDelay, func() error {
+		var err error
+		data, err = readSpeech(speech.Create(ctx, segmentReq, req.Options...))
+		return err
+	})
+	return data, attempts, err
+}
+
+func readSpeech(resp *coze.CreateAudioSpeechResp, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, errors.New("empty speech response")
+	}
+	defer resp.Data.Close()
+	data, err := io.ReadAll(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty speech response")
+	}
+	return data, nil
+}
+
+// speechStitcher writes the audio of the segments as one stream.
+type speechStitcher struct {
+	format coze.AudioFormat
+	writer io.Writer
+	wav    *WAVWriter
+}
+
+// write writes a segment and returns the number of bytes written.
+func (s *speechStitcher) write(data []byte) (int, error) {
+	switch s.format {
+	case coze.AudioFormatMP3:
+		return s.writer.Write(StripMP3Metadata(data))
+	case coze.AudioFormatWAV:
+		f, pcm, err := ReadWAV(bytes.NewReader(data))
+		if err != nil {
+			return 0, err
+		}
+		if s.wav == nil {
+			if s.wav, err = NewWAVWriter(s.writer, f); err != nil {
+				return 0, err
+			}
+		} else if f != s.wav.Format() {
+			if pcm, err = Convert(pcm, f, s.wav.Format()); err != nil {
+				return 0, err
+			}
+		}
+		return s.wav.Write(pcm)
+	}
+	return s.writer.Write(data)
+}
+
+func (s *speechStitcher) close() error {
+	if s.wav != nil {
+		return s.wav.Close()
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ SpeechCreator = coze.NewCozeAPI(coze.NewTokenAuth("token")).Audio.Speech
+
+type mockSpeech struct {
+	mu       sync.Mutex
+	reqs     []*coze.CreateAudioSpeechReq
+	failures map[string]int
+	create   func(req *coze.CreateAudioSpeechReq) []byte
+}
+
+func (m *mockSpeech) Create(ctx context.Context, req *coze.CreateAudioSpeechReq, options ...coze.CozeAPIOption) (*coze.CreateAudioSpeechResp, error) {
+	m.mu.Lock()
+	m.reqs = append(m.reqs, req)
+	n := len(m.reqs)
+	fail := m.failures[req.Input] > 0
+	if fail {
+		m.failures[req.Input]--
+	}
+	m.mu.Unlock()
+	if fail {
+		return nil, errors.New("server error")
+	}
+	// later segments finish first
+	time.Sleep(time.Duration(10-n) * time.Millisecond)
+	return &coze.CreateAudioSpeechResp{Data: io.NopCloser(bytes.NewReader(m.create(req)))}, nil
+}
+
+func TestSynthesizeLongSpeech(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	text := "First sentence. Second sentence. Third sentence. Fourth sentence."
+
+	t.Run("pcm", func(t *testing.T) {
+		speech := &mockSpeech{
+			failures: map[string]int{"Second sentence.": 2},
+			create:   func(req *coze.CreateAudioSpeechReq) []byte { return []byte(req.Input + "|") },
+		}
+		var indexes []int
+		buf := &bytes.Buffer{}
+		resp, err := SynthesizeLongSpeech(ctx, speech, &LongSpeechReq{
+			Input:            text,
+			VoiceID:          "voice",
+			ResponseFormat:   coze.AudioFormatPCM.Ptr(),
+			Speed:            ptr(float32(1.2)),
+			Emotion:          ptr("happy"),
+			MaxSegmentLength: 20,
+			RetryDelay:       time.Millisecond,
+			OnSegment:        func(segment *LongSpeechSegment) { indexes = append(indexes, segment.Index) },
+		}, buf)
+		as.Nil(err)
+		as.Equal("First sentence.|Second sentence.|Third sentence.|Fourth sentence.|", buf.String())
+		as.Equal(int64(buf.Len()), resp.Bytes)
+		as.Equal([]int{0, 1, 2, 3}, indexes)
+		as.Equal(3, resp.Segments[1].Attempts)
+		as.Equal(1, resp.Segments[0].Attempts)
+		as.Len(speech.reqs, 6)
+		for _, req := range speech.reqs {
+			as.Equal("voice", req.VoiceID)
+			as.Equal(coze.AudioFormatPCM, *req.ResponseFormat)
+			as.Equal(float32(1.2), *req.Speed)
+			as.Equal("happy", *req.Emotion)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		speech := &mockSpeech{
+			failures: map[string]int{"Third sentence.": 3},
+			create:   func(req *coze.CreateAudioSpeechReq) []byte { return []byte(req.Input) },
+		}
+		buf := &bytes.Buffer{}
+		resp, err := SynthesizeLongSpeech(ctx, speech, &LongSpeechReq{
+			Input:            text,
+			ResponseFormat:   coze.AudioFormatPCM.Ptr(),
+			MaxSegmentLength: 20,
+			MaxRetries:       1,
+			RetryDelay:       time.Millisecond,
+		}, buf)
+		as.NotNil(err)
+		as.Contains(err.Error(), "segment 2")
+		as.Len(resp.Segments, 2)
+		as.Equal("First sentence.Second sentence.", buf.String())
+	})
+
+	t.Run("wav", func(t *testing.T) {
+		f := Format{SampleRate: 16000, Channels: 1, BitDepth: 16}
+		speech := &mockSpeech{create: func(req *coze.CreateAudioSpeechReq) []byte {
+			data, _ := EncodeWAV(f, bytes.Repeat([]byte{byte(len(req.Input))}, 100))
+			return data
+		}}
+		file := &bytes.Buffer{}
+		resp, err := SynthesizeLongSpeech(ctx, speech, &LongSpeechReq{
+			Input:            "Short one. A longer one.",
+			ResponseFormat:   coze.AudioFormatWAV.Ptr(),
+			MaxSegmentLength: 14,
+		}, file)
+		as.Nil(err)
+		as.Len(resp.Segments, 2)
+		format, pcm, err := ReadWAV(file)
+		as.Nil(err)
+		as.Equal(f, format)
+		as.Equal(append(bytes.Repeat([]byte{10}, 100), bytes.Repeat([]byte{13}, 100)...), pcm)
+	})
+
+	t.Run("mp3", func(t *testing.T) {
+		speech := &mockSpeech{create: func(req *coze.CreateAudioSpeechReq) []byte {
+			return append(mp3TestFrame(0, "Xing"), mp3TestFrame(byte(len(req.Input)), "")...)
+		}}
+		buf := &bytes.Buffer{}
+		_, err := SynthesizeLongSpeech(ctx, speech, &LongSpeechReq{Input: "One. Three.", MaxSegmentLength: 6}, buf)
+		as.Nil(err)
+		as.Equal(coze.AudioFormatMP3, *speech.reqs[0].ResponseFormat)
+		as.Equal(append(mp3TestFrame(4, ""), mp3TestFrame(6, "")...), buf.Bytes())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := SynthesizeLongSpeech(ctx, &mockSpeech{}, &LongSpeechReq{Input: " "}, io.Discard)
+		as.NotNil(err)
+		_, err = SynthesizeLongSpeech(ctx, &mockSpeech{}, &LongSpeechReq{
+			Input:          strings.Repeat("a", 10),
+			ResponseFormat: coze.AudioFormatOGGOPUS.Ptr(),
+		}, io.Discard)
+		as.NotNil(err)
+	})
+}
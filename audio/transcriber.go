@@ -0,0 +1,476 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// TranscriptionBackend transcribes a chunk of pcm audio.
+type TranscriptionBackend interface {
+	Transcribe(ctx context.Context, f Format, pcm []byte) (string, error)
+}
+
+// TranscriptionCreator is implemented by the Audio.Transcriptions service of coze.CozeAPI.
+type TranscriptionCreator interface {
+	Create(ctx context.Context, req *coze.AudioSpeechTranscriptionsReq, options ...coze.CozeAPIOption) (*coze.CreateAudioTranscriptionsResp, error)
+}
+
+type restTranscriptionBackend struct {
+	transcriptions TranscriptionCreator
+	options        []coze.CozeAPIOption
+}
+
+// NewTranscriptionBackend returns a backend which uploads each chunk as a wav file to
+// Audio.Transcriptions.Create.
+func NewTranscriptionBackend(transcriptions TranscriptionCreator, options ...coze.CozeAPIOption) TranscriptionBackend {
+	return &restTranscriptionBackend{transcriptions: transcriptions, options: options}
+}
+
+func (b *restTranscriptionBackend) Transcribe(ctx context.Context, f Format, pcm []byte) (string, error) {
+	data, err := EncodeWAV(f, pcm)
+	if err != nil {
+		return "", err
+	}
+	resp, err := b.transcriptions.Create(ctx, &coze.AudioSpeechTranscriptionsReq{
+		Filename: "audio.wav",
+		Audio:    bytes.NewReader(data),
+	}, b.options...)
+	if err != nil {
+		return "", err
+	}
+	return resp.Data.Text, nil
+}
+
+// WebSocketTranscriptionCreator is implemented by the WebSockets.Audio.Transcriptions service of
+// coze.CozeAPI.
+type WebSocketTranscriptionCreator interface {
+	Create(ctx context.Context, req *coze.CreateWebsocketAudioTranscriptionReq) *coze.WebSocketAudioTranscription
+}
+
+// WebSocketTranscriptionBackend transcribes each chunk in a WebSocketAudioTranscription session.
+type WebSocketTranscriptionBackend struct {
+	transcriptions WebSocketTranscriptionCreator
+
+	// The options of each session.
+	Req *coze.CreateWebsocketAudioTranscriptionReq
+
+	// The pace of sending the audio, see Streamer.Speed. Default is -1, which sends without waiting.
+	Speed float64
+}
+
+// NewWebSocketTranscriptionBackend returns a backend which streams each chunk through the
+// WebSocket transcription service.
+func NewWebSocketTranscriptionBackend(transcriptions WebSocketTranscriptionCreator) *WebSocketTranscriptionBackend {
+	return &WebSocketTranscriptionBackend{transcriptions: transcriptions}
+}
+
+func (b *WebSocketTranscriptionBackend) Transcribe(ctx context.Context, f Format, pcm []byte) (string, error) {
+	req := b.Req
+	if req == nil {
+		req = &coze.CreateWebsocketAudioTranscriptionReq{}
+	}
+	cli := b.transcriptions.Create(ctx, req)
+	// the handlers run in the order of the events, unlike Wait which may return before the last
+	// update is handled
+	var text string
+	done := make(chan error, 1)
+	finish := func(err error) {
+		select {
+		case done <- err:
+		default:
+		}
+	}
+	cli.OnTranscriptionsMessageUpdate(func(ctx context.Context, cli *coze.WebSocketAudioTranscription, event *coze.WebSocketTranscriptionsMessageUpdateEvent) error {
+		if event.Data != nil {
+			text = event.Data.Content
+		}
+		return nil
+	})
+	cli.OnTranscriptionsMessageCompleted(func(ctx context.Context, cli *coze.WebSocketAudioTranscription, event *coze.WebSocketTranscriptionsMessageCompletedEvent) error {
+		finish(nil)
+		return nil
+	})
+	cli.OnError(func(ctx context.Context, cli *coze.WebSocketAudioTranscription, event *coze.WebSocketErrorEvent) error {
+		if event.Data != nil {
+			finish(event.Data)
+		} else {
+			finish(errors.New("transcription error"))
+		}
+		return nil
+	})
+	if err := cli.Connect(); err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	input := f.InputAudio()
+	if err := cli.TranscriptionsUpdate(&coze.WebSocketTranscriptionsUpdateEventData{InputAudio: input}); err != nil {
+		return "", err
+	}
+	streamer := NewStreamer(cli, input)
+	streamer.Speed = b.Speed
+	if streamer.Speed == 0 {
+		streamer.Speed = -1
+	}
+	streamer.ChunkDuration = 200 * time.Millisecond
+	streamer.Complete = true
+	if _, err := streamer.Stream(ctx, bytes.NewReader(pcm)); err != nil {
+		return "", err
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+		return text, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// TranscriptionFormat is the format the audio is converted to before it is split, 16kHz mono is
+// enough for speech recognition.
+var TranscriptionFormat = Format{SampleRate: 16000, Channels: 1, BitDepth: 16}
+
+// TranscribeReq represents the request for transcribing audio of any length.
+type TranscribeReq struct {
+	// The audio, a wav file or raw pcm in Format.
+	Audio io.Reader
+
+	// The format of raw pcm audio, ignored for wav files.
+	Format Format
+
+	// The maximum duration of a chunk, default is 30s.
+	ChunkDuration time.Duration
+
+	// Cut each chunk at the quietest moment of its last quarter instead of at a fixed window. If
+	// no moment is quieter than SilenceThreshold, the chunk is cut at the window with Overlap.
+	SplitOnSilence bool
+
+	// The level in dBFS below which audio is silent, default is -40.
+	SilenceThreshold float64
+
+	// The audio shared by fixed windows, the words transcribed twice are removed when merging,
+	// default is 1s. A negative value disables the overlap.
+	Overlap time.Duration
+
+	// The maximum number of chunks transcribed at the same time, default is 3.
+	Concurrency int
+
+	// The number of retries of a failed chunk, default is 2, a negative value disables retries.
+	// Invalid requests, such as 4xxx coze errors other than the rate limit, are not retried.
+	MaxRetries int
+
+	// The delay before the first retry, doubled for each retry, default is 1s.
+	RetryDelay time.Duration
+
+	// OnProgress is called after each chunk is transcribed.
+	OnProgress func(done, total int)
+}
+
+// TranscriptSegment is the text of a chunk, the offsets are relative to the start of the audio.
+type TranscriptSegment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// TranscribeResp represents the response of Transcribe.
+type TranscribeResp struct {
+	// The merged text.
+	Text string
+	// The segments with text, in order.
+	Segments []*TranscriptSegment
+	// The duration of the audio.
+	Duration time.Duration
+}
+
+const (
+	defaultTranscribeChunk       = 30 * time.Second
+	defaultTranscribeOverlap     = time.Second
+	defaultTranscribeConcurrency = 3
+	defaultSilenceThreshold      = -40
+	silenceFrame                 = 20 * time.Millisecond
+)
+
+// transcribeChunk is a range of the pcm data, overlap is the size shared with the previous chunk.
+type transcribeChunk struct {
+	start, end, overlap int
+}
+
+// Transcribe splits long audio into chunks, transcribes them concurrently with the backend and
+// merges the text. The audio is converted to TranscriptionFormat first.
+func Transcribe(ctx context.Context, backend TranscriptionBackend, req *TranscribeReq) (*TranscribeResp, error) {
+	pcm, err := readTranscriptionAudio(req)
+	if err != nil {
+		return nil, err
+	}
+	f := TranscriptionFormat
+	chunks := splitTranscription(pcm, req)
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultTranscribeConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	texts := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, concurrency)
+	var mu sync.Mutex
+	done := 0
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk transcribeChunk) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			_, errs[i] = retry(ctx, req.MaxRetries, req.RetryDelay, func() error {
+				var err error
+				texts[i], err = backend.Transcribe(ctx, f, pcm[chunk.start:chunk.end])
+				return err
+			})
+			if errs[i] != nil {
+				cancel()
+				return
+			}
+			if req.OnProgress != nil {
+				mu.Lock()
+				done++
+				req.OnProgress(done, len(chunks))
+				mu.Unlock()
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		// the first error caused the others
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("transcribe chunk %d: %w", i, err)
+		}
+	}
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("transcribe chunk %d: %w", i, err)
+		}
+	}
+
+	resp := &TranscribeResp{Duration: f.Duration(len(pcm))}
+	var prev string
+	var parts []string
+	for i, chunk := range chunks {
+		text := strings.TrimSpace(texts[i])
+		if chunk.overlap > 0 && prev != "" {
+			text = removeOverlap(prev, text)
+		}
+		prev = strings.TrimSpace(texts[i])
+		if text == "" {
+			continue
+		}
+		resp.Segments = append(resp.Segments, &TranscriptSegment{
+			Start: f.Duration(chunk.start + chunk.overlap),
+			End:   f.Duration(chunk.end),
+			Text:  text,
+		})
+		parts = append(parts, text)
+	}
+	resp.Text = joinTexts(parts)
+	return resp, nil
+}
+
+// readTranscriptionAudio reads the audio and converts it to TranscriptionFormat.
+func readTranscriptionAudio(req *TranscribeReq) ([]byte, error) {
+	if req.Audio == nil {
+		return nil, errors.New("audio is required")
+	}
+	reader := bufio.NewReader(req.Audio)
+	f := req.Format
+	var r io.Reader = reader
+	if magic, _ := reader.Peek(4); string(magic) == "RIFF" {
+		wav, err := NewWAVReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		f, r = wav.Format(), wav
+	}
+	converter, err := NewConverter(f, TranscriptionFormat)
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		out.Write(converter.Process(buf[:n]))
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	out.Write(converter.Flush())
+	return out.Bytes(), nil
+}
+
+// splitTranscription splits the pcm data in TranscriptionFormat into chunks.
+func splitTranscription(pcm []byte, req *TranscribeReq) []transcribeChunk {
+	f := TranscriptionFormat
+	chunkSize := f.Bytes(req.ChunkDuration)
+	if chunkSize <= 0 {
+		chunkSize = f.Bytes(defaultTranscribeChunk)
+	}
+	overlap := f.Bytes(req.Overlap)
+	if req.Overlap == 0 {
+		overlap = f.Bytes(defaultTranscribeOverlap)
+	} else if req.Overlap < 0 {
+		overlap = 0
+	}
+	if overlap >= chunkSize/2 {
+		overlap = f.Bytes(f.Duration(chunkSize / 2))
+	}
+	threshold := req.SilenceThreshold
+	if threshold == 0 {
+		threshold = defaultSilenceThreshold
+	}
+
+	var chunks []transcribeChunk
+	start, shared := 0, 0
+	for start < len(pcm) {
+		end := start + chunkSize
+		if end >= len(pcm) {
+			chunks = append(chunks, transcribeChunk{start: start, end: len(pcm), overlap: shared})
+			break
+		}
+		if req.SplitOnSilence {
+			search := f.Bytes(f.Duration(chunkSize / 4))
+			if cut, ok := quietestFrame(pcm[end-search:end], f, threshold); ok {
+				end = end - search + cut
+				chunks = append(chunks, transcribeChunk{start: start, end: end, overlap: shared})
+				start, shared = end, 0
+				continue
+			}
+		}
+		chunks = append(chunks, transcribeChunk{start: start, end: end, overlap: shared})
+		start, shared = end-overlap, overlap
+	}
+	return chunks
+}
+
+// quietestFrame returns the offset of the middle of the quietest frame, if it is below the
+// threshold.
+func quietestFrame(pcm []byte, f Format, threshold float64) (int, bool) {
+	frameSize := f.Bytes(silenceFrame)
+	best, bestLevel := 0, math.Inf(1)
+	for offset := 0; offset+frameSize <= len(pcm); offset += frameSize {
+		if level := frameLevel(pcm[offset:offset+frameSize], f); level < bestLevel {
+			best, bestLevel = offset, level
+		}
+	}
+	if bestLevel >= threshold {
+		return 0, false
+	}
+	return best + f.Bytes(silenceFrame/2), true
+}
+
+// frameLevel returns the RMS level of the frame in dBFS.
+func frameLevel(frame []byte, f Format) float64 {
+	samples := DecodeSamples(frame, f)
+	if len(samples) == 0 {
+		return math.Inf(-1)
+	}
+	var energy float64
+	for _, s := range samples {
+		energy += s * s
+	}
+	return 20 * math.Log10(math.Sqrt(energy/float64(len(samples))))
+}
+
+// transcriptToken is a word, or a CJK character, of a text and its end offset.
+type transcriptToken struct {
+	norm string
+	end  int
+}
+
+func tokenizeTranscript(text string) []transcriptToken {
+	var tokens []transcriptToken
+	word := &strings.Builder{}
+	flush := func(end int) {
+		if word.Len() > 0 {
+			tokens = append(tokens, transcriptToken{norm: word.String(), end: end})
+			word.Reset()
+		}
+	}
+	for i, r := range text {
+		switch {
+		case isCJK(r):
+			flush(i)
+			tokens = append(tokens, transcriptToken{norm: string(r), end: i + len(string(r))})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'':
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+// removeOverlap removes the words at the start of text which end prev, as they were transcribed
+// from the overlapping audio. At least two words must match to rule out a coincidence.
+func removeOverlap(prev, text string) string {
+	prevTokens, tokens := tokenizeTranscript(prev), tokenizeTranscript(text)
+	for k := minInt(len(prevTokens), len(tokens)); k >= 2; k-- {
+		match := true
+		for i := 0; i < k; i++ {
+			if prevTokens[len(prevTokens)-k+i].norm != tokens[i].norm {
+				match = false
+				break
+			}
+		}
+		if match {
+			return strings.TrimLeftFunc(text[tokens[k-1].end:], func(r rune) bool {
+				return unicode.IsSpace(r) || unicode.IsPunct(r)
+			})
+		}
+	}
+	return text
+}
+
+// joinTexts joins texts with a space, except next to CJK text.
+func joinTexts(texts []string) string {
+	s := &strings.Builder{}
+	for i, text := range texts {
+		if i > 0 {
+			last := []rune(texts[i-1])
+			if !isWide(last[len(last)-1]) && !isWide([]rune(text)[0]) {
+				s.WriteByte(' ')
+			}
+		}
+		s.WriteString(text)
+	}
+	return s.String()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
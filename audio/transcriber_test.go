@@ -0,0 +1,232 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ TranscriptionCreator          = coze.NewCozeAPI(coze.NewTokenAuth("token")).Audio.Transcriptions
+	_ WebSocketTranscriptionCreator = coze.NewCozeAPI(coze.NewTokenAuth("token")).WebSockets.Audio.Transcriptions
+)
+
+// wordAudio returns 250ms blocks of constant level i/100, the word "wi" for each block.
+func wordAudio(f Format, levels ...int) []byte {
+	var samples []float64
+	for _, level := range levels {
+		for i := 0; i < f.SampleRate/4*f.Channels; i++ {
+			samples = append(samples, float64(level)/100)
+		}
+	}
+	return EncodeSamples(samples, f)
+}
+
+// recognizeWords transcribes wordAudio, a level lasting at least 100 samples is a word and
+// silence is skipped.
+func recognizeWords(f Format, pcm []byte) string {
+	var words []string
+	level, run := 0, 0
+	flush := func() {
+		if run >= 100 && level != 0 {
+			words = append(words, fmt.Sprintf("w%d", level))
+		}
+	}
+	for _, s := range DecodeSamples(pcm, f) {
+		l := int(math.Round(s * 100))
+		if l != level {
+			flush()
+			level, run = l, 0
+		}
+		run++
+	}
+	flush()
+	return strings.Join(words, " ")
+}
+
+type mockTranscriptionBackend struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+}
+
+func (m *mockTranscriptionBackend) Transcribe(ctx context.Context, f Format, pcm []byte) (string, error) {
+	m.mu.Lock()
+	m.calls++
+	fail := m.failures > 0
+	m.failures--
+	m.mu.Unlock()
+	if fail {
+		return "", errors.New("server error")
+	}
+	return recognizeWords(f, pcm), nil
+}
+
+func TestTranscribe(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	var levels []int
+	var words []string
+	for i := 1; i <= 32; i++ {
+		levels = append(levels, i)
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+
+	t.Run("fixed windows", func(t *testing.T) {
+		f := Format{SampleRate: 24000, Channels: 2, BitDepth: 16}
+		wav, err := EncodeWAV(f, wordAudio(f, levels...))
+		as.Nil(err)
+		backend := &mockTranscriptionBackend{failures: 1}
+		var progress []int
+		resp, err := Transcribe(ctx, backend, &TranscribeReq{
+			Audio:         bytes.NewReader(wav),
+			ChunkDuration: 3 * time.Second,
+			RetryDelay:    time.Millisecond,
+			Concurrency:   1,
+			OnProgress:    func(done, total int) { progress = append(progress, done*10+total) },
+		})
+		as.Nil(err)
+		as.Equal(strings.Join(words, " "), resp.Text)
+		as.Equal(8*time.Second, resp.Duration)
+		as.Equal([]int{14, 24, 34, 44}, progress)
+		as.Equal(5, backend.calls)
+		as.Len(resp.Segments, 4)
+		as.Equal(&TranscriptSegment{Start: 0, End: 3 * time.Second, Text: strings.Join(words[:12], " ")}, resp.Segments[0])
+		as.Equal(&TranscriptSegment{Start: 3 * time.Second, End: 5 * time.Second, Text: strings.Join(words[12:20], " ")}, resp.Segments[1])
+		as.Equal(7*time.Second, resp.Segments[3].Start)
+		as.Equal(8*time.Second, resp.Segments[3].End)
+	})
+
+	t.Run("silence", func(t *testing.T) {
+		f := TranscriptionFormat
+		// a pause from 2.5s to 3s
+		audio := wordAudio(f, append(append(append([]int{}, levels[:10]...), 0, 0), levels[10:20]...)...)
+		resp, err := Transcribe(ctx, &mockTranscriptionBackend{}, &TranscribeReq{
+			Audio:          bytes.NewReader(audio),
+			Format:         f,
+			ChunkDuration:  3 * time.Second,
+			SplitOnSilence: true,
+		})
+		as.Nil(err)
+		as.Equal(strings.Join(words[:20], " "), resp.Text)
+		as.Len(resp.Segments, 2)
+		as.Equal(2520*time.Millisecond, resp.Segments[0].End)
+		as.Equal(2520*time.Millisecond, resp.Segments[1].Start)
+		as.Equal(strings.Join(words[10:20], " "), resp.Segments[1].Text)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		f := TranscriptionFormat
+		backend := &mockTranscriptionBackend{failures: 100}
+		_, err := Transcribe(ctx, backend, &TranscribeReq{
+			Audio:      bytes.NewReader(wordAudio(f, levels...)),
+			Format:     f,
+			MaxRetries: 1,
+			RetryDelay: time.Millisecond,
+		})
+		as.NotNil(err)
+		as.Contains(err.Error(), "server error")
+		as.Equal(2, backend.calls)
+
+		_, err = Transcribe(ctx, backend, &TranscribeReq{Audio: bytes.NewReader(nil)})
+		as.NotNil(err)
+	})
+
+	t.Run("remove overlap", func(t *testing.T) {
+		as.Equal("here today", removeOverlap("I said we were", "said we were here today"))
+		as.Equal("the end", removeOverlap("of the", "the end"))
+		as.Equal("天气很好", removeOverlap("今天的", "今天的天气很好"))
+		as.Equal("你好。世界a b", joinTexts([]string{"你好。", "世界", "a", "b"}))
+	})
+}
+
+type mockTranscriptions struct {
+	req *coze.AudioSpeechTranscriptionsReq
+	wav []byte
+}
+
+func (m *mockTranscriptions) Create(ctx context.Context, req *coze.AudioSpeechTranscriptionsReq, options ...coze.CozeAPIOption) (*coze.CreateAudioTranscriptionsResp, error) {
+	m.req = req
+	m.wav, _ = io.ReadAll(req.Audio)
+	return &coze.CreateAudioTranscriptionsResp{Data: coze.AudioTranscriptionsData{Text: "hello"}}, nil
+}
+
+func TestTranscriptionBackend(t *testing.T) {
+	as := assert.New(t)
+	f := TranscriptionFormat
+	pcm := wordAudio(f, 1, 2)
+
+	t.Run("rest", func(t *testing.T) {
+		transcriptions := &mockTranscriptions{}
+		text, err := NewTranscriptionBackend(transcriptions).Transcribe(context.Background(), f, pcm)
+		as.Nil(err)
+		as.Equal("hello", text)
+		as.Equal("audio.wav", transcriptions.req.Filename)
+		format, data, err := ReadWAV(bytes.NewReader(transcriptions.wav))
+		as.Nil(err)
+		as.Equal(f, format)
+		as.Equal(pcm, data)
+	})
+
+	t.Run("websocket", func(t *testing.T) {
+		var mu sync.Mutex
+		var received bytes.Buffer
+		var events []string
+		upgrader := websocket.Upgrader{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				event := struct {
+					EventType string `json:"event_type"`
+					Data      struct {
+						Delta []byte `json:"delta"`
+					} `json:"data"`
+				}{}
+				_ = json.Unmarshal(message, &event)
+				mu.Lock()
+				events = append(events, event.EventType)
+				received.Write(event.Data.Delta)
+				text := recognizeWords(f, received.Bytes())
+				mu.Unlock()
+				if event.EventType == "input_audio_buffer.complete" {
+					_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"event_type":"transcriptions.message.update","data":{"content":"`+text+`"}}`))
+					_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"event_type":"transcriptions.message.completed"}`))
+				}
+			}
+		}))
+		defer server.Close()
+
+		client := coze.NewCozeAPI(coze.NewTokenAuth("token"), coze.WithBaseURL(server.URL))
+		backend := NewWebSocketTranscriptionBackend(client.WebSockets.Audio.Transcriptions)
+		text, err := backend.Transcribe(context.Background(), f, pcm)
+		as.Nil(err)
+		as.Equal("w1 w2", text)
+		mu.Lock()
+		defer mu.Unlock()
+		as.Equal(pcm, received.Bytes())
+		as.Equal("transcriptions.update", events[0])
+		as.Equal("input_audio_buffer.complete", events[len(events)-1])
+	})
+}
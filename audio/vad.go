@@ -0,0 +1,296 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// VADConfig configures the voice activity detection. The durations mirror
+// coze.WebSocketTurnDetection.
+type VADConfig struct {
+	// The format of the analysed audio.
+	Format Format
+
+	// The duration of an analysis frame, default is 20ms.
+	FrameDuration time.Duration
+
+	// The RMS level in dBFS above which a frame may be speech, default is -40.
+	EnergyThreshold float64
+
+	// The zero crossing rate, in crossings per sample, above which a loud frame is treated as
+	// noise rather than speech, default is 0.35.
+	MaxZeroCrossingRate float64
+
+	// The continuous speech needed before speech starts, default is 100ms.
+	MinSpeechDuration time.Duration
+
+	// The audio before the detected speech start which is included in the speech, default is 600ms.
+	PrefixPadding time.Duration
+
+	// The silence needed to end the speech, default is 500ms.
+	SilenceDuration time.Duration
+}
+
+// VADConfigFromTurnDetection returns the config of the turn detection, for audio in the format.
+func VADConfigFromTurnDetection(td *coze.WebSocketTurnDetection, f Format) VADConfig {
+	cfg := VADConfig{Format: f}
+	if td != nil && td.PrefixPaddingMS != nil {
+		cfg.PrefixPadding = time.Duration(*td.PrefixPaddingMS) * time.Millisecond
+	}
+	if td != nil && td.SilenceDurationMS != nil {
+		cfg.SilenceDuration = time.Duration(*td.SilenceDurationMS) * time.Millisecond
+	}
+	return cfg
+}
+
+// VADEventType is the type of a VADEvent.
+type VADEventType string
+
+const (
+	VADEventSpeechStart VADEventType = "speech_start"
+	VADEventAudio       VADEventType = "audio"
+	VADEventSpeechEnd   VADEventType = "speech_end"
+)
+
+// VADEvent is emitted by VAD.Process in stream order. Audio events carry the speech audio,
+// starting with the prefix padding and ending with the trailing silence.
+type VADEvent struct {
+	Type VADEventType
+	// The position in the stream, the speech start is the first speech frame.
+	At    time.Duration
+	Audio []byte
+}
+
+// VAD is an energy and zero crossing voice activity detector.
+type VAD struct {
+	cfg       VADConfig
+	frameSize int
+
+	partial  []byte
+	frames   int64
+	speaking bool
+	run      int // consecutive frames of the other state
+	prefix   [][]byte
+}
+
+// NewVAD creates a detector, unset fields of cfg use the defaults.
+func NewVAD(cfg VADConfig) (*VAD, error) {
+	if err := cfg.Format.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.FrameDuration <= 0 {
+		cfg.FrameDuration = 20 * time.Millisecond
+	}
+	if cfg.EnergyThreshold == 0 {
+		cfg.EnergyThreshold = -40
+	}
+	if cfg.MaxZeroCrossingRate <= 0 {
+		cfg.MaxZeroCrossingRate = 0.35
+	}
+	if cfg.MinSpeechDuration <= 0 {
+		cfg.MinSpeechDuration = 100 * time.Millisecond
+	}
+	if cfg.PrefixPadding <= 0 {
+		cfg.PrefixPadding = 600 * time.Millisecond
+	}
+	if cfg.SilenceDuration <= 0 {
+		cfg.SilenceDuration = 500 * time.Millisecond
+	}
+	frameSize := cfg.Format.Bytes(cfg.FrameDuration)
+	if frameSize <= 0 {
+		return nil, errors.New("frame duration is too short")
+	}
+	return &VAD{cfg: cfg, frameSize: frameSize}, nil
+}
+
+// Speaking returns whether the speech has started and not ended.
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+// Process analyses a chunk of audio and emits the events, a trailing partial frame is kept for
+// the next chunk.
+func (v *VAD) Process(pcm []byte, emit func(event *VADEvent)) {
+	if len(v.partial) > 0 {
+		pcm = append(v.partial, pcm...)
+		v.partial = nil
+	}
+	for len(pcm) >= v.frameSize {
+		v.processFrame(pcm[:v.frameSize:v.frameSize], emit)
+		pcm = pcm[v.frameSize:]
+	}
+	if len(pcm) > 0 {
+		v.partial = append([]byte(nil), pcm...)
+	}
+}
+
+// Flush ends the speech at the end of the stream.
+func (v *VAD) Flush(emit func(event *VADEvent)) {
+	if v.speaking {
+		if len(v.partial) > 0 {
+			emit(&VADEvent{Type: VADEventAudio, At: v.position(), Audio: v.partial})
+		}
+		v.speaking = false
+		emit(&VADEvent{Type: VADEventSpeechEnd, At: v.position()})
+	}
+	v.partial, v.prefix, v.run = nil, nil, 0
+}
+
+func (v *VAD) processFrame(frame []byte, emit func(event *VADEvent)) {
+	speech := v.isSpeech(frame)
+	v.frames++
+	if !v.speaking {
+		// the frame may point into a buffer which the caller reuses
+		v.prefix = append(v.prefix, append([]byte(nil), frame...))
+		if limit := int((v.cfg.PrefixPadding+v.cfg.MinSpeechDuration)/v.cfg.FrameDuration) + 1; len(v.prefix) > limit {
+			v.prefix = v.prefix[len(v.prefix)-limit:]
+		}
+		if !speech {
+			v.run = 0
+			return
+		}
+		v.run++
+		if time.Duration(v.run)*v.cfg.FrameDuration < v.cfg.MinSpeechDuration {
+			return
+		}
+		start := v.position() - time.Duration(v.run)*v.cfg.FrameDuration
+		v.speaking, v.run = true, 0
+		emit(&VADEvent{Type: VADEventSpeechStart, At: start})
+		var audio []byte
+		for _, f := range v.prefix {
+			audio = append(audio, f...)
+		}
+		v.prefix = nil
+		emit(&VADEvent{Type: VADEventAudio, At: v.position(), Audio: audio})
+		return
+	}
+
+	emit(&VADEvent{Type: VADEventAudio, At: v.position(), Audio: append([]byte(nil), frame...)})
+	if speech {
+		v.run = 0
+		return
+	}
+	v.run++
+	if time.Duration(v.run)*v.cfg.FrameDuration >= v.cfg.SilenceDuration {
+		v.speaking, v.run = false, 0
+		emit(&VADEvent{Type: VADEventSpeechEnd, At: v.position()})
+	}
+}
+
+func (v *VAD) position() time.Duration {
+	return time.Duration(v.frames) * v.cfg.FrameDuration
+}
+
+func (v *VAD) isSpeech(frame []byte) bool {
+	samples := Remix(DecodeSamples(frame, v.cfg.Format), v.cfg.Format.Channels, 1)
+	if len(samples) == 0 {
+		return false
+	}
+	var energy float64
+	crossings := 0
+	for i, s := range samples {
+		energy += s * s
+		if i > 0 && (s >= 0) != (samples[i-1] >= 0) {
+			crossings++
+		}
+	}
+	rms := math.Sqrt(energy / float64(len(samples)))
+	if rms == 0 || 20*math.Log10(rms) < v.cfg.EnergyThreshold {
+		return false
+	}
+	return float64(crossings)/float64(len(samples)) <= v.cfg.MaxZeroCrossingRate
+}
+
+// ChatTurnSender is implemented by coze.WebSocketChat.
+type ChatTurnSender interface {
+	InputAudioSender
+	ConversationChatCancel(data *coze.WebSocketConversationChatCancelEventData) error
+}
+
+var _ ChatTurnSender = (*coze.WebSocketChat)(nil)
+
+// PlaybackState reports whether an answer is being played, it is implemented by Player.
+type PlaybackState interface {
+	Playing() (string, time.Duration, bool)
+}
+
+var _ PlaybackState = (*Player)(nil)
+
+// VADDriver drives a WebSocketChat in TurnDetectionTypeClientInterrupt mode. Microphone audio is
+// written to it, only the speech is appended to the input audio buffer, InputAudioBufferComplete is
+// sent when the speech ends and ConversationChatCancel when the speech starts while the playback
+// plays an answer.
+type VADDriver struct {
+	chat     ChatTurnSender
+	playback PlaybackState
+	vad      *VAD
+
+	// Called when the speech starts and ends, from the goroutine calling Write.
+	OnSpeechStart func(at time.Duration)
+	OnSpeechEnd   func(at time.Duration)
+}
+
+// NewVADDriver creates a driver, the chat input audio must be cfg.Format.InputAudio(). playback is
+// usually the Player of the answers, nil disables the barge-in.
+func NewVADDriver(chat ChatTurnSender, playback PlaybackState, cfg VADConfig) (*VADDriver, error) {
+	vad, err := NewVAD(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &VADDriver{chat: chat, playback: playback, vad: vad}, nil
+}
+
+// Write processes microphone audio.
+func (d *VADDriver) Write(pcm []byte) (int, error) {
+	if err := d.process(func(emit func(*VADEvent)) { d.vad.Process(pcm, emit) }); err != nil {
+		return 0, err
+	}
+	return len(pcm), nil
+}
+
+// Close ends the speech in progress.
+func (d *VADDriver) Close() error {
+	return d.process(d.vad.Flush)
+}
+
+func (d *VADDriver) process(run func(emit func(*VADEvent))) error {
+	var err error
+	var audio []byte
+	send := func() {
+		if len(audio) > 0 && err == nil {
+			err = d.chat.InputAudioBufferAppend(&coze.WebSocketInputAudioBufferAppendEventData{Delta: audio})
+		}
+		audio = nil
+	}
+	run(func(event *VADEvent) {
+		if err != nil {
+			return
+		}
+		switch event.Type {
+		case VADEventSpeechStart:
+			if d.playback != nil {
+				if _, _, playing := d.playback.Playing(); playing {
+					err = d.chat.ConversationChatCancel(nil)
+				}
+			}
+			if d.OnSpeechStart != nil {
+				d.OnSpeechStart(event.At)
+			}
+		case VADEventAudio:
+			audio = append(audio, event.Audio...)
+		case VADEventSpeechEnd:
+			send()
+			if err == nil {
+				err = d.chat.InputAudioBufferComplete(nil)
+			}
+			if d.OnSpeechEnd != nil {
+				d.OnSpeechEnd(event.At)
+			}
+		}
+	})
+	send()
+	return err
+}
@@ -0,0 +1,178 @@
+package audio
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockChat struct {
+	mockSender
+	cancels int
+}
+
+func (m *mockChat) ConversationChatCancel(data *coze.WebSocketConversationChatCancelEventData) error {
+	m.cancels++
+	return nil
+}
+
+type mockPlayback struct {
+	playing bool
+}
+
+func (m *mockPlayback) Playing() (string, time.Duration, bool) {
+	return "a", 0, m.playing
+}
+
+func vadSignal(f Format, parts ...func(i int) float64) []byte {
+	var samples []float64
+	for _, part := range parts {
+		for i := 0; i < f.SampleRate/2; i++ {
+			samples = append(samples, part(i))
+		}
+	}
+	return EncodeSamples(samples, f)
+}
+
+func TestVAD(t *testing.T) {
+	as := assert.New(t)
+	f := Format{SampleRate: 16000, Channels: 1, BitDepth: 16}
+	silence := func(i int) float64 { return 0.001 * math.Sin(float64(i)) }
+	tone := func(i int) float64 { return 0.3 * math.Sin(2*math.Pi*300*float64(i)/16000) }
+	hiss := func(i int) float64 { return 0.3 * float64(i%2*2-1) }
+
+	t.Run("events", func(t *testing.T) {
+		vad, err := NewVAD(VADConfigFromTurnDetection(&coze.WebSocketTurnDetection{
+			PrefixPaddingMS:   ptr(int64(200)),
+			SilenceDurationMS: ptr(int64(300)),
+		}, f))
+		as.Nil(err)
+
+		var events []*VADEvent
+		audio := 0
+		emit := func(e *VADEvent) {
+			if e.Type == VADEventAudio {
+				audio += len(e.Audio)
+				return
+			}
+			events = append(events, e)
+		}
+		pcm := vadSignal(f, silence, silence, hiss, tone, silence, silence)
+		for i := 0; i < len(pcm); i += 1234 {
+			end := i + 1234
+			if end > len(pcm) {
+				end = len(pcm)
+			}
+			vad.Process(pcm[i:end], emit)
+		}
+		vad.Flush(emit)
+
+		as.Len(events, 2)
+		as.Equal(VADEventSpeechStart, events[0].Type)
+		as.Equal(1500*time.Millisecond, events[0].At)
+		as.Equal(VADEventSpeechEnd, events[1].Type)
+		as.Equal(2300*time.Millisecond, events[1].At)
+		// 320ms of prefix padding and detection, then the audio until the speech end
+		as.Equal(f.Bytes(320*time.Millisecond+700*time.Millisecond), audio)
+	})
+
+	t.Run("reused buffer", func(t *testing.T) {
+		pcm := vadSignal(f, silence, silence, tone, silence)
+		detect := func(reuse bool) []byte {
+			vad, err := NewVAD(VADConfig{Format: f})
+			as.Nil(err)
+			var audio []byte
+			emit := func(e *VADEvent) { audio = append(audio, e.Audio...) }
+			buf := make([]byte, 1000)
+			for i := 0; i < len(pcm); i += len(buf) {
+				chunk := pcm[i:]
+				if len(chunk) > len(buf) {
+					chunk = chunk[:len(buf)]
+				}
+				if reuse {
+					chunk = buf[:copy(buf, chunk)]
+				}
+				vad.Process(chunk, emit)
+			}
+			vad.Flush(emit)
+			return audio
+		}
+		expected := detect(false)
+		as.NotEmpty(expected)
+		as.Equal(expected, detect(true))
+	})
+
+	t.Run("flush during speech", func(t *testing.T) {
+		vad, err := NewVAD(VADConfig{Format: f})
+		as.Nil(err)
+		var types []VADEventType
+		emit := func(e *VADEvent) { types = append(types, e.Type) }
+		vad.Process(vadSignal(f, tone), emit)
+		as.True(vad.Speaking())
+		vad.Flush(emit)
+		as.False(vad.Speaking())
+		as.Equal(VADEventSpeechStart, types[0])
+		as.Equal(VADEventSpeechEnd, types[len(types)-1])
+	})
+
+	t.Run("driver", func(t *testing.T) {
+		chat := &mockChat{}
+		playback := &mockPlayback{}
+		driver, err := NewVADDriver(chat, playback, VADConfig{Format: f, SilenceDuration: 200 * time.Millisecond})
+		as.Nil(err)
+		var started, ended []time.Duration
+		driver.OnSpeechStart = func(at time.Duration) { started = append(started, at) }
+		driver.OnSpeechEnd = func(at time.Duration) { ended = append(ended, at) }
+
+		_, err = driver.Write(vadSignal(f, silence))
+		as.Nil(err)
+		as.Empty(chat.deltas)
+
+		playback.playing = true
+		_, err = driver.Write(vadSignal(f, tone, silence))
+		as.Nil(err)
+		as.Equal(1, chat.cancels)
+		as.Equal(1, chat.completed)
+		as.NotEmpty(chat.deltas)
+
+		// the playback is still going, a second barge-in also cancels
+		_, err = driver.Write(vadSignal(f, tone, silence))
+		as.Nil(err)
+		as.Equal(2, chat.cancels)
+
+		playback.playing = false
+		_, err = driver.Write(vadSignal(f, tone))
+		as.Nil(err)
+		as.Nil(driver.Close())
+		as.Equal(2, chat.cancels)
+		as.Equal(3, chat.completed)
+		as.Equal([]time.Duration{500 * time.Millisecond, 1500 * time.Millisecond, 2500 * time.Millisecond}, started)
+		as.Len(ended, 3)
+	})
+
+	t.Run("driver with player", func(t *testing.T) {
+		chat := &mockChat{}
+		player, err := NewPlayer(&mockSink{}, DefaultFormat)
+		as.Nil(err)
+		driver, err := NewVADDriver(chat, player, VADConfig{Format: f})
+		as.Nil(err)
+		_, err = driver.Write(vadSignal(f, tone))
+		as.Nil(err)
+		as.Equal(0, chat.cancels)
+
+		started := make(chan string, 1)
+		player.OnStart = func(messageID string) { started <- messageID }
+		player.AudioDelta(audioDelta("a", "c1", make([]byte, DefaultFormat.Bytes(2*time.Second))))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go player.Run(ctx)
+		<-started
+		_, err = driver.Write(vadSignal(f, silence, tone))
+		as.Nil(err)
+		as.Equal(1, chat.cancels)
+	})
+}
@@ -0,0 +1,303 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	wavHeaderSize       = 44
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+
+	// the size written by writers which cannot seek back, readers treat it as unknown
+	wavUnknownSize = 0xFFFFFFFF
+)
+
+var errNotWAV = errors.New("not a wav file")
+
+// WAVReader reads the pcm data of a WAV file.
+type WAVReader struct {
+	reader    io.Reader
+	format    Format
+	remaining int64 // -1 if the data size is unknown
+}
+
+// NewWAVReader reads the WAV header from r, the returned reader reads the pcm data. Integer pcm of
+// any sample rate, channel count and bit depth is supported, including WAVE_FORMAT_EXTENSIBLE.
+func NewWAVReader(r io.Reader) (*WAVReader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("read wav header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errNotWAV
+	}
+
+	var format *Format
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("read wav chunk: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid fmt chunk size %d", size)
+			}
+			data := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, fmt.Errorf("read fmt chunk: %w", err)
+			}
+			f, err := parseWAVFormat(data[:size])
+			if err != nil {
+				return nil, err
+			}
+			format = f
+		case "data":
+			if format == nil {
+				return nil, errors.New("wav data chunk before fmt chunk")
+			}
+			if size == wavUnknownSize || size == 0 {
+				size = -1
+			}
+			return &WAVReader{reader: r, format: *format, remaining: size}, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("skip %q chunk: %w", id, err)
+			}
+		}
+	}
+}
+
+func parseWAVFormat(data []byte) (*Format, error) {
+	audioFormat := binary.LittleEndian.Uint16(data[0:2])
+	if audioFormat == wavFormatExtensible && len(data) >= 26 {
+		// the sub format GUID starts with the format code
+		audioFormat = binary.LittleEndian.Uint16(data[24:26])
+	}
+	if audioFormat != wavFormatPCM {
+		return nil, fmt.Errorf("unsupported wav format %d, only integer pcm is supported", audioFormat)
+	}
+	f := &Format{
+		Channels:   int(binary.LittleEndian.Uint16(data[2:4])),
+		SampleRate: int(binary.LittleEndian.Uint32(data[4:8])),
+		BitDepth:   int(binary.LittleEndian.Uint16(data[14:16])),
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Format returns the format of the pcm data.
+func (r *WAVReader) Format() Format {
+	return r.format
+}
+
+// Read reads the pcm data.
+func (r *WAVReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if r.remaining > 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+		if err == io.EOF && r.remaining > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+// ReadWAV reads a whole WAV file.
+func ReadWAV(r io.Reader) (Format, []byte, error) {
+	reader, err := NewWAVReader(r)
+	if err != nil {
+		return Format{}, nil, err
+	}
+	pcm, err := io.ReadAll(reader)
+	if err != nil {
+		return Format{}, nil, err
+	}
+	return reader.Format(), pcm, nil
+}
+
+// ReadWAVFile reads a whole WAV file from path.
+func ReadWAVFile(path string) (Format, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Format{}, nil, err
+	}
+	defer f.Close()
+	return ReadWAV(f)
+}
+
+// EncodeWAV returns the WAV file of the pcm data.
+func EncodeWAV(f Format, pcm []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := WriteWAV(buf, f, pcm); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteWAV writes the pcm data as a WAV file.
+func WriteWAV(w io.Writer, f Format, pcm []byte) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if _, err := w.Write(wavHeader(f, int64(len(pcm)))); err != nil {
+		return err
+	}
+	if _, err := w.Write(pcm); err != nil {
+		return err
+	}
+	if len(pcm)%2 == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// WriteWAVFile writes the pcm data as a WAV file to path.
+func WriteWAVFile(path string, f Format, pcm []byte) error {
+	w, err := CreateWAVFile(path, f)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(pcm); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// WAVWriter writes pcm data as a WAV file of unknown length. If the underlying writer is an
+// io.WriteSeeker, the sizes in the header are patched on Close, otherwise they are left as
+// 0xFFFFFFFF which most decoders read as "until the end of the stream".
+type WAVWriter struct {
+	writer io.Writer
+	closer io.Closer
+	format Format
+	size   int64
+	closed bool
+}
+
+// NewWAVWriter writes the header and returns a writer for the pcm data. Close does not close w.
+func NewWAVWriter(w io.Writer, f Format) (*WAVWriter, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(wavHeader(f, -1)); err != nil {
+		return nil, err
+	}
+	return &WAVWriter{writer: w, format: f}, nil
+}
+
+// CreateWAVFile creates the file at path, Close closes the file.
+func CreateWAVFile(path string, f Format) (*WAVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWAVWriter(file, f)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+// Format returns the format of the written data.
+func (w *WAVWriter) Format() Format {
+	return w.format
+}
+
+// Size returns the number of pcm bytes written.
+func (w *WAVWriter) Size() int64 {
+	return w.size
+}
+
+func (w *WAVWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("wav writer is closed")
+	}
+	n, err := w.writer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close pads the data to an even size and patches the header.
+func (w *WAVWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.finish()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (w *WAVWriter) finish() error {
+	if w.size%2 == 1 {
+		if _, err := w.writer.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	seeker, ok := w.writer.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	header := wavHeader(w.format, w.size)
+	if _, err := seeker.Seek(end-w.size-w.size%2-wavHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(header); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+// wavHeader returns the 44 byte header, size -1 means unknown.
+func wavHeader(f Format, size int64) []byte {
+	dataSize, riffSize := uint32(wavUnknownSize), uint32(wavUnknownSize)
+	if size >= 0 {
+		dataSize = uint32(size)
+		riffSize = uint32(size + size%2 + wavHeaderSize - 8)
+	}
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], riffSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], wavFormatPCM)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(f.Channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(f.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(f.ByteRate()))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(f.FrameSize()))
+	binary.LittleEndian.PutUint16(header[34:36], uint16(f.BitDepth))
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+	return header
+}
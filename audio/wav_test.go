@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAV(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("encode and read", func(t *testing.T) {
+		for _, f := range []Format{
+			{SampleRate: 8000, Channels: 1, BitDepth: 8},
+			{SampleRate: 24000, Channels: 1, BitDepth: 16},
+			{SampleRate: 44100, Channels: 2, BitDepth: 24},
+			{SampleRate: 48000, Channels: 6, BitDepth: 32},
+		} {
+			pcm := bytes.Repeat([]byte{1, 2, 3}, f.FrameSize()*7)
+			data, err := EncodeWAV(f, pcm)
+			as.Nil(err)
+			as.Equal(uint32(f.ByteRate()), binary.LittleEndian.Uint32(data[28:32]))
+
+			format, actual, err := ReadWAV(bytes.NewReader(data))
+			as.Nil(err, f.String())
+			as.Equal(f, format)
+			as.Equal(pcm, actual)
+		}
+	})
+
+	t.Run("testdata", func(t *testing.T) {
+		format, pcm, err := ReadWAVFile("../testdata/websocket_speech_success.wav")
+		as.Nil(err)
+		as.Equal(DefaultFormat, format)
+		as.NotEmpty(pcm)
+	})
+
+	t.Run("skip chunks and extensible", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+		buf.WriteString("LIST\x03\x00\x00\x00abc\x00")
+		fmtChunk := make([]byte, 40)
+		binary.LittleEndian.PutUint16(fmtChunk[0:2], wavFormatExtensible)
+		binary.LittleEndian.PutUint16(fmtChunk[2:4], 2)
+		binary.LittleEndian.PutUint32(fmtChunk[4:8], 16000)
+		binary.LittleEndian.PutUint16(fmtChunk[14:16], 16)
+		binary.LittleEndian.PutUint16(fmtChunk[24:26], wavFormatPCM)
+		buf.WriteString("fmt \x28\x00\x00\x00")
+		buf.Write(fmtChunk)
+		buf.WriteString("data\x04\x00\x00\x00\x01\x02\x03\x04trailing")
+
+		format, pcm, err := ReadWAV(buf)
+		as.Nil(err)
+		as.Equal(Format{SampleRate: 16000, Channels: 2, BitDepth: 16}, format)
+		as.Equal([]byte{1, 2, 3, 4}, pcm)
+
+		_, _, err = ReadWAV(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI LIST")))
+		as.NotNil(err)
+	})
+
+	t.Run("streaming writer", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a.wav")
+		f := FormatFromInputAudio(&coze.WebSocketInputAudio{SampleRate: ptr(16000)})
+		w, err := CreateWAVFile(path, f)
+		as.Nil(err)
+		_, err = w.Write([]byte{1, 2, 3})
+		as.Nil(err)
+		_, err = w.Write([]byte{4, 5})
+		as.Nil(err)
+		as.Nil(w.Close())
+
+		data, err := os.ReadFile(path)
+		as.Nil(err)
+		as.Len(data, 44+6)
+		as.Equal(uint32(5), binary.LittleEndian.Uint32(data[40:44]))
+		as.Equal(uint32(36+6), binary.LittleEndian.Uint32(data[4:8]))
+		format, pcm, err := ReadWAV(bytes.NewReader(data))
+		as.Nil(err)
+		as.Equal(16000, format.SampleRate)
+		as.Equal([]byte{1, 2, 3, 4, 5}, pcm)
+	})
+
+	t.Run("non seekable writer", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWAVWriter(buf, DefaultFormat)
+		as.Nil(err)
+		_, err = w.Write([]byte{1, 2, 3, 4})
+		as.Nil(err)
+		as.Nil(w.Close())
+		as.Equal(uint32(wavUnknownSize), binary.LittleEndian.Uint32(buf.Bytes()[40:44]))
+
+		_, pcm, err := ReadWAV(buf)
+		as.Nil(err)
+		as.Equal([]byte{1, 2, 3, 4}, pcm)
+	})
+}
@@ -7,11 +7,33 @@ import (
 	"os"
 )
 
-func (r *audioSpeech) Create(ctx context.Context, req *CreateAudioSpeechReq) (*CreateAudioSpeechResp, error) {
+func (r *audioSpeech) Create(ctx context.Context, req *CreateAudioSpeechReq, options ...CozeAPIOption) (*CreateAudioSpeechResp, error) {
+	if cache := r.cache(options); cache != nil {
+		return cache.create(ctx, r, req, options)
+	}
+	return r.create(ctx, req, options)
+}
+
+func (r *audioSpeech) cache(options []CozeAPIOption) *SpeechCache {
+	cache := r.core.speechCache
+	if len(options) > 0 {
+		opt := &clientOption{}
+		for _, o := range options {
+			o(opt)
+		}
+		if opt.speechCache != nil {
+			cache = opt.speechCache
+		}
+	}
+	return cache
+}
+
+func (r *audioSpeech) create(ctx context.Context, req *CreateAudioSpeechReq, options []CozeAPIOption) (*CreateAudioSpeechResp, error) {
 	request := &RawRequestReq{
-		Method: http.MethodPost,
-		URL:    "/v1/audio/speech",
-		Body:   req,
+		Method:  http.MethodPost,
+		URL:     "/v1/audio/speech",
+		Body:    req,
+		options: options,
 	}
 	response := new(createAudioSpeechResp)
 	err := r.core.rawRequest(ctx, request, response)
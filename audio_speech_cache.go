@@ -0,0 +1,333 @@
+package coze
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpeechCache lets Audio.Speech.Create return the audio of a text which was already synthesized
+// with the same voice settings. The entries are keyed by the text with its whitespace collapsed,
+// VoiceID, ResponseFormat, Speed, SampleRate, LoudnessRate, Emotion and EmotionScale.
+//
+// The cache is enabled by passing WithSpeechCache when creating the client or to a single request.
+// Audio.Speech.Warm synthesizes a list of phrases ahead of time. The audio of a WebSocketAudioSpeech
+// is cached with Load and Store under WebSocketSpeechCacheKey.
+type SpeechCache struct {
+	store SpeechCacheStore
+}
+
+// NewSpeechCache creates a speech cache
+func NewSpeechCache(store SpeechCacheStore) *SpeechCache {
+	return &SpeechCache{store: store}
+}
+
+// WithSpeechCache sets the cache used by Audio.Speech.Create
+func WithSpeechCache(cache *SpeechCache) CozeAPIOption {
+	return func(opt *clientOption) {
+		opt.speechCache = cache
+	}
+}
+
+// SpeechCacheStore stores the synthesized audio, Get returns nil when the key does not exist.
+type SpeechCacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// SpeechCacheKey returns the cache key of the audio synthesized by req.
+func SpeechCacheKey(req *CreateAudioSpeechReq) string {
+	return hashSpeechCacheKey(&CreateAudioSpeechReq{
+		Input:          normalizeSpeechText(req.Input),
+		VoiceID:        req.VoiceID,
+		ResponseFormat: req.ResponseFormat,
+		Speed:          req.Speed,
+		SampleRate:     req.SampleRate,
+		LoudnessRate:   req.LoudnessRate,
+		Emotion:        req.Emotion,
+		EmotionScale:   req.EmotionScale,
+	})
+}
+
+// WebSocketSpeechCacheKey returns the cache key of the audio of text synthesized by a
+// WebSocketAudioSpeech with the output audio of its SpeechUpdate, nil for the default output.
+func WebSocketSpeechCacheKey(text string, output *WebSocketOutputAudio) string {
+	key := struct {
+		Source string                `json:"source"`
+		Input  string                `json:"input"`
+		Output *WebSocketOutputAudio `json:"output"`
+	}{Source: "websocket", Input: normalizeSpeechText(text), Output: output}
+	return hashSpeechCacheKey(key)
+}
+
+func hashSpeechCacheKey(v interface{}) string {
+	// the fields are marshalled in a fixed order, so equal settings have equal keys
+	data, _ := json.Marshal(v)
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// normalizeSpeechText trims the text and collapses its whitespace, which does not change the
+// speech.
+func normalizeSpeechText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Load returns the cached audio of key, or nil. The audio is shared and must not be modified.
+func (c *SpeechCache) Load(ctx context.Context, key string) ([]byte, error) {
+	return c.store.Get(ctx, key)
+}
+
+// Store caches the audio of key, empty audio is not cached.
+func (c *SpeechCache) Store(ctx context.Context, key string, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return c.store.Set(ctx, key, data)
+}
+
+func (c *SpeechCache) create(ctx context.Context, speech *audioSpeech, req *CreateAudioSpeechReq, options []CozeAPIOption) (*CreateAudioSpeechResp, error) {
+	key := SpeechCacheKey(req)
+	data, err := c.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		resp := &CreateAudioSpeechResp{Data: io.NopCloser(bytes.NewReader(data))}
+		resp.setHTTPResponse(newHTTPResponse(nil))
+		return resp, nil
+	}
+
+	resp, err := speech.create(ctx, req, options)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Data.Close()
+	data, err = io.ReadAll(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data = io.NopCloser(bytes.NewReader(data))
+	// the audio is good even if it cannot be cached
+	if err := c.Store(ctx, key, data); err != nil {
+		logger.Warnf(ctx, "store speech cache failed, err=%s", err)
+	}
+	return resp, nil
+}
+
+// NewMemorySpeechCacheStore creates a store that keeps the audio in memory. The least recently used
+// entries are evicted when the audio exceeds maxBytes, 0 means no limit.
+func NewMemorySpeechCacheStore(maxBytes int64) SpeechCacheStore {
+	return &memorySpeechCacheStore{maxBytes: maxBytes, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// NewDirSpeechCacheStore creates a store that keeps one file per entry in dir, so the cache can be
+// shared by processes and survives restarts. The least recently used files are removed when the
+// audio exceeds maxBytes, 0 means no limit.
+func NewDirSpeechCacheStore(dir string, maxBytes int64) (SpeechCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirSpeechCacheStore{dir: dir, maxBytes: maxBytes}, nil
+}
+
+type memorySpeechCacheEntry struct {
+	key  string
+	data []byte
+}
+
+type memorySpeechCacheStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// the most recently used entry is at the front
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func (s *memorySpeechCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*memorySpeechCacheEntry).data, nil
+}
+
+func (s *memorySpeechCacheStore) Set(ctx context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if s.maxBytes > 0 && int64(len(data)) > s.maxBytes {
+		return nil
+	}
+	// the caller may reuse data
+	data = append([]byte(nil), data...)
+	s.entries[key] = s.order.PushFront(&memorySpeechCacheEntry{key: key, data: data})
+	s.size += int64(len(data))
+	for s.maxBytes > 0 && s.size > s.maxBytes {
+		s.remove(s.order.Back().Value.(*memorySpeechCacheEntry).key)
+	}
+	return nil
+}
+
+func (s *memorySpeechCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	return nil
+}
+
+func (s *memorySpeechCacheStore) remove(key string) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.order.Remove(elem)
+	delete(s.entries, key)
+	s.size -= int64(len(elem.Value.(*memorySpeechCacheEntry).data))
+}
+
+type dirSpeechCacheStore struct {
+	dir      string
+	maxBytes int64
+	// serializes the evictions of this process
+	mu sync.Mutex
+}
+
+func (s *dirSpeechCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path := s.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// the modification time orders the evictions
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, nil
+}
+
+func (s *dirSpeechCacheStore) Set(ctx context.Context, key string, data []byte) error {
+	if s.maxBytes > 0 && int64(len(data)) > s.maxBytes {
+		return nil
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if s.maxBytes > 0 {
+		return s.evict(key)
+	}
+	return nil
+}
+
+func (s *dirSpeechCacheStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// evict removes the least recently used files until the audio fits in maxBytes, keeping the file
+// of key which was just written.
+func (s *dirSpeechCacheStore) evict(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var files []os.FileInfo
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".audio") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed by another process
+			continue
+		}
+		files = append(files, info)
+		size += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	kept := filepath.Base(s.path(key))
+	for _, info := range files {
+		if size <= s.maxBytes {
+			break
+		}
+		if info.Name() == kept {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		size -= info.Size()
+	}
+	return nil
+}
+
+func (s *dirSpeechCacheStore) path(key string) string {
+	return filepath.Join(s.dir, strings.ReplaceAll(key, ":", "-")+".audio")
+}
+
+// Warm synthesizes the phrases which are not cached yet with the settings of req, so later Create
+// requests of the phrases are served by the cache. The cache is set on the client or by
+// WithSpeechCache in options.
+func (r *audioSpeech) Warm(ctx context.Context, req *CreateAudioSpeechReq, phrases []string, options ...CozeAPIOption) error {
+	cache := r.cache(options)
+	if cache == nil {
+		return errors.New("speech cache is not set")
+	}
+	for _, phrase := range phrases {
+		if normalizeSpeechText(phrase) == "" {
+			continue
+		}
+		phraseReq := *req
+		phraseReq.Input = phrase
+		data, err := cache.Load(ctx, SpeechCacheKey(&phraseReq))
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			continue
+		}
+		resp, err := cache.create(ctx, r, &phraseReq, options)
+		if err != nil {
+			return fmt.Errorf("warm %q: %w", phrase, err)
+		}
+		resp.Data.Close()
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingSpeechCacheStore struct{}
+
+func (s *failingSpeechCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *failingSpeechCacheStore) Set(ctx context.Context, key string, data []byte) error {
+	return errors.New("disk full")
+}
+
+func (s *failingSpeechCacheStore) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func TestSpeechCache(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+
+	newServer := func(requests *int) *audioSpeech {
+		return newAudioSpeech(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			*requests++
+			body := &CreateAudioSpeechReq{}
+			if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+				return nil, err
+			}
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("audio of " + body.Input)),
+			}
+			resp.Header.Set(httpLogIDKey, "test_log_id")
+			return resp, nil
+		})))
+	}
+	read := func(resp *CreateAudioSpeechResp, err error) string {
+		as.Nil(err)
+		data, err := io.ReadAll(resp.Data)
+		as.Nil(err)
+		as.Nil(resp.Data.Close())
+		return string(data)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		var requests int
+		speech := newServer(&requests)
+		cache := WithSpeechCache(NewSpeechCache(NewMemorySpeechCacheStore(0)))
+		req := &CreateAudioSpeechReq{Input: "Please hold.", VoiceID: "voice", Speed: ptr[float32](1.2)}
+
+		as.Equal("audio of Please hold.", read(speech.Create(ctx, req, cache)))
+		as.Equal("audio of Please hold.", read(speech.Create(ctx, &CreateAudioSpeechReq{Input: "  Please \n hold. ", VoiceID: "voice", Speed: ptr[float32](1.2)}, cache)))
+		as.Equal(1, requests)
+
+		resp, err := speech.Create(ctx, req, cache)
+		as.Nil(err)
+		as.Empty(resp.Response().LogID())
+
+		// any setting changes the key
+		as.Equal("audio of Please hold.", read(speech.Create(ctx, &CreateAudioSpeechReq{Input: "Please hold.", VoiceID: "voice", Speed: ptr[float32](1.5)}, cache)))
+		as.Equal("audio of Please hold.", read(speech.Create(ctx, &CreateAudioSpeechReq{Input: "Please hold.", VoiceID: "voice", Speed: ptr[float32](1.2), Emotion: ptr("happy")}, cache)))
+		as.Equal(3, requests)
+
+		// without the cache
+		as.Equal("audio of Please hold.", read(speech.Create(ctx, req)))
+		as.Equal(4, requests)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		var requests int
+		speech := newServer(&requests)
+		cache := WithSpeechCache(NewSpeechCache(&failingSpeechCacheStore{}))
+		// the synthesized audio is returned although it cannot be cached
+		as.Equal("audio of Hello.", read(speech.Create(ctx, &CreateAudioSpeechReq{Input: "Hello."}, cache)))
+		as.Nil(speech.Warm(ctx, &CreateAudioSpeechReq{}, []string{"Hello."}, cache))
+		as.Equal(2, requests)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		req := &CreateAudioSpeechReq{Input: "hi", VoiceID: "v", ResponseFormat: AudioFormatWAV.Ptr(), SampleRate: ptr(16000)}
+		as.Equal(SpeechCacheKey(req), SpeechCacheKey(&CreateAudioSpeechReq{Input: " hi\t", VoiceID: "v", ResponseFormat: AudioFormatWAV.Ptr(), SampleRate: ptr(16000)}))
+		as.NotEqual(SpeechCacheKey(req), SpeechCacheKey(&CreateAudioSpeechReq{Input: "hi", VoiceID: "v", ResponseFormat: AudioFormatPCM.Ptr(), SampleRate: ptr(16000)}))
+		as.NotEqual(SpeechCacheKey(req), SpeechCacheKey(&CreateAudioSpeechReq{Input: "hi", VoiceID: "v", ResponseFormat: AudioFormatWAV.Ptr(), SampleRate: ptr(16000), LoudnessRate: ptr(10)}))
+		as.True(strings.HasPrefix(SpeechCacheKey(req), "sha256:"))
+
+		output := &WebSocketOutputAudio{Codec: ptr("pcm"), VoiceID: ptr("v")}
+		as.Equal(WebSocketSpeechCacheKey("hi ", output), WebSocketSpeechCacheKey("hi", &WebSocketOutputAudio{Codec: ptr("pcm"), VoiceID: ptr("v")}))
+		as.NotEqual(WebSocketSpeechCacheKey("hi", output), WebSocketSpeechCacheKey("hi", nil))
+		as.NotEqual(WebSocketSpeechCacheKey("hi", nil), SpeechCacheKey(&CreateAudioSpeechReq{Input: "hi"}))
+
+		cache := NewSpeechCache(NewMemorySpeechCacheStore(0))
+		key := WebSocketSpeechCacheKey("hi", output)
+		data, err := cache.Load(ctx, key)
+		as.Nil(err)
+		as.Nil(data)
+		as.Nil(cache.Store(ctx, key, []byte("pcm")))
+		data, err = cache.Load(ctx, key)
+		as.Nil(err)
+		as.Equal("pcm", string(data))
+	})
+
+	t.Run("warm", func(t *testing.T) {
+		var requests int
+		speech := newServer(&requests)
+		speech.core.speechCache = NewSpeechCache(NewMemorySpeechCacheStore(0))
+		req := &CreateAudioSpeechReq{VoiceID: "voice"}
+		as.Nil(speech.Warm(ctx, req, []string{"Hello.", "Please hold.", " ", "Hello."}))
+		as.Equal(2, requests)
+		as.Empty(req.Input)
+
+		as.Equal("audio of Hello.", read(speech.Create(ctx, &CreateAudioSpeechReq{Input: "Hello.", VoiceID: "voice"})))
+		as.Equal(2, requests)
+
+		as.NotNil(newServer(&requests).Warm(ctx, req, []string{"Hello."}))
+	})
+
+	t.Run("memory lru", func(t *testing.T) {
+		store := NewMemorySpeechCacheStore(10)
+		as.Nil(store.Set(ctx, "a", []byte("aaaa")))
+		as.Nil(store.Set(ctx, "b", []byte("bbbb")))
+		data, err := store.Get(ctx, "a")
+		as.Nil(err)
+		as.Equal("aaaa", string(data))
+		// b is the least recently used
+		as.Nil(store.Set(ctx, "c", []byte("cccc")))
+		data, _ = store.Get(ctx, "b")
+		as.Nil(data)
+		data, _ = store.Get(ctx, "a")
+		as.Equal("aaaa", string(data))
+
+		// replacing an entry updates the size
+		as.Nil(store.Set(ctx, "a", []byte("aa")))
+		as.Nil(store.Set(ctx, "d", []byte("dd")))
+		data, _ = store.Get(ctx, "c")
+		as.Equal("cccc", string(data))
+
+		// the stored audio is a copy
+		buf := []byte("ffff")
+		as.Nil(store.Set(ctx, "f", buf))
+		copy(buf, "xxxx")
+		data, _ = store.Get(ctx, "f")
+		as.Equal("ffff", string(data))
+
+		// larger than the limit
+		as.Nil(store.Set(ctx, "e", []byte(strings.Repeat("e", 11))))
+		data, _ = store.Get(ctx, "e")
+		as.Nil(data)
+
+		as.Nil(store.Delete(ctx, "a"))
+		data, _ = store.Get(ctx, "a")
+		as.Nil(data)
+	})
+
+	t.Run("dir store", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "speech")
+		store, err := NewDirSpeechCacheStore(dir, 10)
+		as.Nil(err)
+		as.Nil(store.Set(ctx, "sha256:a", []byte("aaaa")))
+		as.Nil(store.Set(ctx, "sha256:b", []byte("bbbb")))
+		old := time.Now().Add(-time.Hour)
+		as.Nil(os.Chtimes(filepath.Join(dir, "sha256-a.audio"), old, old))
+		as.Nil(os.Chtimes(filepath.Join(dir, "sha256-b.audio"), old.Add(-time.Minute), old.Add(-time.Minute)))
+
+		// reading a marks it as recently used
+		data, err := store.Get(ctx, "sha256:b")
+		as.Nil(err)
+		as.Equal("bbbb", string(data))
+
+		as.Nil(store.Set(ctx, "sha256:c", []byte("cccc")))
+		data, err = store.Get(ctx, "sha256:a")
+		as.Nil(err)
+		as.Nil(data)
+		data, _ = store.Get(ctx, "sha256:c")
+		as.Equal("cccc", string(data))
+		entries, err := os.ReadDir(dir)
+		as.Nil(err)
+		as.Len(entries, 2)
+
+		// shared by a second store on the same directory
+		other, err := NewDirSpeechCacheStore(dir, 0)
+		as.Nil(err)
+		data, _ = other.Get(ctx, "sha256:b")
+		as.Equal("bbbb", string(data))
+
+		as.Nil(store.Delete(ctx, "sha256:b"))
+		as.Nil(store.Delete(ctx, "sha256:b"))
+		data, _ = store.Get(ctx, "sha256:b")
+		as.Nil(data)
+	})
+}
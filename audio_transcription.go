@@ -6,12 +6,13 @@ import (
 	"net/http"
 )
 
-func (r *audioTranscriptions) Create(ctx context.Context, req *AudioSpeechTranscriptionsReq) (*CreateAudioTranscriptionsResp, error) {
+func (r *audioTranscriptions) Create(ctx context.Context, req *AudioSpeechTranscriptionsReq, options ...CozeAPIOption) (*CreateAudioTranscriptionsResp, error) {
 	request := &RawRequestReq{
-		Method: http.MethodPost,
-		URL:    "/v1/audio/transcriptions",
-		Body:   req,
-		IsFile: true,
+		Method:  http.MethodPost,
+		URL:     "/v1/audio/transcriptions",
+		Body:    req,
+		IsFile:  true,
+		options: options,
 	}
 	response := new(createAudioTranscriptionsResp)
 	err := r.core.rawRequest(ctx, request, response)
@@ -6,12 +6,13 @@ import (
 	"net/http"
 )
 
-func (r *audioVoices) Clone(ctx context.Context, req *CloneAudioVoicesReq) (*CloneAudioVoicesResp, error) {
+func (r *audioVoices) Clone(ctx context.Context, req *CloneAudioVoicesReq, options ...CozeAPIOption) (*CloneAudioVoicesResp, error) {
 	request := &RawRequestReq{
-		Method: http.MethodPost,
-		URL:    "/v1/audio/voices/clone",
-		Body:   req,
-		IsFile: true,
+		Method:  http.MethodPost,
+		URL:     "/v1/audio/voices/clone",
+		Body:    req,
+		IsFile:  true,
+		options: options,
 	}
 	response := new(cloneAudioVoicesResp)
 	err := r.core.rawRequest(ctx, request, response)
@@ -33,6 +33,9 @@ type clientOption struct {
 	auth        Auth
 	enableLogID bool
 	headers     http.Header
+	progress    ProgressFunc
+	fileCache   *FileCache
+	speechCache *SpeechCache
 }
 
 type CozeAPIOption func(*clientOption)
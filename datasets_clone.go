@@ -0,0 +1,385 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CloneDataset copies a dataset from the source client to the target client, such as from a staging
+// workspace to a production workspace, or from coze.cn to coze.com.
+//
+// The dataset name, description, format type and chunk strategy are kept. Web page documents are
+// re-created from their URL with the same update rules. The open API does not expose the content
+// of local file documents and images, they are copied only if DocumentSource or ImageSource is set,
+// and are reported as skipped otherwise.
+func CloneDataset(ctx context.Context, source, target *CozeAPI, req *CloneDatasetReq) (*CloneDatasetReport, error) {
+	if source == nil || target == nil {
+		return nil, errors.New("source and target clients are required")
+	}
+	dataset, err := findDataset(ctx, source.Datasets, req.SourceSpaceID, req.SourceDatasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CloneDatasetReport{
+		SourceDatasetID: dataset.ID,
+		TargetDatasetID: req.TargetDatasetID,
+		Name:            dataset.Name,
+		FormatType:      dataset.FormatType,
+	}
+	if req.Name != "" {
+		report.Name = req.Name
+	}
+	if report.TargetDatasetID == "" {
+		created, err := target.Datasets.Create(ctx, &CreateDatasetsReq{
+			Name:        report.Name,
+			SpaceID:     req.TargetSpaceID,
+			FormatType:  dataset.FormatType,
+			Description: dataset.Description,
+		})
+		if err != nil {
+			return report, fmt.Errorf("create target dataset failed: %w", err)
+		}
+		report.TargetDatasetID = created.DatasetID
+	}
+
+	cloner := &datasetCloner{source: source, target: target, req: req, dataset: dataset, report: report}
+	if dataset.FormatType == DocumentFormatTypeImage {
+		err = cloner.cloneImages(ctx)
+	} else {
+		err = cloner.cloneDocuments(ctx)
+	}
+	if err != nil {
+		return report, err
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return report, fmt.Errorf("%d items failed to clone, first error: %s", len(failed), failed[0].Error)
+	}
+	return report, nil
+}
+
+// CloneDatasetReq represents request for cloning a dataset
+type CloneDatasetReq struct {
+	// The space and ID of the dataset to clone, in the source client.
+	SourceSpaceID   string
+	SourceDatasetID string
+
+	// The space to create the dataset in, in the target client.
+	TargetSpaceID string
+
+	// Clone into an existing dataset instead of creating a new one.
+	TargetDatasetID string
+
+	// The name of the new dataset, default is the name of the source dataset.
+	Name string
+
+	// DocumentSource returns the document base used to re-create a local file document, for example
+	// read from a local copy of the file. Returning nil skips the document.
+	DocumentSource func(ctx context.Context, document *Document) (*DocumentBase, error)
+
+	// ImageSource returns the content of an image. Returning nil skips the image.
+	ImageSource func(ctx context.Context, image *Image) (FileTypes, error)
+
+	// Options for waiting the images to be processed before their captions are set.
+	WaitOptions []WaitForDocumentsOption
+}
+
+// CloneDatasetItemKind is the kind of a cloned item
+type CloneDatasetItemKind string
+
+const (
+	CloneDatasetItemKindDocument CloneDatasetItemKind = "document"
+	CloneDatasetItemKindImage    CloneDatasetItemKind = "image"
+)
+
+// CloneDatasetItem represents a document or an image in the clone report
+type CloneDatasetItem struct {
+	Kind     CloneDatasetItemKind `json:"kind"`
+	Name     string               `json:"name"`
+	SourceID string               `json:"source_id"`
+	TargetID string               `json:"target_id,omitempty"`
+	URL      string               `json:"url,omitempty"`
+	Skipped  string               `json:"skipped,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// CloneDatasetReport represents the result of CloneDataset
+type CloneDatasetReport struct {
+	SourceDatasetID string              `json:"source_dataset_id"`
+	TargetDatasetID string              `json:"target_dataset_id"`
+	Name            string              `json:"name"`
+	FormatType      DocumentFormatType  `json:"format_type"`
+	Items           []*CloneDatasetItem `json:"items"`
+}
+
+// Mapping returns the target ID of each cloned document or image, keyed by the source ID
+func (r *CloneDatasetReport) Mapping() map[string]string {
+	mapping := map[string]string{r.SourceDatasetID: r.TargetDatasetID}
+	for _, item := range r.Items {
+		if item.TargetID != "" {
+			mapping[item.SourceID] = item.TargetID
+		}
+	}
+	return mapping
+}
+
+// Failed returns the items which failed to clone
+func (r *CloneDatasetReport) Failed() []*CloneDatasetItem {
+	var failed []*CloneDatasetItem
+	for _, item := range r.Items {
+		if item.Error != "" {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// Skipped returns the items which are not cloned
+func (r *CloneDatasetReport) Skipped() []*CloneDatasetItem {
+	var skipped []*CloneDatasetItem
+	for _, item := range r.Items {
+		if item.Skipped != "" {
+			skipped = append(skipped, item)
+		}
+	}
+	return skipped
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *CloneDatasetReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func findDataset(ctx context.Context, datasets *datasets, spaceID, datasetID string) (*Dataset, error) {
+	paged, err := datasets.List(ctx, &ListDatasetsReq{SpaceID: spaceID, PageSize: 100})
+	if err != nil {
+		return nil, err
+	}
+	for paged.Next() {
+		if dataset := paged.Current(); dataset.ID == datasetID {
+			return dataset, nil
+		}
+	}
+	if paged.Err() != nil {
+		return nil, paged.Err()
+	}
+	return nil, fmt.Errorf("dataset %s not found in space %s", datasetID, spaceID)
+}
+
+type datasetCloner struct {
+	source  *CozeAPI
+	target  *CozeAPI
+	req     *CloneDatasetReq
+	dataset *Dataset
+	report  *CloneDatasetReport
+}
+
+func (c *datasetCloner) cloneDocuments(ctx context.Context) error {
+	sourceID, err := strconv.ParseInt(c.dataset.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dataset id %s: %w", c.dataset.ID, err)
+	}
+	targetID, err := strconv.ParseInt(c.report.TargetDatasetID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dataset id %s: %w", c.report.TargetDatasetID, err)
+	}
+	documents, err := c.source.Datasets.Documents.listAll(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	webPages, err := c.webPages(ctx, documents)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		item := &CloneDatasetItem{Kind: CloneDatasetItemKindDocument, Name: document.Name, SourceID: document.DocumentID}
+		c.report.Items = append(c.report.Items, item)
+
+		var base *DocumentBase
+		if progress, ok := webPages[document.DocumentID]; ok {
+			item.URL = progress.URL
+			base = DocumentBaseBuildWebPage(document.Name, progress.URL, nil)
+			base.UpdateRule = &DocumentUpdateRule{UpdateType: document.UpdateType, UpdateInterval: document.UpdateInterval}
+		} else if c.req.DocumentSource != nil {
+			if base, err = c.req.DocumentSource(ctx, document); err != nil {
+				item.Error = err.Error()
+				continue
+			}
+		}
+		if base == nil {
+			item.Skipped = "the content of local file documents can not be downloaded"
+			continue
+		}
+
+		chunkStrategy := document.ChunkStrategy
+		if chunkStrategy == nil {
+			chunkStrategy = c.dataset.ChunkStrategy
+		}
+		created, err := c.target.Datasets.Documents.Create(ctx, &CreateDatasetsDocumentsReq{
+			DatasetID:     targetID,
+			DocumentBases: []*DocumentBase{base},
+			ChunkStrategy: chunkStrategy,
+			FormatType:    c.dataset.FormatType,
+		})
+		if err != nil {
+			item.Error = err.Error()
+			continue
+		}
+		if len(created.DocumentInfos) == 0 {
+			item.Error = "no document created"
+			continue
+		}
+		item.TargetID = created.DocumentInfos[0].DocumentID
+	}
+	return nil
+}
+
+// webPages 通过 Process 接口获取在线网页文档的 url
+func (c *datasetCloner) webPages(ctx context.Context, documents []*Document) (map[string]*DocumentProgress, error) {
+	var ids []string
+	for _, document := range documents {
+		if document.SourceType == DocumentSourceTypeOnlineWeb {
+			ids = append(ids, document.DocumentID)
+		}
+	}
+	pages := map[string]*DocumentProgress{}
+	for start := 0; start < len(ids); start += 50 {
+		end := start + 50
+		if end > len(ids) {
+			end = len(ids)
+		}
+		resp, err := c.source.Datasets.Process(ctx, &ProcessDocumentsReq{DatasetID: c.dataset.ID, DocumentIDs: ids[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		for _, progress := range resp.Data {
+			if progress.URL != "" {
+				pages[progress.DocumentID] = progress
+			}
+		}
+	}
+	return pages, nil
+}
+
+func (c *datasetCloner) cloneImages(ctx context.Context) error {
+	targetID, err := strconv.ParseInt(c.report.TargetDatasetID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dataset id %s: %w", c.report.TargetDatasetID, err)
+	}
+	images, err := c.source.Datasets.Images.listAll(ctx, c.dataset.ID)
+	if err != nil {
+		return err
+	}
+
+	captions := map[string]string{}
+	var created []string
+	for _, image := range images {
+		item := &CloneDatasetItem{Kind: CloneDatasetItemKindImage, Name: image.Name, SourceID: image.DocumentID}
+		c.report.Items = append(c.report.Items, item)
+		if c.req.ImageSource == nil {
+			item.Skipped = "the content of images can not be downloaded"
+			continue
+		}
+		file, err := c.req.ImageSource(ctx, image)
+		if err != nil {
+			item.Error = err.Error()
+			continue
+		}
+		if file == nil {
+			item.Skipped = "no image source"
+			continue
+		}
+		documentID, err := c.createImage(ctx, targetID, image.Name, file)
+		if err != nil {
+			item.Error = err.Error()
+			continue
+		}
+		item.TargetID = documentID
+		created = append(created, documentID)
+		if image.Caption != "" {
+			captions[documentID] = image.Caption
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	resp, err := c.target.Datasets.WaitForDocuments(ctx, c.report.TargetDatasetID, created, c.req.WaitOptions...)
+	var processErr *DocumentsProcessError
+	if err != nil && !errors.As(err, &processErr) {
+		return err
+	}
+	for original, newID := range resp.Reuploaded {
+		c.replaceTargetID(original, newID)
+		if caption, ok := captions[original]; ok {
+			captions[newID] = caption
+		}
+	}
+	for _, progress := range resp.Documents {
+		item := c.itemByTargetID(progress.DocumentID)
+		if progress.Status == DocumentStatusFailed {
+			item.Error = fmt.Sprintf("process failed: %s", progress.StatusDescript)
+			continue
+		}
+		caption, ok := captions[progress.DocumentID]
+		if !ok {
+			continue
+		}
+		if _, err := c.target.Datasets.Images.Update(ctx, &UpdateDatasetImageReq{
+			DatasetID:  c.report.TargetDatasetID,
+			DocumentID: progress.DocumentID,
+			Caption:    &caption,
+		}); err != nil {
+			item.Error = err.Error()
+		}
+	}
+	for _, id := range resp.Missing {
+		c.itemByTargetID(id).Error = "document not found"
+	}
+	return nil
+}
+
+func (c *datasetCloner) createImage(ctx context.Context, datasetID int64, name string, file FileTypes) (string, error) {
+	uploaded, err := c.target.Files.Upload(ctx, &UploadFilesReq{File: file})
+	if err != nil {
+		return "", err
+	}
+	fileID, err := strconv.ParseInt(uploaded.ID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid file id %s: %w", uploaded.ID, err)
+	}
+	created, err := c.target.Datasets.Documents.Create(ctx, &CreateDatasetsDocumentsReq{
+		DatasetID:     datasetID,
+		DocumentBases: []*DocumentBase{DocumentBaseBuildImage(name, fileID)},
+		FormatType:    DocumentFormatTypeImage,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(created.DocumentInfos) == 0 {
+		return "", errors.New("no document created")
+	}
+	return created.DocumentInfos[0].DocumentID, nil
+}
+
+func (c *datasetCloner) itemByTargetID(targetID string) *CloneDatasetItem {
+	for _, item := range c.report.Items {
+		if item.TargetID == targetID {
+			return item
+		}
+	}
+	return &CloneDatasetItem{}
+}
+
+func (c *datasetCloner) replaceTargetID(original, replacement string) {
+	if item := c.itemByTargetID(original); item.SourceID != "" {
+		item.TargetID = replacement
+	}
+}
@@ -0,0 +1,136 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneDataset(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("documents", func(t *testing.T) {
+		source := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/v1/datasets":
+				as.Equal("space1", req.URL.Query().Get("space_id"))
+				return mockResponse(http.StatusOK, &listDatasetsResp{Data: &ListDatasetsResp{TotalCount: 2, DatasetList: []*Dataset{
+					{ID: "9", Name: "other"},
+					{ID: "1", Name: "faq", Description: "desc", ChunkStrategy: &DocumentChunkStrategy{ChunkType: 1, Separator: "\n", MaxTokens: 500}},
+				}}})
+			case "/open_api/knowledge/document/list":
+				return mockResponse(http.StatusOK, &listDatasetsDocumentsResp{ListDatasetsDocumentsResp: &ListDatasetsDocumentsResp{Total: 3, DocumentInfos: []*Document{
+					{DocumentID: "10", Name: "web", SourceType: DocumentSourceTypeOnlineWeb, UpdateType: DocumentUpdateTypeAutoUpdate, UpdateInterval: 24},
+					{DocumentID: "11", Name: "a.txt", SourceType: DocumentSourceTypeLocalFile},
+					{DocumentID: "12", Name: "b.pdf", SourceType: DocumentSourceTypeLocalFile},
+				}}})
+			case "/v1/datasets/1/process":
+				return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: []*DocumentProgress{
+					{DocumentID: "10", URL: "https://example.com"},
+				}}})
+			}
+			return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+		}))
+
+		var creates []*CreateDatasetsDocumentsReq
+		target := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/v1/datasets":
+				body := &CreateDatasetsReq{}
+				as.Nil(json.NewDecoder(req.Body).Decode(body))
+				as.Equal("faq-prod", body.Name)
+				as.Equal("space2", body.SpaceID)
+				as.Equal("desc", body.Description)
+				return mockResponse(http.StatusOK, &createDatasetResp{Data: &CreateDatasetResp{DatasetID: "2"}})
+			case "/open_api/knowledge/document/create":
+				body := &CreateDatasetsDocumentsReq{}
+				as.Nil(json.NewDecoder(req.Body).Decode(body))
+				creates = append(creates, body)
+				id := "20"
+				if len(creates) > 1 {
+					id = "21"
+				}
+				return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{
+					DocumentInfos: []*Document{{DocumentID: id}},
+				}})
+			}
+			return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+		}))
+
+		report, err := CloneDataset(context.Background(), source, target, &CloneDatasetReq{
+			SourceSpaceID:   "space1",
+			SourceDatasetID: "1",
+			TargetSpaceID:   "space2",
+			Name:            "faq-prod",
+			DocumentSource: func(ctx context.Context, document *Document) (*DocumentBase, error) {
+				if document.Name == "a.txt" {
+					return DocumentBaseBuildLocalFile(document.Name, "content", "txt"), nil
+				}
+				return nil, nil
+			},
+		})
+		as.Nil(err)
+		as.Equal("2", report.TargetDatasetID)
+		as.Len(creates, 2)
+		as.Equal(int64(2), creates[0].DatasetID)
+		as.Equal("https://example.com", *creates[0].DocumentBases[0].SourceInfo.WebUrl)
+		as.Equal(DocumentUpdateTypeAutoUpdate, creates[0].DocumentBases[0].UpdateRule.UpdateType)
+		as.Equal(24, creates[0].DocumentBases[0].UpdateRule.UpdateInterval)
+		as.Equal("\n", creates[0].ChunkStrategy.Separator)
+		as.Equal(map[string]string{"1": "2", "10": "20", "11": "21"}, report.Mapping())
+		as.Len(report.Skipped(), 1)
+		as.Equal("12", report.Skipped()[0].SourceID)
+
+		buf := &bytes.Buffer{}
+		as.Nil(report.WriteJSON(buf))
+		as.Contains(buf.String(), `"target_dataset_id": "2"`)
+	})
+
+	t.Run("images", func(t *testing.T) {
+		source := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/v1/datasets":
+				return mockResponse(http.StatusOK, &listDatasetsResp{Data: &ListDatasetsResp{TotalCount: 1, DatasetList: []*Dataset{
+					{ID: "5", Name: "images", FormatType: DocumentFormatTypeImage},
+				}}})
+			case "/v1/datasets/5/images":
+				return mockResponse(http.StatusOK, &listImagesResp{Data: &ListImagesResp{TotalCount: 2, ImagesInfos: []*Image{
+					{DocumentID: "50", Name: "a.png", Caption: "caption a"},
+					{DocumentID: "51", Name: "b.png"},
+				}}})
+			}
+			return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+		}))
+		server := &mockImageServer{updates: map[string]string{}}
+		target := newCozeAPIWithTransport(newMockTransport(server.roundTrip))
+
+		report, err := CloneDataset(context.Background(), source, target, &CloneDatasetReq{
+			SourceSpaceID:   "space1",
+			SourceDatasetID: "5",
+			TargetDatasetID: "1",
+			ImageSource: func(ctx context.Context, image *Image) (FileTypes, error) {
+				return NewUploadFile(strings.NewReader(image.Name), image.Name), nil
+			},
+		})
+		as.NotNil(err)
+		as.Equal(2, server.uploads)
+		as.Equal(map[string]string{"100": "caption a"}, server.updates)
+		as.Equal("100", report.Mapping()["50"])
+		as.Len(report.Failed(), 1)
+		as.Equal("51", report.Failed()[0].SourceID)
+	})
+
+	t.Run("dataset not found", func(t *testing.T) {
+		source := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockResponse(http.StatusOK, &listDatasetsResp{Data: &ListDatasetsResp{}})
+		}))
+		_, err := CloneDataset(context.Background(), source, source, &CloneDatasetReq{SourceSpaceID: "space1", SourceDatasetID: "1"})
+		as.NotNil(err)
+		as.Contains(err.Error(), "not found")
+	})
+}
@@ -3,18 +3,25 @@ package coze
 import (
 	"context"
 	"encoding/base64"
+	"io"
 	"net/http"
 )
 
-func (r *datasetsDocuments) Create(ctx context.Context, req *CreateDatasetsDocumentsReq) (*CreateDatasetsDocumentsResp, error) {
+func (r *datasetsDocuments) Create(ctx context.Context, req *CreateDatasetsDocumentsReq, options ...CozeAPIOption) (*CreateDatasetsDocumentsResp, error) {
+	body, streams, err := req.withBase64Streams()
+	if err != nil {
+		return nil, err
+	}
 	request := &RawRequestReq{
-		Method:  http.MethodPost,
-		URL:     "/open_api/knowledge/document/create",
-		Body:    req,
-		Headers: r.commonHeaderOpt,
+		Method:        http.MethodPost,
+		URL:           "/open_api/knowledge/document/create",
+		Body:          body,
+		Headers:       r.commonHeaderOpt,
+		base64Streams: streams,
+		options:       options,
 	}
 	response := new(createDatasetsDocumentsResp)
-	err := r.client.rawRequest(ctx, request, response)
+	err = r.client.rawRequest(ctx, request, response)
 	return response.CreateDatasetsDocumentsResp, err
 }
 
@@ -195,6 +202,10 @@ type DocumentSourceInfo struct {
 	DocumentSource *int `json:"document_source,omitempty"`
 
 	SourceFileID *int64 `json:"source_file_id,omitempty"`
+
+	// The local file read and base64 encoded while sending the request, see
+	// DocumentSourceInfoBuildLocalFileReader.
+	fileReader io.Reader
 }
 
 // DocumentUpdateRule represents update rules for datasetsDocuments
@@ -356,6 +367,25 @@ func DocumentBaseBuildLocalFile(name string, content string, fileType string) *D
 	}
 }
 
+// DocumentBaseBuildLocalFileReader creates basic document information for local file type. The
+// content is read from reader and base64 encoded while the request is sent, so large files are
+// uploaded in constant memory. The reader can only be consumed once.
+func DocumentBaseBuildLocalFileReader(name string, reader io.Reader, fileType string) *DocumentBase {
+	return &DocumentBase{
+		Name:       name,
+		SourceInfo: DocumentSourceInfoBuildLocalFileReader(reader, fileType),
+	}
+}
+
+// DocumentBaseBuildUploadedFile creates basic document information for a local file uploaded by
+// Files.Upload, so that uploads can be reused through WithFileCache.
+func DocumentBaseBuildUploadedFile(name string, fileID int64, fileType string) *DocumentBase {
+	return &DocumentBase{
+		Name:       name,
+		SourceInfo: DocumentSourceInfoBuildUploadedFile(fileID, fileType),
+	}
+}
+
 // DocumentBaseBuildImage creates basic document information for image type
 func DocumentBaseBuildImage(name string, fileID int64) *DocumentBase {
 	return &DocumentBase{
@@ -380,6 +410,16 @@ func DocumentSourceInfoBuildImage(fileID int64) *DocumentSourceInfo {
 	}
 }
 
+// DocumentSourceInfoBuildUploadedFile creates document source information for a file uploaded by
+// Files.Upload
+func DocumentSourceInfoBuildUploadedFile(fileID int64, fileType string) *DocumentSourceInfo {
+	return &DocumentSourceInfo{
+		FileType:       &fileType,
+		SourceFileID:   &fileID,
+		DocumentSource: ptr(5),
+	}
+}
+
 // DocumentSourceInfoBuildLocalFile creates document source information for local file type
 func DocumentSourceInfoBuildLocalFile(content string, fileType string) *DocumentSourceInfo {
 	encodedContent := base64.StdEncoding.EncodeToString([]byte(content))
@@ -389,6 +429,15 @@ func DocumentSourceInfoBuildLocalFile(content string, fileType string) *Document
 	}
 }
 
+// DocumentSourceInfoBuildLocalFileReader creates document source information for local file type,
+// the content is read from reader and base64 encoded while the request is sent
+func DocumentSourceInfoBuildLocalFileReader(reader io.Reader, fileType string) *DocumentSourceInfo {
+	return &DocumentSourceInfo{
+		FileType:   &fileType,
+		fileReader: reader,
+	}
+}
+
 // DocumentUpdateRuleBuildNoAuto creates a rule for no automatic updates
 func DocumentUpdateRuleBuildNoAuto() *DocumentUpdateRule {
 	return &DocumentUpdateRule{
@@ -419,6 +468,34 @@ type createDatasetsDocumentsResp struct {
 	*CreateDatasetsDocumentsResp
 }
 
+// withBase64Streams 为通过 reader 构造的本地文件生成占位符, 请求发送时再以 base64 流的方式写入
+func (r *CreateDatasetsDocumentsReq) withBase64Streams() (*CreateDatasetsDocumentsReq, []*base64Stream, error) {
+	var streams []*base64Stream
+	bases := make([]*DocumentBase, 0, len(r.DocumentBases))
+	for _, base := range r.DocumentBases {
+		if base == nil || base.SourceInfo == nil || base.SourceInfo.fileReader == nil {
+			bases = append(bases, base)
+			continue
+		}
+		stream, err := newBase64Stream(base.SourceInfo.fileReader)
+		if err != nil {
+			return nil, nil, err
+		}
+		sourceInfo := *base.SourceInfo
+		sourceInfo.FileBase64 = &stream.placeholder
+		newBase := *base
+		newBase.SourceInfo = &sourceInfo
+		bases = append(bases, &newBase)
+		streams = append(streams, stream)
+	}
+	if len(streams) == 0 {
+		return r, nil, nil
+	}
+	req := *r
+	req.DocumentBases = bases
+	return &req, streams, nil
+}
+
 func (r ListDatasetsDocumentsReq) toReq(page *pageRequest) *ListDatasetsDocumentsReq {
 	return &ListDatasetsDocumentsReq{
 		DatasetID: r.DatasetID,
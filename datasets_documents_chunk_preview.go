@@ -0,0 +1,415 @@
+package coze
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PreviewDocumentChunks chunks the content locally according to the DocumentChunkStrategy, so
+// documents which chunk badly can be found before they are uploaded to a dataset. The result is
+// an approximation of the server side chunking.
+//
+// With a custom strategy (ChunkType=1) the text is split by Separator, each part is cleaned by
+// RemoveExtraSpaces and RemoveUrlsEmails, and parts longer than MaxTokens are split further.
+// The automatic strategy splits paragraphs and Markdown headings, removes extra spaces, and
+// merges adjacent paragraphs up to 800 tokens.
+func PreviewDocumentChunks(req *PreviewDocumentChunksReq) (*DocumentChunkPreview, error) {
+	text, err := req.sourceText()
+	if err != nil {
+		return nil, err
+	}
+	tokenizer := req.Tokenizer
+	if tokenizer == nil {
+		tokenizer = ChunkTokenizerFunc(ApproximateTokens)
+	}
+
+	strategy := req.ChunkStrategy
+	auto := strategy == nil || strategy.ChunkType == 0
+	if auto {
+		strategy = &DocumentChunkStrategy{
+			MaxTokens:         defaultChunkMaxTokens,
+			RemoveExtraSpaces: true,
+		}
+	} else if strategy.Separator == "" || strategy.MaxTokens <= 0 {
+		return nil, fmt.Errorf("separator and max_tokens are required when chunk_type=1")
+	}
+
+	var segments []chunkSpan
+	if auto {
+		segments = splitParagraphs(text, req.fileType() == "md")
+	} else {
+		segments = splitBySeparator(text, strategy.Separator)
+	}
+
+	chunker := &documentChunker{text: text, strategy: strategy, tokenizer: tokenizer}
+	for _, segment := range segments {
+		chunker.addSegment(segment)
+	}
+	if auto {
+		chunker.merge()
+	}
+	return newDocumentChunkPreview(text, chunker.chunks), nil
+}
+
+// PreviewDocumentChunksReq represents request for previewing the chunks of a document
+type PreviewDocumentChunksReq struct {
+	// The content of the document, Reader is used if Content is empty.
+	Content string
+	Reader  io.Reader
+
+	// The format of the content: txt, md or csv, default is txt. The rows of csv content are
+	// joined by line breaks and their fields by commas before chunking.
+	FileType string
+
+	// The chunk strategy, nil means the automatic strategy.
+	ChunkStrategy *DocumentChunkStrategy
+
+	// Counts the tokens of a text, default is ApproximateTokens.
+	Tokenizer ChunkTokenizer
+}
+
+// ChunkTokenizer counts the tokens of a text
+type ChunkTokenizer interface {
+	CountTokens(text string) int
+}
+
+// ChunkTokenizerFunc is an adapter to use a function as ChunkTokenizer
+type ChunkTokenizerFunc func(text string) int
+
+// CountTokens implements ChunkTokenizer
+func (f ChunkTokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// DocumentChunk represents a chunk of the document preview
+type DocumentChunk struct {
+	// The index of the chunk, starting from 0.
+	Index int
+
+	// The cleaned content of the chunk.
+	Content string
+
+	// The byte offsets of the chunk in DocumentChunkPreview.Text.
+	Start int
+	End   int
+
+	// The number of tokens and characters of the content.
+	Tokens int
+	Chars  int
+}
+
+// DocumentChunkPreview represents the result of PreviewDocumentChunks
+type DocumentChunkPreview struct {
+	// The text which is chunked, csv content is converted to lines.
+	Text string
+
+	Chunks []*DocumentChunk
+
+	TotalTokens int
+	MinTokens   int
+	MaxTokens   int
+	AvgTokens   float64
+}
+
+// Count returns the number of chunks
+func (p *DocumentChunkPreview) Count() int {
+	return len(p.Chunks)
+}
+
+// Undersized returns the chunks with fewer tokens than minTokens
+func (p *DocumentChunkPreview) Undersized(minTokens int) []*DocumentChunk {
+	var chunks []*DocumentChunk
+	for _, chunk := range p.Chunks {
+		if chunk.Tokens < minTokens {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// Oversized returns the chunks with more tokens than maxTokens. A chunk can exceed the
+// MaxTokens of the strategy when a single word is longer than it.
+func (p *DocumentChunkPreview) Oversized(maxTokens int) []*DocumentChunk {
+	var chunks []*DocumentChunk
+	for _, chunk := range p.Chunks {
+		if chunk.Tokens > maxTokens {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// ApproximateTokens approximates the number of tokens of a text: each CJK character and
+// punctuation counts as one token, and other words count as one token per 4 characters.
+func ApproximateTokens(text string) int {
+	tokens := 0
+	word := 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+const defaultChunkMaxTokens = 800
+
+var (
+	chunkURLRegexp         = regexp.MustCompile(`(?i)(https?://|www\.)[^\s<>"']+`)
+	chunkEmailRegexp       = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	chunkExtraSpaceRegexp  = regexp.MustCompile(`[ \t\f\v\x{3000}]+`)
+	chunkExtraBreakRegexp  = regexp.MustCompile(`\s*\n\s*`)
+	chunkParagraphRegexp   = regexp.MustCompile(`\n[ \t]*\n`)
+	chunkMarkdownHeadRegex = regexp.MustCompile(`(?m)^#{1,6}[ \t]`)
+)
+
+type chunkSpan struct {
+	start int
+	end   int
+}
+
+type documentChunker struct {
+	text      string
+	strategy  *DocumentChunkStrategy
+	tokenizer ChunkTokenizer
+	chunks    []*DocumentChunk
+}
+
+func (c *documentChunker) removeUrlsEmails(s string) string {
+	if c.strategy.RemoveUrlsEmails {
+		s = chunkEmailRegexp.ReplaceAllString(s, "")
+		s = chunkURLRegexp.ReplaceAllString(s, "")
+	}
+	return s
+}
+
+func (c *documentChunker) clean(s string) string {
+	s = c.removeUrlsEmails(s)
+	if c.strategy.RemoveExtraSpaces {
+		s = chunkExtraSpaceRegexp.ReplaceAllString(s, " ")
+		s = chunkExtraBreakRegexp.ReplaceAllString(s, "\n")
+	}
+	return strings.TrimSpace(s)
+}
+
+func (c *documentChunker) emit(span chunkSpan) {
+	content := c.clean(c.text[span.start:span.end])
+	if content == "" {
+		return
+	}
+	c.chunks = append(c.chunks, &DocumentChunk{
+		Content: content,
+		Start:   span.start,
+		End:     span.end,
+		Tokens:  c.tokenizer.CountTokens(content),
+		Chars:   utf8.RuneCountInString(content),
+	})
+}
+
+// addSegment 添加一个分段, 超过 MaxTokens 的分段按词切分
+func (c *documentChunker) addSegment(segment chunkSpan) {
+	content := c.clean(c.text[segment.start:segment.end])
+	if content == "" {
+		return
+	}
+	if c.tokenizer.CountTokens(content) <= c.strategy.MaxTokens {
+		c.emit(segment)
+		return
+	}
+
+	current := chunkSpan{start: segment.start, end: segment.start}
+	tokens := 0
+	for _, unit := range splitChunkUnits(c.text, segment) {
+		unitTokens := c.tokenizer.CountTokens(c.removeUrlsEmails(c.text[unit.start:unit.end]))
+		if tokens > 0 && tokens+unitTokens > c.strategy.MaxTokens {
+			c.emit(current)
+			current = chunkSpan{start: unit.start, end: unit.start}
+			tokens = 0
+		}
+		current.end = unit.end
+		tokens += unitTokens
+	}
+	c.emit(current)
+}
+
+// merge 合并相邻的分段, 不跨越 markdown 标题
+func (c *documentChunker) merge() {
+	var merged []*DocumentChunk
+	for _, chunk := range c.chunks {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			content := last.Content + "\n" + chunk.Content
+			if !chunkMarkdownHeadRegex.MatchString(chunk.Content) {
+				if tokens := c.tokenizer.CountTokens(content); tokens <= c.strategy.MaxTokens {
+					last.Content = content
+					last.End = chunk.End
+					last.Tokens = tokens
+					last.Chars = utf8.RuneCountInString(content)
+					continue
+				}
+			}
+		}
+		merged = append(merged, chunk)
+	}
+	c.chunks = merged
+}
+
+func newDocumentChunkPreview(text string, chunks []*DocumentChunk) *DocumentChunkPreview {
+	preview := &DocumentChunkPreview{Text: text, Chunks: chunks}
+	for i, chunk := range chunks {
+		chunk.Index = i
+		preview.TotalTokens += chunk.Tokens
+		if i == 0 || chunk.Tokens < preview.MinTokens {
+			preview.MinTokens = chunk.Tokens
+		}
+		if chunk.Tokens > preview.MaxTokens {
+			preview.MaxTokens = chunk.Tokens
+		}
+	}
+	if len(chunks) > 0 {
+		preview.AvgTokens = float64(preview.TotalTokens) / float64(len(chunks))
+	}
+	return preview
+}
+
+func (r *PreviewDocumentChunksReq) fileType() string {
+	fileType := strings.TrimPrefix(strings.ToLower(r.FileType), ".")
+	switch fileType {
+	case "markdown":
+		return "md"
+	case "":
+		return "txt"
+	}
+	return fileType
+}
+
+func (r *PreviewDocumentChunksReq) sourceText() (string, error) {
+	content := r.Content
+	if content == "" && r.Reader != nil {
+		bs, err := io.ReadAll(r.Reader)
+		if err != nil {
+			return "", err
+		}
+		content = string(bs)
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	switch r.fileType() {
+	case "txt", "md":
+		return content, nil
+	case "csv":
+		reader := csv.NewReader(strings.NewReader(content))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("invalid csv: %w", err)
+		}
+		buf := &bytes.Buffer{}
+		for i, record := range records {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(strings.Join(record, ","))
+		}
+		return buf.String(), nil
+	}
+	return "", fmt.Errorf("unsupported file type %s", r.FileType)
+}
+
+func splitBySeparator(text, separator string) []chunkSpan {
+	var spans []chunkSpan
+	start := 0
+	for {
+		idx := strings.Index(text[start:], separator)
+		if idx < 0 {
+			break
+		}
+		spans = append(spans, chunkSpan{start: start, end: start + idx})
+		start += idx + len(separator)
+	}
+	return append(spans, chunkSpan{start: start, end: len(text)})
+}
+
+// splitParagraphs 按空行切分段落, markdown 的标题总是开始一个新的段落
+func splitParagraphs(text string, markdown bool) []chunkSpan {
+	boundaries := map[int]int{}
+	for _, loc := range chunkParagraphRegexp.FindAllStringIndex(text, -1) {
+		boundaries[loc[0]] = loc[1]
+	}
+	if markdown {
+		for _, loc := range chunkMarkdownHeadRegex.FindAllStringIndex(text, -1) {
+			if _, ok := boundaries[loc[0]]; !ok && loc[0] > 0 {
+				boundaries[loc[0]] = loc[0]
+			}
+		}
+	}
+
+	var spans []chunkSpan
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if next, ok := boundaries[i]; ok && i >= start {
+			spans = append(spans, chunkSpan{start: start, end: i})
+			start = next
+		}
+	}
+	return append(spans, chunkSpan{start: start, end: len(text)})
+}
+
+// splitChunkUnits 把分段切分为不可再分的单元: 连续的非空白字符或单个 CJK 字符, 包含其后的空白
+func splitChunkUnits(text string, span chunkSpan) []chunkSpan {
+	var units []chunkSpan
+	start := span.start
+	inWord := false
+	for i, r := range text[span.start:span.end] {
+		pos := span.start + i
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+		case isCJK(r):
+			if pos > start {
+				units = append(units, chunkSpan{start: start, end: pos})
+			}
+			start = pos
+			inWord = false
+			units = append(units, chunkSpan{start: start, end: pos + utf8.RuneLen(r)})
+			start = pos + utf8.RuneLen(r)
+		default:
+			if !inWord && pos > start {
+				units = append(units, chunkSpan{start: start, end: pos})
+				start = pos
+			}
+			inWord = true
+		}
+	}
+	if span.end > start {
+		units = append(units, chunkSpan{start: start, end: span.end})
+	}
+	return units
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
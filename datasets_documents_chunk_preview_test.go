@@ -0,0 +1,101 @@
+package coze
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewDocumentChunks(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("custom separator", func(t *testing.T) {
+		text := "first   part\t\twith  spaces###second part https://example.com/a?b=1 mail me@example.com###   ###third"
+		preview, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{
+			Content: text,
+			ChunkStrategy: &DocumentChunkStrategy{
+				ChunkType:         1,
+				Separator:         "###",
+				MaxTokens:         100,
+				RemoveExtraSpaces: true,
+				RemoveUrlsEmails:  true,
+			},
+		})
+		as.Nil(err)
+		as.Equal(3, preview.Count())
+		as.Equal("first part with spaces", preview.Chunks[0].Content)
+		as.Equal("second part mail", preview.Chunks[1].Content)
+		as.Equal("third", preview.Chunks[2].Content)
+		as.Equal(2, preview.Chunks[2].Index)
+		as.Equal("third", text[preview.Chunks[2].Start:preview.Chunks[2].End])
+		as.Equal(0, preview.Chunks[0].Start)
+	})
+
+	t.Run("max tokens", func(t *testing.T) {
+		text := strings.Repeat("word ", 50) + strings.Repeat("中", 30)
+		preview, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{
+			Content:       text,
+			ChunkStrategy: &DocumentChunkStrategy{ChunkType: 1, Separator: "\n", MaxTokens: 20},
+		})
+		as.Nil(err)
+		as.Equal(80, preview.TotalTokens)
+		as.Equal(4, preview.Count())
+		as.Equal(20, preview.MaxTokens)
+		as.Empty(preview.Oversized(20))
+		for i := 1; i < preview.Count(); i++ {
+			as.Equal(preview.Chunks[i-1].End, preview.Chunks[i].Start)
+		}
+		as.Equal(strings.Repeat("中", 20), preview.Chunks[3].Content)
+	})
+
+	t.Run("custom tokenizer", func(t *testing.T) {
+		preview, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{
+			Content:       "a b c d e",
+			ChunkStrategy: &DocumentChunkStrategy{ChunkType: 1, Separator: "|", MaxTokens: 4},
+			Tokenizer:     ChunkTokenizerFunc(func(text string) int { return len(text) }),
+		})
+		as.Nil(err)
+		as.Equal([]string{"a b", "c d", "e"}, []string{preview.Chunks[0].Content, preview.Chunks[1].Content, preview.Chunks[2].Content})
+	})
+
+	t.Run("auto markdown", func(t *testing.T) {
+		preview, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{
+			Content:  "# Title\nintro\n\nmore intro\n## Section\nbody\n\n\n\nend",
+			FileType: "md",
+		})
+		as.Nil(err)
+		as.Equal(2, preview.Count())
+		as.Equal("# Title\nintro\nmore intro", preview.Chunks[0].Content)
+		as.Equal("## Section\nbody\nend", preview.Chunks[1].Content)
+		as.Len(preview.Undersized(10), 2)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		preview, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{
+			Reader:        strings.NewReader("name,desc\r\na,\"x, y\"\r\nb,z\r\n"),
+			FileType:      "csv",
+			ChunkStrategy: &DocumentChunkStrategy{ChunkType: 1, Separator: "\n", MaxTokens: 100},
+		})
+		as.Nil(err)
+		as.Equal("name,desc\na,x, y\nb,z", preview.Text)
+		as.Equal(3, preview.Count())
+		as.Equal("a,x, y", preview.Chunks[1].Content)
+
+		_, err = PreviewDocumentChunks(&PreviewDocumentChunksReq{Content: "a,\"b", FileType: "csv"})
+		as.NotNil(err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := PreviewDocumentChunks(&PreviewDocumentChunksReq{Content: "a", ChunkStrategy: &DocumentChunkStrategy{ChunkType: 1}})
+		as.NotNil(err)
+		_, err = PreviewDocumentChunks(&PreviewDocumentChunksReq{Content: "a", FileType: "pdf"})
+		as.NotNil(err)
+	})
+
+	t.Run("approximate tokens", func(t *testing.T) {
+		as.Equal(0, ApproximateTokens(""))
+		as.Equal(2, ApproximateTokens("hello"))
+		as.Equal(4, ApproximateTokens("你好, ab"))
+	})
+}
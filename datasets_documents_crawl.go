@@ -0,0 +1,560 @@
+package coze
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Crawl discovers web pages from a sitemap or seed URLs and creates them as web page documents
+//
+// The crawler obeys robots.txt, only follows links within the allowed domains and up to MaxDepth,
+// and skips the pages which already exist in the dataset as online web documents. With
+// RemoveVanished, existing web documents within the allowed domains whose pages return 404 or
+// 410 are deleted.
+func (r *datasetsDocuments) Crawl(ctx context.Context, req *CrawlDatasetsDocumentsReq) (*CrawlDatasetsDocumentsResp, error) {
+	crawler, err := newDocumentCrawler(r, req)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := crawler.existingWebPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CrawlDatasetsDocumentsResp{}
+	pages := crawler.crawl(ctx, resp)
+	if err := ctx.Err(); err != nil {
+		return resp, err
+	}
+
+	var newPages []*crawledPage
+	for _, page := range pages {
+		resp.Discovered = append(resp.Discovered, page.url)
+		if _, ok := existing[page.url]; ok {
+			resp.Existing = append(resp.Existing, page.url)
+			continue
+		}
+		newPages = append(newPages, page)
+	}
+	if !req.DryRun {
+		crawler.create(ctx, newPages, resp)
+	}
+	if req.RemoveVanished {
+		if err := crawler.removeVanished(ctx, existing, pages, req.DryRun, resp); err != nil {
+			return resp, err
+		}
+	}
+	if len(resp.Failed) > 0 {
+		return resp, fmt.Errorf("%d pages failed to crawl, first error: %s", len(resp.Failed), resp.Failed[0].Error)
+	}
+	return resp, nil
+}
+
+// CrawlDatasetsDocumentsReq represents request for crawling web pages into a dataset
+type CrawlDatasetsDocumentsReq struct {
+	// The ID of the knowledge base.
+	DatasetID int64
+
+	// The sitemap.xml to start from, sitemap index files are supported.
+	SitemapURL string
+
+	// The URLs to start from.
+	SeedURLs []string
+
+	// The depth of links followed from the sitemap and seed URLs, 0 means links are not followed.
+	MaxDepth int
+
+	// The maximum number of pages discovered, default is 100.
+	MaxPages int
+
+	// The domains allowed to crawl, default is the hosts of the sitemap and seed URLs.
+	// Subdomains of an allowed domain are allowed.
+	AllowedDomains []string
+
+	// Filter returns whether the URL should be crawled.
+	Filter func(u *url.URL) bool
+
+	// The update rule of the created documents, default is no automatic update.
+	UpdateRule *DocumentUpdateRule
+
+	// Delete the existing web documents whose pages are gone.
+	RemoveVanished bool
+
+	// Only report the pages, do not create or delete documents. The vanished documents which would
+	// be deleted with RemoveVanished are reported in Removed.
+	DryRun bool
+
+	// The user agent used for requests and robots.txt matching, default is coze-go-crawler.
+	UserAgent string
+
+	// Ignore robots.txt.
+	IgnoreRobots bool
+
+	// The client used to fetch pages, default is an http.Client with a 10s timeout.
+	HTTPClient HTTPClient
+}
+
+// CrawledDocument represents a web document created or removed by Crawl
+type CrawledDocument struct {
+	URL        string
+	Name       string
+	DocumentID string
+}
+
+// CrawlError represents a page which failed to crawl or create
+type CrawlError struct {
+	URL   string
+	Error string
+}
+
+// CrawlDatasetsDocumentsResp represents response for crawling web pages into a dataset
+type CrawlDatasetsDocumentsResp struct {
+	// All pages discovered by the crawler.
+	Discovered []string
+
+	// The pages which already exist in the dataset.
+	Existing []string
+
+	// The pages disallowed by robots.txt.
+	Blocked []string
+
+	Created []*CrawledDocument
+	Removed []*CrawledDocument
+	Failed  []*CrawlError
+}
+
+const defaultCrawlUserAgent = "coze-go-crawler"
+
+var (
+	crawlLinkRegexp  = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	crawlTitleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+type crawledPage struct {
+	url   string
+	title string
+	depth int
+}
+
+type documentCrawler struct {
+	documents *datasetsDocuments
+	req       *CrawlDatasetsDocumentsReq
+	client    HTTPClient
+	userAgent string
+	domains   []string
+	robots    map[string]*robotsRules
+}
+
+func newDocumentCrawler(documents *datasetsDocuments, req *CrawlDatasetsDocumentsReq) (*documentCrawler, error) {
+	if req.SitemapURL == "" && len(req.SeedURLs) == 0 {
+		return nil, fmt.Errorf("sitemap url or seed urls are required")
+	}
+	c := &documentCrawler{
+		documents: documents,
+		req:       req,
+		client:    req.HTTPClient,
+		userAgent: req.UserAgent,
+		robots:    map[string]*robotsRules{},
+	}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.userAgent == "" {
+		c.userAgent = defaultCrawlUserAgent
+	}
+	for _, domain := range req.AllowedDomains {
+		c.domains = append(c.domains, strings.ToLower(domain))
+	}
+	if len(c.domains) == 0 {
+		for _, raw := range append([]string{req.SitemapURL}, req.SeedURLs...) {
+			if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+				c.domains = append(c.domains, strings.ToLower(u.Hostname()))
+			}
+		}
+	}
+	return c, nil
+}
+
+// existingWebPages 返回数据集中已有的在线网页文档, key 为规范化后的 url
+func (c *documentCrawler) existingWebPages(ctx context.Context) (map[string]*DocumentProgress, error) {
+	documents, err := c.documents.listAll(ctx, c.req.DatasetID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, document := range documents {
+		if document.SourceType == DocumentSourceTypeOnlineWeb {
+			ids = append(ids, document.DocumentID)
+		}
+	}
+
+	datasetID := strconv.FormatInt(c.req.DatasetID, 10)
+	datasets := newDatasets(c.documents.client)
+	pages := map[string]*DocumentProgress{}
+	for start := 0; start < len(ids); start += 50 {
+		end := start + 50
+		if end > len(ids) {
+			end = len(ids)
+		}
+		resp, err := datasets.Process(ctx, &ProcessDocumentsReq{DatasetID: datasetID, DocumentIDs: ids[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		for _, progress := range resp.Data {
+			if normalized, ok := normalizeCrawlURL(progress.URL, nil); ok {
+				pages[normalized] = progress
+			}
+		}
+	}
+	return pages, nil
+}
+
+func (c *documentCrawler) crawl(ctx context.Context, resp *CrawlDatasetsDocumentsResp) []*crawledPage {
+	maxPages := c.req.MaxPages
+	if maxPages <= 0 {
+		maxPages = 100
+	}
+
+	var queue []*crawledPage
+	seen := map[string]bool{}
+	enqueue := func(raw string, base *url.URL, depth int) {
+		normalized, ok := normalizeCrawlURL(raw, base)
+		if !ok || seen[normalized] || !c.allowed(normalized) {
+			return
+		}
+		seen[normalized] = true
+		queue = append(queue, &crawledPage{url: normalized, depth: depth})
+	}
+
+	if c.req.SitemapURL != "" {
+		urls, err := c.sitemapURLs(ctx, c.req.SitemapURL, 0)
+		if err != nil {
+			resp.Failed = append(resp.Failed, &CrawlError{URL: c.req.SitemapURL, Error: err.Error()})
+		}
+		for _, u := range urls {
+			enqueue(u, nil, 0)
+		}
+	}
+	for _, u := range c.req.SeedURLs {
+		enqueue(u, nil, 0)
+	}
+
+	var pages []*crawledPage
+	for len(queue) > 0 && len(pages) < maxPages && ctx.Err() == nil {
+		page := queue[0]
+		queue = queue[1:]
+		if !c.robotsAllowed(ctx, page.url) {
+			resp.Blocked = append(resp.Blocked, page.url)
+			continue
+		}
+		body, status, err := c.get(ctx, page.url)
+		if err == nil && status != http.StatusOK {
+			err = fmt.Errorf("status %d", status)
+		}
+		if err != nil {
+			resp.Failed = append(resp.Failed, &CrawlError{URL: page.url, Error: err.Error()})
+			continue
+		}
+		if match := crawlTitleRegexp.FindStringSubmatch(body); match != nil {
+			page.title = strings.TrimSpace(html.UnescapeString(match[1]))
+		}
+		pages = append(pages, page)
+
+		if page.depth < c.req.MaxDepth {
+			base, _ := url.Parse(page.url)
+			for _, match := range crawlLinkRegexp.FindAllStringSubmatch(body, -1) {
+				enqueue(html.UnescapeString(match[1]+match[2]+match[3]), base, page.depth+1)
+			}
+		}
+	}
+	return pages
+}
+
+func (c *documentCrawler) create(ctx context.Context, pages []*crawledPage, resp *CrawlDatasetsDocumentsResp) {
+	for start := 0; start < len(pages); start += 10 {
+		end := start + 10
+		if end > len(pages) {
+			end = len(pages)
+		}
+		batch := pages[start:end]
+		bases := make([]*DocumentBase, 0, len(batch))
+		for _, page := range batch {
+			name := page.title
+			if name == "" {
+				name = page.url
+			}
+			base := DocumentBaseBuildWebPage(name, page.url, nil)
+			if c.req.UpdateRule != nil {
+				base.UpdateRule = c.req.UpdateRule
+			}
+			bases = append(bases, base)
+		}
+		created, err := c.documents.Create(ctx, &CreateDatasetsDocumentsReq{
+			DatasetID:     c.req.DatasetID,
+			DocumentBases: bases,
+			FormatType:    DocumentFormatTypeDocument,
+		})
+		if err == nil && len(created.DocumentInfos) != len(batch) {
+			err = fmt.Errorf("%d documents created for %d pages", len(created.DocumentInfos), len(batch))
+		}
+		for i, page := range batch {
+			if err != nil {
+				resp.Failed = append(resp.Failed, &CrawlError{URL: page.url, Error: err.Error()})
+				continue
+			}
+			resp.Created = append(resp.Created, &CrawledDocument{
+				URL:        page.url,
+				Name:       bases[i].Name,
+				DocumentID: created.DocumentInfos[i].DocumentID,
+			})
+		}
+	}
+}
+
+// removeVanished 删除允许域名内、未被抓取到且已经返回 404/410 的网页文档, dryRun 时只记录不删除
+func (c *documentCrawler) removeVanished(ctx context.Context, existing map[string]*DocumentProgress, pages []*crawledPage, dryRun bool, resp *CrawlDatasetsDocumentsResp) error {
+	crawled := map[string]bool{}
+	for _, page := range pages {
+		crawled[page.url] = true
+	}
+	urls := make([]string, 0, len(existing))
+	for u := range existing {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	for _, u := range urls {
+		if crawled[u] || !c.allowed(u) {
+			continue
+		}
+		_, status, err := c.get(ctx, u)
+		if err != nil || (status != http.StatusNotFound && status != http.StatusGone) {
+			continue
+		}
+		progress := existing[u]
+		documentID, err := strconv.ParseInt(progress.DocumentID, 10, 64)
+		if err != nil {
+			resp.Failed = append(resp.Failed, &CrawlError{URL: u, Error: fmt.Sprintf("invalid document id %s", progress.DocumentID)})
+			continue
+		}
+		if !dryRun {
+			if _, err := c.documents.Delete(ctx, &DeleteDatasetsDocumentsReq{DocumentIDs: []int64{documentID}}); err != nil {
+				return err
+			}
+		}
+		resp.Removed = append(resp.Removed, &CrawledDocument{URL: u, Name: progress.DocumentName, DocumentID: progress.DocumentID})
+	}
+	return nil
+}
+
+func (c *documentCrawler) allowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	domainAllowed := false
+	for _, domain := range c.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			domainAllowed = true
+			break
+		}
+	}
+	if !domainAllowed {
+		return false
+	}
+	return c.req.Filter == nil || c.req.Filter(u)
+}
+
+func (c *documentCrawler) get(ctx context.Context, raw string) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	return string(body), resp.StatusCode, nil
+}
+
+func (c *documentCrawler) sitemapURLs(ctx context.Context, sitemapURL string, depth int) ([]string, error) {
+	body, status, err := c.get(ctx, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("status %d", status)
+	}
+	var sitemap struct {
+		XMLName  xml.Name
+		URLs     []string `xml:"url>loc"`
+		Sitemaps []string `xml:"sitemap>loc"`
+	}
+	if err := xml.Unmarshal([]byte(body), &sitemap); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	urls := make([]string, 0, len(sitemap.URLs))
+	for _, u := range sitemap.URLs {
+		urls = append(urls, strings.TrimSpace(u))
+	}
+	if depth < 3 {
+		for _, child := range sitemap.Sitemaps {
+			childURLs, err := c.sitemapURLs(ctx, strings.TrimSpace(child), depth+1)
+			if err != nil {
+				return urls, err
+			}
+			urls = append(urls, childURLs...)
+		}
+	}
+	return urls, nil
+}
+
+func (c *documentCrawler) robotsAllowed(ctx context.Context, raw string) bool {
+	if c.req.IgnoreRobots {
+		return true
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	rules, ok := c.robots[origin]
+	if !ok {
+		rules = &robotsRules{}
+		if body, status, err := c.get(ctx, origin+"/robots.txt"); err == nil && status == http.StatusOK {
+			rules = parseRobots(body, c.userAgent)
+		}
+		c.robots[origin] = rules
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rules.allowed(path)
+}
+
+type robotsRule struct {
+	allow  bool
+	prefix string
+}
+
+type robotsRules struct {
+	rules []robotsRule
+}
+
+// allowed 使用最长匹配的规则, 长度相同时 Allow 优先
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	allow, matched := true, -1
+	for _, rule := range r.rules {
+		if !strings.HasPrefix(path, rule.prefix) {
+			continue
+		}
+		if len(rule.prefix) > matched || (len(rule.prefix) == matched && rule.allow) {
+			allow, matched = rule.allow, len(rule.prefix)
+		}
+	}
+	return allow
+}
+
+// parseRobots 解析 robots.txt, 使用匹配 userAgent 的分组, 没有时使用 * 分组
+func parseRobots(body, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+	var specific, wildcard []robotsRule
+	var agents []string
+	inRules := false
+	hasSpecific := false
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// an empty Disallow allows everything, but still selects the group
+			empty := key == "disallow" && value == ""
+			rule := robotsRule{allow: key == "allow", prefix: value}
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					if !empty {
+						wildcard = append(wildcard, rule)
+					}
+				case agent != "" && strings.Contains(userAgent, agent):
+					hasSpecific = true
+					if !empty {
+						specific = append(specific, rule)
+					}
+				}
+			}
+		}
+	}
+	if hasSpecific {
+		return &robotsRules{rules: specific}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// normalizeCrawlURL 规范化 url: 解析相对路径, 小写 scheme 和 host, 去掉 fragment 和默认端口
+func normalizeCrawlURL(raw string, base *url.URL) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) || (u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
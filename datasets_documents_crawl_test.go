@@ -0,0 +1,160 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatasetsDocumentsCrawl(t *testing.T) {
+	as := assert.New(t)
+
+	mux := http.NewServeMux()
+	site := httptest.NewServer(mux)
+	defer site.Close()
+	page := func(title, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", title, body)
+		}
+	}
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\nAllow: /private/open\n")
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0"?><urlset><url><loc>%s/</loc></url><url><loc>%s/a</loc></url></urlset>`, site.URL, site.URL)
+	})
+	mux.HandleFunc("/a", page("A", `<a href="c">c</a>`))
+	mux.HandleFunc("/b", page("B", ""))
+	mux.HandleFunc("/c", page("C", `<a href="/d">d</a>`))
+	mux.HandleFunc("/d", page("D", ""))
+	mux.HandleFunc("/private/x", page("X", ""))
+	mux.HandleFunc("/private/open", page("Open", ""))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page("Home &amp; more", `<a href="/b#top">b</a> <a href='/private/x'>x</a> <a href=/private/open>o</a> <a href="https://other.example/">other</a> <a href="mailto:a@b.c">mail</a>`)(w, r)
+	})
+
+	var creates []*CreateDatasetsDocumentsReq
+	var deletes []int64
+	documents := newDatasetsDocuments(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/open_api/knowledge/document/list":
+			return mockResponse(http.StatusOK, &listDatasetsDocumentsResp{ListDatasetsDocumentsResp: &ListDatasetsDocumentsResp{Total: 3, DocumentInfos: []*Document{
+				{DocumentID: "10", SourceType: DocumentSourceTypeOnlineWeb},
+				{DocumentID: "11", SourceType: DocumentSourceTypeOnlineWeb},
+				{DocumentID: "12", SourceType: DocumentSourceTypeLocalFile},
+			}}})
+		case "/v1/datasets/1/process":
+			return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: []*DocumentProgress{
+				{DocumentID: "10", URL: site.URL + "/b"},
+				{DocumentID: "11", URL: site.URL + "/gone", DocumentName: "gone"},
+			}}})
+		case "/open_api/knowledge/document/create":
+			body := &CreateDatasetsDocumentsReq{}
+			as.Nil(json.NewDecoder(req.Body).Decode(body))
+			creates = append(creates, body)
+			var infos []*Document
+			for i := range body.DocumentBases {
+				infos = append(infos, &Document{DocumentID: fmt.Sprint(100 + i)})
+			}
+			return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{DocumentInfos: infos}})
+		case "/open_api/knowledge/document/delete":
+			body := &DeleteDatasetsDocumentsReq{}
+			as.Nil(json.NewDecoder(req.Body).Decode(body))
+			deletes = append(deletes, body.DocumentIDs...)
+			return mockResponse(http.StatusOK, &deleteDatasetsDocumentsResp{})
+		}
+		return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+	})))
+
+	t.Run("crawl", func(t *testing.T) {
+		resp, err := documents.Crawl(context.Background(), &CrawlDatasetsDocumentsReq{
+			DatasetID:      1,
+			SitemapURL:     site.URL + "/sitemap.xml",
+			MaxDepth:       1,
+			UpdateRule:     DocumentUpdateRuleBuildAutoUpdate(24),
+			RemoveVanished: true,
+		})
+		as.Nil(err)
+		as.Equal([]string{site.URL + "/", site.URL + "/a", site.URL + "/b", site.URL + "/private/open", site.URL + "/c"}, resp.Discovered)
+		as.Equal([]string{site.URL + "/b"}, resp.Existing)
+		as.Equal([]string{site.URL + "/private/x"}, resp.Blocked)
+
+		as.Len(creates, 1)
+		bases := creates[0].DocumentBases
+		as.Len(bases, 4)
+		as.Equal("Home & more", bases[0].Name)
+		as.Equal(site.URL+"/", *bases[0].SourceInfo.WebUrl)
+		as.Equal(DocumentUpdateTypeAutoUpdate, bases[0].UpdateRule.UpdateType)
+		as.Equal(24, bases[0].UpdateRule.UpdateInterval)
+		as.Len(resp.Created, 4)
+
+		as.Equal([]int64{11}, deletes)
+		as.Len(resp.Removed, 1)
+		as.Equal(site.URL+"/gone", resp.Removed[0].URL)
+	})
+
+	t.Run("dry run with seeds", func(t *testing.T) {
+		creates = nil
+		resp, err := documents.Crawl(context.Background(), &CrawlDatasetsDocumentsReq{
+			DatasetID: 1,
+			SeedURLs:  []string{site.URL + "/a"},
+			MaxDepth:  5,
+			MaxPages:  2,
+			DryRun:    true,
+		})
+		as.Nil(err)
+		as.Equal([]string{site.URL + "/a", site.URL + "/c"}, resp.Discovered)
+		as.Empty(creates)
+
+		// vanished documents are reported but not deleted
+		deletes = nil
+		resp, err = documents.Crawl(context.Background(), &CrawlDatasetsDocumentsReq{
+			DatasetID:      1,
+			SitemapURL:     site.URL + "/sitemap.xml",
+			RemoveVanished: true,
+			DryRun:         true,
+		})
+		as.Nil(err)
+		as.Empty(creates)
+		as.Empty(deletes)
+		as.Len(resp.Removed, 1)
+		as.Equal(site.URL+"/gone", resp.Removed[0].URL)
+	})
+
+	t.Run("robots", func(t *testing.T) {
+		rules := parseRobots("User-agent: *\nDisallow: /\n\nUser-agent: coze-go-crawler\nUser-agent: other\nDisallow: /tmp # comment\nAllow: /tmp/ok\n", defaultCrawlUserAgent)
+		as.True(rules.allowed("/"))
+		as.False(rules.allowed("/tmp/a"))
+		as.True(rules.allowed("/tmp/ok/1"))
+
+		rules = parseRobots("User-agent: *\nDisallow:\n", defaultCrawlUserAgent)
+		as.True(rules.allowed("/a"))
+
+		// a group for our agent which allows everything overrides the * group
+		rules = parseRobots("User-agent: *\nDisallow: /\n\nUser-agent: coze-go-crawler\nDisallow:\n", defaultCrawlUserAgent)
+		as.True(rules.allowed("/a"))
+
+		// an empty agent matches nobody
+		rules = parseRobots("User-agent:\nDisallow: /a\n\nUser-agent: *\nDisallow: /b\n", defaultCrawlUserAgent)
+		as.True(rules.allowed("/a"))
+		as.False(rules.allowed("/b"))
+	})
+
+	t.Run("normalize", func(t *testing.T) {
+		u, ok := normalizeCrawlURL("HTTPS://Example.com:443#x", nil)
+		as.True(ok)
+		as.Equal("https://example.com/", u)
+		_, ok = normalizeCrawlURL("javascript:void(0)", nil)
+		as.False(ok)
+	})
+}
@@ -0,0 +1,482 @@
+package coze
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sync 将本地目录同步到知识库
+//
+// 遍历目录并计算每个文件的 sha256，与 manifest 中记录的 path → document_id 映射以及
+// Documents.List 返回的线上文档对比：新增文件创建文档，内容变化的文件重新创建文档，
+// 本地删除的文件删除对应文档。不在 manifest 中的线上文档不会被修改。
+func (r *datasetsDocuments) Sync(ctx context.Context, req *SyncDatasetsDocumentsReq) (*SyncDatasetsDocumentsResp, error) {
+	manifestPath := req.ManifestPath
+	if manifestPath == "" {
+		manifestPath = filepath.Join(req.Dir, DocumentSyncManifestName)
+	}
+	manifest, err := LoadDocumentSyncManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.DatasetID != 0 && manifest.DatasetID != req.DatasetID {
+		return nil, fmt.Errorf("manifest %s belongs to dataset %d", manifestPath, manifest.DatasetID)
+	}
+	manifest.DatasetID = req.DatasetID
+
+	localFiles, err := scanDocumentSyncDir(req.Dir, manifestPath, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	remoteDocuments, err := r.listAll(ctx, req.DatasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SyncDatasetsDocumentsResp{
+		Plan:     planDocumentSync(localFiles, manifest, remoteDocuments),
+		Manifest: manifest,
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+
+	syncer := &documentSyncer{
+		documents: r,
+		files:     newFiles(r.client),
+		req:       req,
+		manifest:  manifest,
+		total:     len(resp.Plan),
+	}
+	syncer.run(ctx, resp.Plan)
+
+	if err := manifest.Save(manifestPath); err != nil {
+		return resp, err
+	}
+	if failed := resp.Failed(); len(failed) > 0 {
+		return resp, fmt.Errorf("%d documents failed to sync, first error: %s", len(failed), failed[0].Error)
+	}
+	return resp, nil
+}
+
+// DocumentSyncManifestName is the default manifest file name, it is stored in the synced directory.
+const DocumentSyncManifestName = ".coze_documents.json"
+
+// SyncDatasetsDocumentsReq represents request for syncing a local directory to a dataset
+type SyncDatasetsDocumentsReq struct {
+	// The ID of the knowledge base.
+	DatasetID int64
+
+	// The local directory to sync.
+	Dir string
+
+	// The path of the manifest, default is Dir/.coze_documents.json.
+	ManifestPath string
+
+	// Filter returns whether the file should be synced, path is relative to Dir and uses '/' as
+	// separator. All regular files are synced if nil.
+	Filter func(path string) bool
+
+	// Only compute the plan, do not modify the dataset or the manifest.
+	DryRun bool
+
+	// The maximum number of files processed at the same time, default is 3.
+	Concurrency int
+
+	// Upload the file through Files.Upload and create the document by file ID, otherwise the
+	// content is streamed as base64 through DocumentBaseBuildLocalFileReader.
+	UseFileID bool
+
+	// Do not delete the documents whose local files are removed.
+	KeepRemoved bool
+
+	// The chunk strategy used when creating documents.
+	ChunkStrategy *DocumentChunkStrategy
+
+	// Chunk strategy overrides, keyed by a path.Match pattern on the relative path, such as
+	// "faq/*.md". The first matched pattern in sorted order wins.
+	ChunkStrategyOverrides map[string]*DocumentChunkStrategy
+
+	// OnProgress is called after each plan item is processed.
+	OnProgress func(progress *DocumentSyncProgress)
+}
+
+// SyncDatasetsDocumentsResp represents response for syncing a local directory to a dataset
+type SyncDatasetsDocumentsResp struct {
+	// The plan, and the result of each item when not dry run.
+	Plan []*DocumentSyncPlanItem
+
+	// The manifest after syncing.
+	Manifest *DocumentSyncManifest
+}
+
+// Failed returns the failed plan items.
+func (r *SyncDatasetsDocumentsResp) Failed() []*DocumentSyncPlanItem {
+	var failed []*DocumentSyncPlanItem
+	for _, item := range r.Plan {
+		if item.Error != "" {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// Count returns the number of plan items with the action.
+func (r *SyncDatasetsDocumentsResp) Count(action DocumentSyncAction) int {
+	count := 0
+	for _, item := range r.Plan {
+		if item.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// DocumentSyncAction is the action taken on a file.
+type DocumentSyncAction string
+
+const (
+	DocumentSyncActionCreate    DocumentSyncAction = "create"
+	DocumentSyncActionUpdate    DocumentSyncAction = "update"
+	DocumentSyncActionDelete    DocumentSyncAction = "delete"
+	DocumentSyncActionUnchanged DocumentSyncAction = "unchanged"
+)
+
+// DocumentSyncPlanItem is a file in the sync plan.
+type DocumentSyncPlanItem struct {
+	Action DocumentSyncAction `json:"action"`
+
+	// The path relative to the synced directory, using '/' as separator.
+	Path string `json:"path"`
+
+	// The document currently mapped to the path.
+	DocumentID string `json:"document_id,omitempty"`
+
+	// The document created for the path.
+	NewDocumentID string `json:"new_document_id,omitempty"`
+
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// DocumentSyncProgress is reported by SyncDatasetsDocumentsReq.OnProgress.
+type DocumentSyncProgress struct {
+	Item  *DocumentSyncPlanItem
+	Done  int
+	Total int
+}
+
+// DocumentSyncManifest maps the synced files to documents.
+type DocumentSyncManifest struct {
+	DatasetID int64                                 `json:"dataset_id"`
+	Files     map[string]*DocumentSyncManifestEntry `json:"files"`
+}
+
+// DocumentSyncManifestEntry is a synced file.
+type DocumentSyncManifestEntry struct {
+	DocumentID string `json:"document_id"`
+	SHA256     string `json:"sha256"`
+	Size       int64  `json:"size"`
+	SyncedAt   int64  `json:"synced_at"`
+}
+
+// LoadDocumentSyncManifest loads a manifest, an empty manifest is returned if the file does
+// not exist.
+func LoadDocumentSyncManifest(path string) (*DocumentSyncManifest, error) {
+	manifest := &DocumentSyncManifest{Files: map[string]*DocumentSyncManifestEntry{}}
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]*DocumentSyncManifestEntry{}
+	}
+	return manifest, nil
+}
+
+// Save writes the manifest to path.
+func (m *DocumentSyncManifest) Save(path string) error {
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bs, 0o644)
+}
+
+type documentSyncFile struct {
+	path    string // relative, slash separated
+	absPath string
+	sha256  string
+	size    int64
+}
+
+func scanDocumentSyncDir(dir, manifestPath string, filter func(string) bool) (map[string]*documentSyncFile, error) {
+	absManifest, _ := filepath.Abs(manifestPath)
+	files := map[string]*documentSyncFile{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if abs, _ := filepath.Abs(p); abs == absManifest {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter != nil && !filter(rel) {
+			return nil
+		}
+		sum, size, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files[rel] = &documentSyncFile{path: rel, absPath: p, sha256: sum, size: size}
+		return nil
+	})
+	return files, err
+}
+
+func hashFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func planDocumentSync(localFiles map[string]*documentSyncFile, manifest *DocumentSyncManifest, remoteDocuments []*Document) []*DocumentSyncPlanItem {
+	remote := map[string]bool{}
+	for _, doc := range remoteDocuments {
+		remote[doc.DocumentID] = true
+	}
+
+	var plan []*DocumentSyncPlanItem
+	for rel, file := range localFiles {
+		item := &DocumentSyncPlanItem{Path: rel, SHA256: file.sha256, Size: file.size}
+		entry, ok := manifest.Files[rel]
+		switch {
+		case !ok || !remote[entry.DocumentID]:
+			item.Action = DocumentSyncActionCreate
+		case entry.SHA256 != file.sha256:
+			item.Action = DocumentSyncActionUpdate
+			item.DocumentID = entry.DocumentID
+		default:
+			item.Action = DocumentSyncActionUnchanged
+			item.DocumentID = entry.DocumentID
+		}
+		plan = append(plan, item)
+	}
+	for rel, entry := range manifest.Files {
+		if _, ok := localFiles[rel]; ok {
+			continue
+		}
+		item := &DocumentSyncPlanItem{Action: DocumentSyncActionDelete, Path: rel, SHA256: entry.SHA256, Size: entry.Size}
+		if remote[entry.DocumentID] {
+			item.DocumentID = entry.DocumentID
+		}
+		plan = append(plan, item)
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+	return plan
+}
+
+type documentSyncer struct {
+	documents *datasetsDocuments
+	files     *files
+	req       *SyncDatasetsDocumentsReq
+	total     int
+
+	mu       sync.Mutex
+	manifest *DocumentSyncManifest
+	done     int
+}
+
+func (s *documentSyncer) run(ctx context.Context, plan []*DocumentSyncPlanItem) {
+	concurrency := s.req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 3
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, item := range plan {
+		wg.Add(1)
+		go func(item *DocumentSyncPlanItem) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := s.apply(ctx, item); err != nil {
+				item.Error = err.Error()
+			}
+			s.mu.Lock()
+			s.done++
+			progress := &DocumentSyncProgress{Item: item, Done: s.done, Total: s.total}
+			s.mu.Unlock()
+			if s.req.OnProgress != nil {
+				s.req.OnProgress(progress)
+			}
+		}(item)
+	}
+	wg.Wait()
+}
+
+func (s *documentSyncer) apply(ctx context.Context, item *DocumentSyncPlanItem) error {
+	switch item.Action {
+	case DocumentSyncActionCreate, DocumentSyncActionUpdate:
+		documentID, err := s.create(ctx, item.Path)
+		if err != nil {
+			return err
+		}
+		item.NewDocumentID = documentID
+		s.setEntry(item.Path, &DocumentSyncManifestEntry{
+			DocumentID: documentID,
+			SHA256:     item.SHA256,
+			Size:       item.Size,
+			SyncedAt:   time.Now().Unix(),
+		})
+		if item.Action == DocumentSyncActionUpdate {
+			return s.delete(ctx, item.DocumentID)
+		}
+		return nil
+	case DocumentSyncActionDelete:
+		if s.req.KeepRemoved {
+			return nil
+		}
+		if item.DocumentID != "" {
+			if err := s.delete(ctx, item.DocumentID); err != nil {
+				return err
+			}
+		}
+		s.setEntry(item.Path, nil)
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (s *documentSyncer) create(ctx context.Context, rel string) (string, error) {
+	absPath := filepath.Join(s.req.Dir, filepath.FromSlash(rel))
+	fileType := strings.TrimPrefix(strings.ToLower(path.Ext(rel)), ".")
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var documentBase *DocumentBase
+	if s.req.UseFileID {
+		uploaded, err := s.files.Upload(ctx, &UploadFilesReq{File: NewUploadFile(f, path.Base(rel))})
+		if err != nil {
+			return "", err
+		}
+		fileID, err := strconv.ParseInt(uploaded.ID, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid file id %s: %w", uploaded.ID, err)
+		}
+		documentBase = DocumentBaseBuildUploadedFile(rel, fileID, fileType)
+	} else {
+		documentBase = DocumentBaseBuildLocalFileReader(rel, f, fileType)
+	}
+
+	resp, err := s.documents.Create(ctx, &CreateDatasetsDocumentsReq{
+		DatasetID:     s.req.DatasetID,
+		DocumentBases: []*DocumentBase{documentBase},
+		ChunkStrategy: s.chunkStrategy(rel),
+		FormatType:    DocumentFormatTypeDocument,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.DocumentInfos) == 0 {
+		return "", errors.New("no document created")
+	}
+	return resp.DocumentInfos[0].DocumentID, nil
+}
+
+func (s *documentSyncer) chunkStrategy(rel string) *DocumentChunkStrategy {
+	patterns := make([]string, 0, len(s.req.ChunkStrategyOverrides))
+	for pattern := range s.req.ChunkStrategyOverrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, rel); matched {
+			return s.req.ChunkStrategyOverrides[pattern]
+		}
+	}
+	return s.req.ChunkStrategy
+}
+
+func (s *documentSyncer) delete(ctx context.Context, documentID string) error {
+	id, err := strconv.ParseInt(documentID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid document id %s: %w", documentID, err)
+	}
+	_, err = s.documents.Delete(ctx, &DeleteDatasetsDocumentsReq{DocumentIDs: []int64{id}})
+	return err
+}
+
+func (s *documentSyncer) setEntry(rel string, entry *DocumentSyncManifestEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry == nil {
+		delete(s.manifest.Files, rel)
+		return
+	}
+	s.manifest.Files[rel] = entry
+}
+
+// listAll returns all documents of the dataset.
+func (r *datasetsDocuments) listAll(ctx context.Context, datasetID int64) ([]*Document, error) {
+	paged, err := r.List(ctx, &ListDatasetsDocumentsReq{DatasetID: datasetID, Size: 100})
+	if err != nil {
+		return nil, err
+	}
+	var documents []*Document
+	for paged.Next() {
+		documents = append(documents, paged.Current())
+	}
+	if paged.Err() != nil {
+		return nil, paged.Err()
+	}
+	return documents, nil
+}
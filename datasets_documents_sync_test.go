@@ -0,0 +1,169 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDocumentServer struct {
+	mu        sync.Mutex
+	nextID    int
+	documents map[string]*Document
+	creates   []*CreateDatasetsDocumentsReq
+	deletes   []int64
+	uploads   int
+}
+
+func newMockDocumentServer() *mockDocumentServer {
+	return &mockDocumentServer{nextID: 100, documents: map[string]*Document{}}
+}
+
+func (s *mockDocumentServer) roundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.URL.Path {
+	case "/open_api/knowledge/document/list":
+		docs := []*Document{}
+		for _, doc := range s.documents {
+			docs = append(docs, doc)
+		}
+		return mockResponse(http.StatusOK, &listDatasetsDocumentsResp{
+			ListDatasetsDocumentsResp: &ListDatasetsDocumentsResp{Total: int64(len(docs)), DocumentInfos: docs},
+		})
+	case "/open_api/knowledge/document/create":
+		body := &CreateDatasetsDocumentsReq{}
+		if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+			return nil, err
+		}
+		s.creates = append(s.creates, body)
+		var infos []*Document
+		for _, base := range body.DocumentBases {
+			s.nextID++
+			doc := &Document{DocumentID: strconv.Itoa(s.nextID), Name: base.Name, FormatType: body.FormatType}
+			if base.SourceInfo != nil && base.SourceInfo.WebUrl != nil {
+				doc.SourceType = DocumentSourceTypeOnlineWeb
+			}
+			s.documents[doc.DocumentID] = doc
+			infos = append(infos, doc)
+		}
+		return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{
+			CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{DocumentInfos: infos},
+		})
+	case "/open_api/knowledge/document/delete":
+		body := &DeleteDatasetsDocumentsReq{}
+		if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+			return nil, err
+		}
+		for _, id := range body.DocumentIDs {
+			s.deletes = append(s.deletes, id)
+			delete(s.documents, strconv.FormatInt(id, 10))
+		}
+		return mockResponse(http.StatusOK, &deleteDatasetsDocumentsResp{})
+	case "/v1/files/upload":
+		s.uploads++
+		return mockResponse(http.StatusOK, &uploadFilesResp{
+			Data: &UploadFilesResp{FileInfo: FileInfo{ID: strconv.Itoa(9000 + s.uploads)}},
+		})
+	}
+	return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+}
+
+func TestDatasetsDocumentsSync(t *testing.T) {
+	as := assert.New(t)
+	server := newMockDocumentServer()
+	documents := newDatasetsDocuments(newCoreWithTransport(newMockTransport(server.roundTrip)))
+
+	dir := t.TempDir()
+	as.Nil(os.MkdirAll(filepath.Join(dir, "faq"), 0o755))
+	as.Nil(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644))
+	as.Nil(os.WriteFile(filepath.Join(dir, "faq", "b.md"), []byte("b"), 0o644))
+	as.Nil(os.WriteFile(filepath.Join(dir, ".hidden"), []byte("h"), 0o644))
+
+	var progress []*DocumentSyncProgress
+	var mu sync.Mutex
+	req := &SyncDatasetsDocumentsReq{
+		DatasetID: 1,
+		Dir:       dir,
+		ChunkStrategyOverrides: map[string]*DocumentChunkStrategy{
+			"faq/*.md": {ChunkType: 1, Separator: "##", MaxTokens: 500},
+		},
+		OnProgress: func(p *DocumentSyncProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, p)
+		},
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		req.DryRun = true
+		defer func() { req.DryRun = false }()
+		resp, err := documents.Sync(context.Background(), req)
+		as.Nil(err)
+		as.Equal(2, resp.Count(DocumentSyncActionCreate))
+		as.Empty(server.creates)
+		_, err = os.Stat(filepath.Join(dir, DocumentSyncManifestName))
+		as.True(os.IsNotExist(err))
+	})
+
+	t.Run("initial sync", func(t *testing.T) {
+		resp, err := documents.Sync(context.Background(), req)
+		as.Nil(err)
+		as.Equal(2, resp.Count(DocumentSyncActionCreate))
+		as.Len(server.creates, 2)
+		as.Len(progress, 2)
+		as.Equal(2, progress[1].Done)
+		for _, create := range server.creates {
+			if create.DocumentBases[0].Name == "faq/b.md" {
+				as.Equal("##", create.ChunkStrategy.Separator)
+				as.Equal("md", *create.DocumentBases[0].SourceInfo.FileType)
+			} else {
+				as.Nil(create.ChunkStrategy)
+			}
+		}
+		manifest, err := LoadDocumentSyncManifest(filepath.Join(dir, DocumentSyncManifestName))
+		as.Nil(err)
+		as.Len(manifest.Files, 2)
+		as.Equal(int64(1), manifest.DatasetID)
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		as.Nil(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a2"), 0o644))
+		as.Nil(os.Remove(filepath.Join(dir, "faq", "b.md")))
+		as.Nil(os.WriteFile(filepath.Join(dir, "c.pdf"), []byte("c"), 0o644))
+
+		before := len(server.creates)
+		req.UseFileID = true
+		resp, err := documents.Sync(context.Background(), req)
+		as.Nil(err)
+		as.Equal(1, resp.Count(DocumentSyncActionCreate))
+		as.Equal(1, resp.Count(DocumentSyncActionUpdate))
+		as.Equal(1, resp.Count(DocumentSyncActionDelete))
+		as.Len(server.creates, before+2)
+		as.Equal(2, server.uploads)
+		as.Len(server.deletes, 2)
+		as.NotNil(server.creates[before].DocumentBases[0].SourceInfo.SourceFileID)
+		as.Len(server.documents, 2)
+		as.Len(resp.Manifest.Files, 2)
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		resp, err := documents.Sync(context.Background(), req)
+		as.Nil(err)
+		as.Equal(2, resp.Count(DocumentSyncActionUnchanged))
+	})
+
+	t.Run("manifest of another dataset", func(t *testing.T) {
+		_, err := documents.Sync(context.Background(), &SyncDatasetsDocumentsReq{DatasetID: 2, Dir: dir})
+		as.NotNil(err)
+		as.True(strings.Contains(err.Error(), "belongs to dataset"))
+	})
+}
@@ -0,0 +1,464 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CreateTable uploads the table as spreadsheet documents. Large tables are split into several
+// documents by MaxBytes and MaxRows, each document repeats the header row.
+func (r *datasetsDocuments) CreateTable(ctx context.Context, req *CreateTableDocumentsReq) (*CreateTableDocumentsResp, error) {
+	if req.Table == nil {
+		return nil, errors.New("table is required")
+	}
+	if err := req.Table.Validate(); err != nil {
+		return nil, err
+	}
+	batches, err := req.Table.Split(req.MaxBytes, req.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CreateTableDocumentsResp{}
+	for i, batch := range batches {
+		content, err := batch.CSV()
+		if err != nil {
+			return resp, err
+		}
+		name := batch.Name
+		if len(batches) > 1 {
+			name = fmt.Sprintf("%s (%d)", strings.TrimSuffix(batch.Name, ".csv"), i+1)
+		}
+		if !strings.HasSuffix(name, ".csv") {
+			name += ".csv"
+		}
+		created, err := r.Create(ctx, &CreateDatasetsDocumentsReq{
+			DatasetID:     req.DatasetID,
+			DocumentBases: []*DocumentBase{DocumentBaseBuildLocalFileReader(name, bytes.NewReader(content), "csv")},
+			ChunkStrategy: req.ChunkStrategy,
+			FormatType:    DocumentFormatTypeSpreadsheet,
+		})
+		if err != nil {
+			return resp, err
+		}
+		resp.Documents = append(resp.Documents, created.DocumentInfos...)
+	}
+	return resp, nil
+}
+
+// AppendTableRows appends rows to an existing spreadsheet document. The open API can neither add
+// rows to a document nor return its content, so the document is replaced: Existing, the current
+// content of the document such as the table it was uploaded from, is merged with Rows and uploaded
+// under the name of the document, then the old document is deleted. The old document is kept if the
+// upload fails.
+func (r *datasetsDocuments) AppendTableRows(ctx context.Context, req *AppendTableRowsReq) (*AppendTableRowsResp, error) {
+	if req.Existing == nil || req.Rows == nil {
+		return nil, errors.New("existing table and rows are required")
+	}
+	if err := req.Existing.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid existing table: %w", err)
+	}
+	columns := make([]string, 0, len(req.Existing.Columns))
+	for _, column := range req.Existing.Columns {
+		columns = append(columns, column.Name)
+	}
+	rows, err := req.Rows.Reorder(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := r.listAll(ctx, req.DatasetID)
+	if err != nil {
+		return nil, err
+	}
+	var document *Document
+	for _, doc := range documents {
+		if doc.DocumentID == strconv.FormatInt(req.DocumentID, 10) {
+			document = doc
+			break
+		}
+	}
+	if document == nil {
+		return nil, fmt.Errorf("document %d not found", req.DocumentID)
+	}
+	if document.FormatType != DocumentFormatTypeSpreadsheet {
+		return nil, fmt.Errorf("document %d is not a spreadsheet", req.DocumentID)
+	}
+
+	merged := &DocumentTable{
+		Name:    strings.TrimSuffix(document.Name, filepath.Ext(document.Name)),
+		Columns: req.Existing.Columns,
+		Rows:    append(append([][]string{}, req.Existing.Rows...), rows.Rows...),
+	}
+	created, err := r.CreateTable(ctx, &CreateTableDocumentsReq{
+		DatasetID:     req.DatasetID,
+		Table:         merged,
+		MaxBytes:      req.MaxBytes,
+		MaxRows:       req.MaxRows,
+		ChunkStrategy: req.ChunkStrategy,
+	})
+	resp := &AppendTableRowsResp{}
+	if created != nil {
+		resp.Documents = created.Documents
+	}
+	if err != nil {
+		return resp, err
+	}
+	if _, err := r.Delete(ctx, &DeleteDatasetsDocumentsReq{DocumentIDs: []int64{req.DocumentID}}); err != nil {
+		return resp, fmt.Errorf("delete replaced document %d: %w", req.DocumentID, err)
+	}
+	return resp, nil
+}
+
+// CreateTableDocumentsReq represents request for uploading a table
+type CreateTableDocumentsReq struct {
+	// The ID of the table knowledge base.
+	DatasetID int64
+
+	Table *DocumentTable
+
+	// The maximum CSV size of a document in bytes, default is 10MB.
+	MaxBytes int
+
+	// The maximum number of rows of a document, 0 means no limit.
+	MaxRows int
+
+	// The chunk strategy, only needed for the first upload to the dataset.
+	ChunkStrategy *DocumentChunkStrategy
+}
+
+// AppendTableRowsReq represents request for appending rows to a spreadsheet document
+type AppendTableRowsReq struct {
+	// The ID of the table knowledge base.
+	DatasetID int64
+
+	// The ID of the spreadsheet document.
+	DocumentID int64
+
+	// The current content of the document, which the API does not return.
+	Existing *DocumentTable
+
+	// The rows to append. Their columns are reordered to the columns of Existing, missing columns
+	// are left empty and unknown columns are an error.
+	Rows *DocumentTable
+
+	MaxBytes      int
+	MaxRows       int
+	ChunkStrategy *DocumentChunkStrategy
+}
+
+// AppendTableRowsResp represents response for appending rows to a spreadsheet document
+type AppendTableRowsResp struct {
+	// The documents which replace the document, more than one if the merged table is split.
+	Documents []*Document
+}
+
+// CreateTableDocumentsResp represents response for uploading a table
+type CreateTableDocumentsResp struct {
+	Documents []*Document
+}
+
+// DocumentTableColumn represents a column of a table
+type DocumentTableColumn struct {
+	Name string
+}
+
+// DocumentTable represents the content of a spreadsheet document
+type DocumentTable struct {
+	// The document name.
+	Name    string
+	Columns []*DocumentTableColumn
+	Rows    [][]string
+}
+
+// DocumentTableOption configures how a table is read
+type DocumentTableOption func(*documentTableOption)
+
+type documentTableOption struct {
+	noHeader bool
+	columns  []string
+}
+
+// WithTableNoHeader treats the first row as data, the columns are named column_1, column_2...
+// unless WithTableColumns is set.
+func WithTableNoHeader() DocumentTableOption {
+	return func(opt *documentTableOption) {
+		opt.noHeader = true
+	}
+}
+
+// WithTableColumns sets the column names, the header row is replaced if present.
+func WithTableColumns(columns ...string) DocumentTableOption {
+	return func(opt *documentTableOption) {
+		opt.columns = columns
+	}
+}
+
+// NewDocumentTableFromCSV reads a table from CSV
+func NewDocumentTableFromCSV(name string, reader io.Reader, opts ...DocumentTableOption) (*DocumentTable, error) {
+	return newDocumentTableFromDelimited(name, reader, ',', opts...)
+}
+
+// NewDocumentTableFromTSV reads a table from TSV
+func NewDocumentTableFromTSV(name string, reader io.Reader, opts ...DocumentTableOption) (*DocumentTable, error) {
+	return newDocumentTableFromDelimited(name, reader, '\t', opts...)
+}
+
+// NewDocumentTableFromStructs builds a table from a slice of structs. The columns are the exported
+// fields, named by their json tag, fields tagged with "-" are skipped. Time values are formatted as
+// "2006-01-02 15:04:05" and nil pointers are empty.
+func NewDocumentTableFromStructs[T any](name string, rows []T) (*DocumentTable, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("rows must be structs, got %s", typ.Kind())
+	}
+
+	var fields []int
+	var columns []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		column := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			column = tag
+		}
+		fields = append(fields, i)
+		columns = append(columns, column)
+	}
+
+	table := &DocumentTable{Name: name}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, &DocumentTableColumn{Name: column})
+	}
+	for _, row := range rows {
+		value := reflect.ValueOf(row)
+		for value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		record := make([]string, len(fields))
+		if value.Kind() == reflect.Struct {
+			for i, field := range fields {
+				record[i] = formatTableValue(value.Field(field))
+			}
+		}
+		table.Rows = append(table.Rows, record)
+	}
+	return table, nil
+}
+
+// Validate checks the columns are named and unique, and every row has one value per column
+func (t *DocumentTable) Validate() error {
+	if len(t.Columns) == 0 {
+		return errors.New("table has no columns")
+	}
+	seen := map[string]bool{}
+	for i, column := range t.Columns {
+		if strings.TrimSpace(column.Name) == "" {
+			return fmt.Errorf("column %d has no name", i+1)
+		}
+		if seen[column.Name] {
+			return fmt.Errorf("duplicate column %s", column.Name)
+		}
+		seen[column.Name] = true
+	}
+	for i, row := range t.Rows {
+		if len(row) != len(t.Columns) {
+			return fmt.Errorf("row %d has %d values, expected %d", i+1, len(row), len(t.Columns))
+		}
+	}
+	return nil
+}
+
+// CSV encodes the header and rows as CSV
+func (t *DocumentTable) CSV() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	header := make([]string, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		header = append(header, column.Name)
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	if err := writer.WriteAll(t.Rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Split splits the rows into tables whose CSV is at most maxBytes (default 10MB) and which have at
+// most maxRows rows (0 means no limit).
+func (t *DocumentTable) Split(maxBytes, maxRows int) ([]*DocumentTable, error) {
+	if maxBytes <= 0 {
+		maxBytes = 10 << 20
+	}
+	header, err := (&DocumentTable{Columns: t.Columns}).CSV()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*DocumentTable
+	current := &DocumentTable{Name: t.Name, Columns: t.Columns}
+	size := len(header)
+	for i, row := range t.Rows {
+		encoded, err := encodeTableRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if len(header)+len(encoded) > maxBytes {
+			return nil, fmt.Errorf("row %d is larger than %d bytes", i+1, maxBytes)
+		}
+		if len(current.Rows) > 0 && (size+len(encoded) > maxBytes || (maxRows > 0 && len(current.Rows) >= maxRows)) {
+			tables = append(tables, current)
+			current = &DocumentTable{Name: t.Name, Columns: t.Columns}
+			size = len(header)
+		}
+		current.Rows = append(current.Rows, row)
+		size += len(encoded)
+	}
+	return append(tables, current), nil
+}
+
+// Reorder returns a table with the given columns, missing columns are left empty
+func (t *DocumentTable) Reorder(columns []string) (*DocumentTable, error) {
+	index := map[string]int{}
+	for i, column := range t.Columns {
+		index[column.Name] = i
+	}
+	known := map[string]bool{}
+	for _, column := range columns {
+		known[column] = true
+	}
+	for _, column := range t.Columns {
+		if !known[column.Name] {
+			return nil, fmt.Errorf("column %s does not exist in the table", column.Name)
+		}
+	}
+
+	table := &DocumentTable{Name: t.Name}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, &DocumentTableColumn{Name: column})
+	}
+	for _, row := range t.Rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			if j, ok := index[column]; ok && j < len(row) {
+				record[i] = row[j]
+			}
+		}
+		table.Rows = append(table.Rows, record)
+	}
+	return table, nil
+}
+
+func encodeTableRow(row []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	if err := writer.Write(row); err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func newDocumentTableFromDelimited(name string, reader io.Reader, comma rune, opts ...DocumentTableOption) (*DocumentTable, error) {
+	opt := &documentTableOption{}
+	for _, o := range opts {
+		o(opt)
+	}
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = comma
+	csvReader.FieldsPerRecord = -1
+	if comma == '\t' {
+		csvReader.LazyQuotes = true
+	}
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	width := len(opt.columns)
+	for _, record := range records {
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+	var header []string
+	if !opt.noHeader && len(records) > 0 {
+		header, records = records[0], records[1:]
+	}
+	if len(opt.columns) > 0 {
+		header = opt.columns
+	}
+
+	table := &DocumentTable{Name: name}
+	for i := 0; i < width; i++ {
+		column := ""
+		if i < len(header) {
+			column = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+		}
+		if column == "" {
+			column = "column_" + strconv.Itoa(i+1)
+		}
+		table.Columns = append(table.Columns, &DocumentTableColumn{Name: column})
+	}
+	for _, record := range records {
+		if isEmptyTableRow(record) {
+			continue
+		}
+		row := make([]string, width)
+		copy(row, record)
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+func isEmptyTableRow(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func formatTableValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return mustToJson(v.Interface())
+	}
+	return reflectToString(v)
+}
@@ -0,0 +1,186 @@
+package coze
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentTable(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("csv", func(t *testing.T) {
+		table, err := NewDocumentTableFromCSV("faq", strings.NewReader("\ufeffid,name,price,on_sale,created\n1,\"a, b\",1.5,true,2024-01-02\n\n2,c,3,false,\n"))
+		as.Nil(err)
+		as.Equal("id", table.Columns[0].Name)
+		as.Len(table.Rows, 2)
+		as.Nil(table.Validate())
+
+		content, err := table.CSV()
+		as.Nil(err)
+		as.Equal("id,name,price,on_sale,created\n1,\"a, b\",1.5,true,2024-01-02\n2,c,3,false,\n", string(content))
+	})
+
+	t.Run("tsv without header", func(t *testing.T) {
+		table, err := NewDocumentTableFromTSV("faq", strings.NewReader("q1\ta1\nq2\ta2\textra\n"), WithTableNoHeader())
+		as.Nil(err)
+		as.Equal("column_1", table.Columns[0].Name)
+		as.Equal("column_3", table.Columns[2].Name)
+		as.Equal([]string{"q1", "a1", ""}, table.Rows[0])
+
+		table, err = NewDocumentTableFromTSV("faq", strings.NewReader("q\ta\nq1\ta1\n"), WithTableColumns("question", "answer"))
+		as.Nil(err)
+		as.Equal("question", table.Columns[0].Name)
+		as.Len(table.Rows, 1)
+	})
+
+	t.Run("structs", func(t *testing.T) {
+		type product struct {
+			ID      int64     `json:"id"`
+			Name    string    `json:"name,omitempty"`
+			Price   *float64  `json:"price"`
+			Created time.Time `json:"created"`
+			Tags    []string
+			Secret  string `json:"-"`
+			hidden  string
+		}
+		table, err := NewDocumentTableFromStructs("products", []*product{
+			{ID: 1, Name: "a", Price: ptr(2.5), Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Tags: []string{"x"}, hidden: "h"},
+			{ID: 2, Name: "b"},
+		})
+		as.Nil(err)
+		as.Equal([]string{"1", "a", "2.5", "2024-01-02 03:04:05", `["x"]`}, table.Rows[0])
+		as.Equal([]string{"2", "b", "", "", "null"}, table.Rows[1])
+		as.Equal("Tags", table.Columns[4].Name)
+
+		_, err = NewDocumentTableFromStructs("ints", []int{1})
+		as.NotNil(err)
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		table := &DocumentTable{Columns: []*DocumentTableColumn{{Name: "a"}, {Name: "a"}}}
+		as.NotNil(table.Validate())
+		table = &DocumentTable{Columns: []*DocumentTableColumn{{Name: "a"}}, Rows: [][]string{{"1", "2"}}}
+		as.NotNil(table.Validate())
+	})
+
+	t.Run("split", func(t *testing.T) {
+		table := &DocumentTable{Name: "t", Columns: []*DocumentTableColumn{{Name: "a"}}}
+		for i := 0; i < 10; i++ {
+			table.Rows = append(table.Rows, []string{fmt.Sprint(i)})
+		}
+		tables, err := table.Split(2+2*4, 0)
+		as.Nil(err)
+		as.Len(tables, 3)
+		as.Len(tables[0].Rows, 4)
+		as.Len(tables[2].Rows, 2)
+
+		tables, err = table.Split(0, 3)
+		as.Nil(err)
+		as.Len(tables, 4)
+
+		_, err = table.Split(3, 0)
+		as.NotNil(err)
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		table := &DocumentTable{Columns: []*DocumentTableColumn{{Name: "b"}, {Name: "a"}}, Rows: [][]string{{"2", "1"}}}
+		reordered, err := table.Reorder([]string{"a", "b", "c"})
+		as.Nil(err)
+		as.Equal([]string{"1", "2", ""}, reordered.Rows[0])
+		_, err = table.Reorder([]string{"a"})
+		as.NotNil(err)
+	})
+}
+
+func TestDatasetsDocumentsCreateTable(t *testing.T) {
+	as := assert.New(t)
+
+	var creates []*CreateDatasetsDocumentsReq
+	var paths []string
+	var deleted []int64
+	documents := newDatasetsDocuments(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		switch req.URL.Path {
+		case "/open_api/knowledge/document/list":
+			return mockResponse(http.StatusOK, &listDatasetsDocumentsResp{ListDatasetsDocumentsResp: &ListDatasetsDocumentsResp{
+				Total: 2,
+				DocumentInfos: []*Document{
+					{DocumentID: "100", Name: "faq.xlsx", FormatType: DocumentFormatTypeSpreadsheet},
+					{DocumentID: "101", Name: "guide.pdf", FormatType: DocumentFormatTypeDocument},
+				},
+			}})
+		case "/open_api/knowledge/document/delete":
+			body := &DeleteDatasetsDocumentsReq{}
+			as.Nil(json.NewDecoder(req.Body).Decode(body))
+			deleted = append(deleted, body.DocumentIDs...)
+			return mockResponse(http.StatusOK, &deleteDatasetsDocumentsResp{Data: &DeleteDatasetsDocumentsResp{}})
+		}
+		body := &CreateDatasetsDocumentsReq{}
+		as.Nil(json.NewDecoder(req.Body).Decode(body))
+		creates = append(creates, body)
+		return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{
+			DocumentInfos: []*Document{{DocumentID: fmt.Sprint(len(creates))}},
+		}})
+	})))
+	decode := func(base *DocumentBase) string {
+		content, err := base64.StdEncoding.DecodeString(*base.SourceInfo.FileBase64)
+		as.Nil(err)
+		return string(content)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		creates = nil
+		table, err := NewDocumentTableFromCSV("faq.csv", strings.NewReader("q,a\nq1,a1\nq2,a2\nq3,a3\n"))
+		as.Nil(err)
+		resp, err := documents.CreateTable(context.Background(), &CreateTableDocumentsReq{DatasetID: 1, Table: table, MaxRows: 2})
+		as.Nil(err)
+		as.Len(resp.Documents, 2)
+		as.Len(creates, 2)
+		as.Equal(DocumentFormatTypeSpreadsheet, creates[0].FormatType)
+		as.Equal("faq (1).csv", creates[0].DocumentBases[0].Name)
+		as.Equal("csv", *creates[0].DocumentBases[0].SourceInfo.FileType)
+		as.Equal("q,a\nq1,a1\nq2,a2\n", decode(creates[0].DocumentBases[0]))
+		as.Equal("q,a\nq3,a3\n", decode(creates[1].DocumentBases[0]))
+	})
+
+	t.Run("append rows", func(t *testing.T) {
+		creates, paths, deleted = nil, nil, nil
+		existing, err := NewDocumentTableFromCSV("faq", strings.NewReader("q,a\nq1,a1\n"))
+		as.Nil(err)
+		rows, err := NewDocumentTableFromCSV("more", strings.NewReader("a,q\na2,q2\n"))
+		as.Nil(err)
+		resp, err := documents.AppendTableRows(context.Background(), &AppendTableRowsReq{DatasetID: 1, DocumentID: 100, Existing: existing, Rows: rows})
+		as.Nil(err)
+		// the document is replaced by a document holding the old and the new rows
+		as.Equal([]string{
+			"/open_api/knowledge/document/list",
+			"/open_api/knowledge/document/create",
+			"/open_api/knowledge/document/delete",
+		}, paths)
+		as.Len(resp.Documents, 1)
+		as.Equal("1", resp.Documents[0].DocumentID)
+		as.Equal(int64(1), creates[0].DatasetID)
+		as.Equal("faq.csv", creates[0].DocumentBases[0].Name)
+		as.Equal("q,a\nq1,a1\nq2,a2\n", decode(creates[0].DocumentBases[0]))
+		as.Equal([]int64{100}, deleted)
+
+		creates, deleted = nil, nil
+		_, err = documents.AppendTableRows(context.Background(), &AppendTableRowsReq{DatasetID: 1, DocumentID: 101, Existing: existing, Rows: rows})
+		as.NotNil(err)
+		_, err = documents.AppendTableRows(context.Background(), &AppendTableRowsReq{DatasetID: 1, DocumentID: 102, Existing: existing, Rows: rows})
+		as.NotNil(err)
+		unknown := &DocumentTable{Columns: []*DocumentTableColumn{{Name: "x"}}, Rows: [][]string{{"1"}}}
+		_, err = documents.AppendTableRows(context.Background(), &AppendTableRowsReq{DatasetID: 1, DocumentID: 100, Existing: existing, Rows: unknown})
+		as.NotNil(err)
+		as.Empty(creates)
+		as.Empty(deleted)
+	})
+}
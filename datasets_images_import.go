@@ -0,0 +1,519 @@
+package coze
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Import uploads the images to an image dataset and sets their captions
+//
+// The images are uploaded through Files.Upload concurrently, created as image documents in
+// batches, and the captions are applied through Update after the documents are processed.
+func (r *datasetsImages) Import(ctx context.Context, req *ImportDatasetsImagesReq) (*ImportDatasetsImagesResp, error) {
+	items, err := req.items()
+	if err != nil {
+		return nil, err
+	}
+	importer := &imageImporter{
+		images:   r,
+		datasets: newDatasets(r.client),
+		files:    newFiles(r.client),
+		req:      req,
+		total:    len(items),
+	}
+	resp := &ImportDatasetsImagesResp{Items: items}
+
+	importer.upload(ctx, items)
+	if err := importer.create(ctx, items); err != nil {
+		return resp, err
+	}
+	if err := importer.wait(ctx, items); err != nil {
+		return resp, err
+	}
+	importer.applyCaptions(ctx, items)
+
+	if failed := resp.Failed(); len(failed) > 0 {
+		return resp, fmt.Errorf("%d images failed to import, first error: %s", len(failed), failed[0].Error)
+	}
+	return resp, nil
+}
+
+// ExportCaptions writes the captions and statuses of all images in the dataset to w as CSV with
+// the header document_id,name,caption,status. The file can be edited and applied by ApplyCaptions.
+func (r *datasetsImages) ExportCaptions(ctx context.Context, datasetID string, w io.Writer) error {
+	images, err := r.listAll(ctx, datasetID)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"document_id", "name", "caption", "status"}); err != nil {
+		return err
+	}
+	for _, image := range images {
+		if err := writer.Write([]string{image.DocumentID, image.Name, image.Caption, image.Status.String()}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ApplyCaptions reads a CSV with the document_id and caption columns, such as the one written by
+// ExportCaptions, and updates the images whose caption changed. It returns the updated document IDs.
+func (r *datasetsImages) ApplyCaptions(ctx context.Context, datasetID string, reader io.Reader) ([]string, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := csvColumns(records[0])
+	idColumn, ok := columns["document_id"]
+	if !ok {
+		return nil, errors.New("document_id column is required")
+	}
+	captionColumn, ok := columns["caption"]
+	if !ok {
+		return nil, errors.New("caption column is required")
+	}
+
+	images, err := r.listAll(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]string{}
+	for _, image := range images {
+		current[image.DocumentID] = image.Caption
+	}
+
+	var updated []string
+	for _, record := range records[1:] {
+		if idColumn >= len(record) || captionColumn >= len(record) {
+			continue
+		}
+		documentID, caption := record[idColumn], record[captionColumn]
+		if existing, ok := current[documentID]; !ok || existing == caption {
+			continue
+		}
+		if _, err := r.Update(ctx, &UpdateDatasetImageReq{
+			DatasetID:  datasetID,
+			DocumentID: documentID,
+			Caption:    &caption,
+		}); err != nil {
+			return updated, err
+		}
+		updated = append(updated, documentID)
+	}
+	return updated, nil
+}
+
+// ImportDatasetsImagesReq represents request for importing images to a dataset
+type ImportDatasetsImagesReq struct {
+	// The ID of the image knowledge base.
+	DatasetID string
+
+	// Import the images in the directory, the caption of a.png is read from a.txt if it exists.
+	Dir string
+
+	// Import the images listed in the CSV file. The file has the path and caption columns, or
+	// path and caption as the first two fields if there is no header. Relative paths are resolved
+	// against the directory of the CSV file.
+	CSVPath string
+
+	// Import the images directly.
+	Images []*ImageImportItem
+
+	// The maximum number of images uploaded at the same time, default is 3.
+	Concurrency int
+
+	// The number of images created in one request, default and maximum is 10.
+	BatchSize int
+
+	// Options for waiting the documents to be processed.
+	WaitOptions []WaitForDocumentsOption
+
+	// OnProgress is called after each image is uploaded, created, processed or captioned.
+	OnProgress func(progress *ImageImportProgress)
+}
+
+// ImageImportItem represents an image to import and its result
+type ImageImportItem struct {
+	// The local path of the image.
+	Path string
+
+	// The document name, default is the file name.
+	Name string
+
+	Caption string
+
+	// Set after the image is uploaded and created.
+	FileID     string
+	DocumentID string
+	Status     ImageStatus
+
+	Error string
+}
+
+// ImageImportStage is the stage of an image import
+type ImageImportStage string
+
+const (
+	ImageImportStageUploaded  ImageImportStage = "uploaded"
+	ImageImportStageCreated   ImageImportStage = "created"
+	ImageImportStageProcessed ImageImportStage = "processed"
+	ImageImportStageCaptioned ImageImportStage = "captioned"
+)
+
+// ImageImportProgress represents the progress of an image import
+type ImageImportProgress struct {
+	Stage ImageImportStage
+	Item  *ImageImportItem
+	Done  int
+	Total int
+}
+
+// ImportDatasetsImagesResp represents response for importing images
+type ImportDatasetsImagesResp struct {
+	Items []*ImageImportItem
+}
+
+// Failed returns the images which failed to import
+func (r *ImportDatasetsImagesResp) Failed() []*ImageImportItem {
+	var failed []*ImageImportItem
+	for _, item := range r.Items {
+		if item.Error != "" {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// String returns the name of the status
+func (s ImageStatus) String() string {
+	switch s {
+	case ImageStatusInProcessing:
+		return "processing"
+	case ImageStatusCompleted:
+		return "completed"
+	case ImageStatusProcessingFailed:
+		return "failed"
+	}
+	return strconv.Itoa(int(s))
+}
+
+var imageFileExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true,
+}
+
+func (r *ImportDatasetsImagesReq) items() ([]*ImageImportItem, error) {
+	items := append([]*ImageImportItem{}, r.Images...)
+	if r.Dir != "" {
+		dirItems, err := scanImageDir(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, dirItems...)
+	}
+	if r.CSVPath != "" {
+		csvItems, err := readImageCSV(r.CSVPath)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, csvItems...)
+	}
+	for _, item := range items {
+		if item.Name == "" {
+			item.Name = filepath.Base(item.Path)
+		}
+	}
+	return items, nil
+}
+
+func scanImageDir(dir string) ([]*ImageImportItem, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var items []*ImageImportItem
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !imageFileExts[ext] {
+			continue
+		}
+		item := &ImageImportItem{Path: filepath.Join(dir, entry.Name())}
+		caption, err := os.ReadFile(strings.TrimSuffix(item.Path, filepath.Ext(item.Path)) + ".txt")
+		if err == nil {
+			item.Caption = strings.TrimSpace(string(caption))
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+func readImageCSV(p string) ([]*ImageImportItem, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	pathColumn, captionColumn, nameColumn := 0, 1, -1
+	columns := csvColumns(records[0])
+	if column, ok := columns["path"]; ok {
+		pathColumn, captionColumn, nameColumn = column, -1, -1
+		if column, ok := columns["caption"]; ok {
+			captionColumn = column
+		}
+		if column, ok := columns["name"]; ok {
+			nameColumn = column
+		}
+		records = records[1:]
+	}
+
+	field := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+	var items []*ImageImportItem
+	for _, record := range records {
+		imagePath := field(record, pathColumn)
+		if imagePath == "" {
+			continue
+		}
+		if !filepath.IsAbs(imagePath) {
+			imagePath = filepath.Join(filepath.Dir(p), imagePath)
+		}
+		items = append(items, &ImageImportItem{
+			Path:    imagePath,
+			Name:    field(record, nameColumn),
+			Caption: field(record, captionColumn),
+		})
+	}
+	return items, nil
+}
+
+func csvColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return columns
+}
+
+func (r *datasetsImages) listAll(ctx context.Context, datasetID string) ([]*Image, error) {
+	paged, err := r.List(ctx, &ListDatasetsImagesReq{DatasetID: datasetID, PageSize: 100})
+	if err != nil {
+		return nil, err
+	}
+	var images []*Image
+	for paged.Next() {
+		images = append(images, paged.Current())
+	}
+	return images, paged.Err()
+}
+
+type imageImporter struct {
+	images   *datasetsImages
+	datasets *datasets
+	files    *files
+	req      *ImportDatasetsImagesReq
+	total    int
+
+	mu   sync.Mutex
+	done map[ImageImportStage]int
+}
+
+func (s *imageImporter) report(stage ImageImportStage, item *ImageImportItem) {
+	if s.req.OnProgress == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.done == nil {
+		s.done = map[ImageImportStage]int{}
+	}
+	s.done[stage]++
+	progress := &ImageImportProgress{Stage: stage, Item: item, Done: s.done[stage], Total: s.total}
+	s.mu.Unlock()
+	s.req.OnProgress(progress)
+}
+
+func (s *imageImporter) upload(ctx context.Context, items []*ImageImportItem) {
+	concurrency := s.req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 3
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		if item.FileID != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(item *ImageImportItem) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := s.uploadOne(ctx, item); err != nil {
+				item.Error = err.Error()
+				return
+			}
+			s.report(ImageImportStageUploaded, item)
+		}(item)
+	}
+	wg.Wait()
+}
+
+func (s *imageImporter) uploadOne(ctx context.Context, item *ImageImportItem) error {
+	f, err := os.Open(item.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	uploaded, err := s.files.Upload(ctx, &UploadFilesReq{File: NewUploadFile(f, filepath.Base(item.Path))})
+	if err != nil {
+		return err
+	}
+	item.FileID = uploaded.ID
+	return nil
+}
+
+func (s *imageImporter) create(ctx context.Context, items []*ImageImportItem) error {
+	datasetID, err := strconv.ParseInt(s.req.DatasetID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dataset id %s: %w", s.req.DatasetID, err)
+	}
+	batchSize := s.req.BatchSize
+	if batchSize <= 0 || batchSize > 10 {
+		batchSize = 10
+	}
+
+	var pending []*ImageImportItem
+	for _, item := range items {
+		if item.Error != "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(item.FileID, 10, 64); err != nil {
+			item.Error = fmt.Sprintf("invalid file id %s", item.FileID)
+			continue
+		}
+		pending = append(pending, item)
+		if len(pending) == batchSize {
+			s.createBatch(ctx, datasetID, pending)
+			pending = nil
+		}
+	}
+	if len(pending) > 0 {
+		s.createBatch(ctx, datasetID, pending)
+	}
+	return ctx.Err()
+}
+
+func (s *imageImporter) createBatch(ctx context.Context, datasetID int64, batch []*ImageImportItem) {
+	bases := make([]*DocumentBase, 0, len(batch))
+	for _, item := range batch {
+		fileID, _ := strconv.ParseInt(item.FileID, 10, 64)
+		bases = append(bases, DocumentBaseBuildImage(item.Name, fileID))
+	}
+	resp, err := s.datasets.Documents.Create(ctx, &CreateDatasetsDocumentsReq{
+		DatasetID:     datasetID,
+		DocumentBases: bases,
+		FormatType:    DocumentFormatTypeImage,
+	})
+	if err == nil && len(resp.DocumentInfos) != len(batch) {
+		err = fmt.Errorf("%d documents created for %d images", len(resp.DocumentInfos), len(batch))
+	}
+	for i, item := range batch {
+		if err != nil {
+			item.Error = err.Error()
+			continue
+		}
+		item.DocumentID = resp.DocumentInfos[i].DocumentID
+		s.report(ImageImportStageCreated, item)
+	}
+}
+
+func (s *imageImporter) wait(ctx context.Context, items []*ImageImportItem) error {
+	byDocumentID := map[string]*ImageImportItem{}
+	var documentIDs []string
+	for _, item := range items {
+		if item.Error == "" && item.DocumentID != "" {
+			byDocumentID[item.DocumentID] = item
+			documentIDs = append(documentIDs, item.DocumentID)
+		}
+	}
+	if len(documentIDs) == 0 {
+		return nil
+	}
+
+	resp, err := s.datasets.WaitForDocuments(ctx, s.req.DatasetID, documentIDs, s.req.WaitOptions...)
+	var processErr *DocumentsProcessError
+	if err != nil && !errors.As(err, &processErr) {
+		return err
+	}
+	for original, newID := range resp.Reuploaded {
+		if item, ok := byDocumentID[original]; ok {
+			item.DocumentID = newID
+			byDocumentID[newID] = item
+		}
+	}
+	for _, progress := range resp.Documents {
+		item, ok := byDocumentID[progress.DocumentID]
+		if !ok {
+			continue
+		}
+		item.Status = ImageStatus(progress.Status)
+		if progress.Status == DocumentStatusFailed {
+			item.Error = fmt.Sprintf("process failed: %s", progress.StatusDescript)
+			continue
+		}
+		s.report(ImageImportStageProcessed, item)
+	}
+	for _, id := range resp.Missing {
+		if item, ok := byDocumentID[id]; ok {
+			item.Error = "document not found"
+		}
+	}
+	return nil
+}
+
+func (s *imageImporter) applyCaptions(ctx context.Context, items []*ImageImportItem) {
+	for _, item := range items {
+		if item.Error != "" || item.DocumentID == "" || item.Caption == "" {
+			continue
+		}
+		caption := item.Caption
+		if _, err := s.images.Update(ctx, &UpdateDatasetImageReq{
+			DatasetID:  s.req.DatasetID,
+			DocumentID: item.DocumentID,
+			Caption:    &caption,
+		}); err != nil {
+			item.Error = err.Error()
+			continue
+		}
+		s.report(ImageImportStageCaptioned, item)
+	}
+}
@@ -0,0 +1,143 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockImageServer struct {
+	mu      sync.Mutex
+	uploads int
+	creates [][]*DocumentBase
+	images  []*Image
+	updates map[string]string
+}
+
+func (s *mockImageServer) roundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case req.URL.Path == "/v1/files/upload":
+		s.uploads++
+		return mockResponse(http.StatusOK, &uploadFilesResp{
+			Data: &UploadFilesResp{FileInfo: FileInfo{ID: strconv.Itoa(9000 + s.uploads)}},
+		})
+	case req.URL.Path == "/open_api/knowledge/document/create":
+		body := &CreateDatasetsDocumentsReq{}
+		if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+			return nil, err
+		}
+		s.creates = append(s.creates, body.DocumentBases)
+		var infos []*Document
+		for _, base := range body.DocumentBases {
+			id := strconv.Itoa(100 + len(s.images))
+			s.images = append(s.images, &Image{DocumentID: id, Name: base.Name, Status: ImageStatusCompleted})
+			infos = append(infos, &Document{DocumentID: id, Name: base.Name})
+		}
+		return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{
+			CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{DocumentInfos: infos},
+		})
+	case req.URL.Path == "/v1/datasets/1/process":
+		body := &ProcessDocumentsReq{}
+		if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+			return nil, err
+		}
+		var data []*DocumentProgress
+		for _, id := range body.DocumentIDs {
+			status := DocumentStatusCompleted
+			if id == "101" {
+				status = DocumentStatusFailed
+			}
+			data = append(data, &DocumentProgress{DocumentID: id, Status: status, StatusDescript: "bad image"})
+		}
+		return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: data}})
+	case req.URL.Path == "/v1/datasets/1/images" && req.Method == http.MethodGet:
+		return mockResponse(http.StatusOK, &listImagesResp{Data: &ListImagesResp{ImagesInfos: s.images, TotalCount: len(s.images)}})
+	case strings.HasPrefix(req.URL.Path, "/v1/datasets/1/images/") && req.Method == http.MethodPut:
+		body := &UpdateDatasetImageReq{}
+		if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+			return nil, err
+		}
+		id := strings.TrimPrefix(req.URL.Path, "/v1/datasets/1/images/")
+		s.updates[id] = *body.Caption
+		for _, image := range s.images {
+			if image.DocumentID == id {
+				image.Caption = *body.Caption
+			}
+		}
+		return mockResponse(http.StatusOK, &updateImageResp{Data: &UpdateDatasetImageResp{}})
+	}
+	return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+}
+
+func TestDatasetsImagesImport(t *testing.T) {
+	as := assert.New(t)
+	server := &mockImageServer{updates: map[string]string{}}
+	images := newDatasetsImages(newCoreWithTransport(newMockTransport(server.roundTrip)))
+
+	dir := t.TempDir()
+	as.Nil(os.WriteFile(filepath.Join(dir, "a.png"), []byte("a"), 0o644))
+	as.Nil(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("caption a\n"), 0o644))
+	as.Nil(os.WriteFile(filepath.Join(dir, "b.jpg"), []byte("b"), 0o644))
+	as.Nil(os.WriteFile(filepath.Join(dir, "notes.md"), []byte("n"), 0o644))
+	csvPath := filepath.Join(dir, "images.csv")
+	as.Nil(os.WriteFile(csvPath, []byte("caption,path\n\"caption, c\",b.jpg\n"), 0o644))
+
+	t.Run("import", func(t *testing.T) {
+		var progress []*ImageImportProgress
+		var mu sync.Mutex
+		resp, err := images.Import(context.Background(), &ImportDatasetsImagesReq{
+			DatasetID: "1",
+			Dir:       dir,
+			CSVPath:   csvPath,
+			BatchSize: 2,
+			OnProgress: func(p *ImageImportProgress) {
+				mu.Lock()
+				defer mu.Unlock()
+				progress = append(progress, p)
+			},
+		})
+		as.NotNil(err)
+		as.Len(resp.Items, 3)
+		as.Equal(3, server.uploads)
+		as.Len(server.creates, 2)
+		as.Len(server.creates[0], 2)
+		as.Equal("a.png", server.creates[0][0].Name)
+		as.NotNil(server.creates[0][0].SourceInfo.SourceFileID)
+
+		failed := resp.Failed()
+		as.Len(failed, 1)
+		as.Equal("101", failed[0].DocumentID)
+		as.Contains(failed[0].Error, "bad image")
+		as.Equal(map[string]string{"100": "caption a", "102": "caption, c"}, server.updates)
+		as.Len(progress, 3+3+2+2)
+	})
+
+	t.Run("export and apply captions", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		as.Nil(images.ExportCaptions(context.Background(), "1", buf))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		as.Len(lines, 4)
+		as.Equal("document_id,name,caption,status", lines[0])
+		as.Equal("100,a.png,caption a,completed", lines[1])
+
+		edited := strings.Replace(buf.String(), "caption a", "new caption", 1)
+		updated, err := images.ApplyCaptions(context.Background(), "1", strings.NewReader(edited))
+		as.Nil(err)
+		as.Equal([]string{"100"}, updated)
+		as.Equal("new caption", server.updates["100"])
+
+		_, err = images.ApplyCaptions(context.Background(), "1", strings.NewReader("id,caption\n1,a\n"))
+		as.NotNil(err)
+	})
+}
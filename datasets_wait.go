@@ -0,0 +1,290 @@
+package coze
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WaitForDocuments 等待文档处理完成
+//
+// 以退避间隔轮询 Process 接口，直到所有文档变为 Completed 或 Failed。处理失败的文档通过
+// *DocumentsProcessError 返回；配置了 WithDocumentsReupload 时会自动重新上传失败的文档。
+// 连续 3 次未出现在 Process 结果中的文档（已删除、不属于该知识库等）视为找不到，同样通过
+// *DocumentsProcessError 返回。
+func (r *datasets) WaitForDocuments(ctx context.Context, datasetID string, documentIDs []string, opts ...WaitForDocumentsOption) (*WaitForDocumentsResp, error) {
+	opt := &waitForDocumentsOption{
+		initialInterval: time.Second,
+		maxInterval:     10 * time.Second,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+
+	resp := &WaitForDocumentsResp{Reuploaded: map[string]string{}}
+	pending := append([]string{}, documentIDs...)
+	attempts := map[string]int{}
+	missing := map[string]int{}
+	last := map[string]*DocumentProgress{}
+	final := map[string]*DocumentProgress{}
+	order := append([]string{}, documentIDs...)
+	interval := opt.initialInterval
+
+	for len(pending) > 0 {
+		processResp, err := r.Process(ctx, &ProcessDocumentsReq{DatasetID: datasetID, DocumentIDs: pending})
+		if err != nil {
+			return resp, err
+		}
+
+		var next []string
+		returned := map[string]bool{}
+		for _, progress := range processResp.Data {
+			returned[progress.DocumentID] = true
+			if prev, ok := last[progress.DocumentID]; !ok || documentProgressChanged(prev, progress) {
+				last[progress.DocumentID] = progress
+				if err := opt.sendProgress(ctx, progress); err != nil {
+					return resp, err
+				}
+			}
+			switch progress.Status {
+			case DocumentStatusCompleted:
+				final[progress.DocumentID] = progress
+			case DocumentStatusFailed:
+				newID, err := r.reuploadDocument(ctx, datasetID, progress, opt.reupload, attempts)
+				if err != nil || newID == "" {
+					if err != nil {
+						logger.Warnf(ctx, "reupload document %s failed, err=%s", progress.DocumentID, err)
+					}
+					final[progress.DocumentID] = progress
+					continue
+				}
+				resp.Reuploaded[progress.DocumentID] = newID
+				attempts[newID] = attempts[progress.DocumentID] + 1
+				order = replaceString(order, progress.DocumentID, newID)
+				next = append(next, newID)
+			default:
+				next = append(next, progress.DocumentID)
+			}
+		}
+		// documents left out of the response are polled again, they may not be visible yet
+		for _, id := range pending {
+			if returned[id] {
+				delete(missing, id)
+				continue
+			}
+			missing[id]++
+			if missing[id] < maxDocumentMissingPolls {
+				next = append(next, id)
+				continue
+			}
+			resp.Missing = append(resp.Missing, id)
+		}
+		pending = next
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = time.Duration(float64(interval) * 1.5)
+		if interval > opt.maxInterval {
+			interval = opt.maxInterval
+		}
+	}
+
+	for _, id := range order {
+		progress, ok := final[id]
+		if !ok {
+			continue
+		}
+		resp.Documents = append(resp.Documents, progress)
+		if progress.Status == DocumentStatusFailed {
+			resp.Failed = append(resp.Failed, progress)
+		}
+	}
+	if len(resp.Failed) > 0 || len(resp.Missing) > 0 {
+		return resp, &DocumentsProcessError{Failed: resp.Failed, Missing: resp.Missing}
+	}
+	return resp, nil
+}
+
+// maxDocumentMissingPolls is the number of consecutive polls a document may be missing from the
+// Process response before it is reported as missing.
+const maxDocumentMissingPolls = 3
+
+// WaitForDocumentsOption configures WaitForDocuments.
+type WaitForDocumentsOption func(*waitForDocumentsOption)
+
+type waitForDocumentsOption struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	progress        chan<- *DocumentProgress
+	reupload        *DocumentReuploadPolicy
+}
+
+// WithDocumentsPollInterval sets the initial and the maximum poll interval, the interval grows
+// by 1.5x after each poll. Default is 1s and 10s.
+func WithDocumentsPollInterval(initial, maxInterval time.Duration) WaitForDocumentsOption {
+	return func(opt *waitForDocumentsOption) {
+		opt.initialInterval = initial
+		opt.maxInterval = maxInterval
+	}
+}
+
+// WithDocumentsProgress sends the progress of a document to ch whenever its Status, Progress,
+// RemainingTime or StatusDescript changes. The channel is not closed by WaitForDocuments.
+func WithDocumentsProgress(ch chan<- *DocumentProgress) WaitForDocumentsOption {
+	return func(opt *waitForDocumentsOption) {
+		opt.progress = ch
+	}
+}
+
+// WithDocumentsReupload re-uploads the failed documents according to the policy.
+func WithDocumentsReupload(policy *DocumentReuploadPolicy) WaitForDocumentsOption {
+	return func(opt *waitForDocumentsOption) {
+		opt.reupload = policy
+	}
+}
+
+// DocumentReuploadPolicy decides how failed documents are re-uploaded.
+type DocumentReuploadPolicy struct {
+	// The maximum number of re-uploads of a document, default is 1.
+	MaxAttempts int
+
+	// Source returns the document base used to re-create the failed document. If nil, web page
+	// documents are re-created from their URL and other documents are not re-uploaded. Returning
+	// nil skips the document.
+	Source func(ctx context.Context, failed *DocumentProgress) (*DocumentBase, error)
+
+	// The chunk strategy used when re-creating documents.
+	ChunkStrategy *DocumentChunkStrategy
+
+	// Keep the failed document instead of deleting it after it is re-uploaded.
+	KeepFailed bool
+}
+
+// WaitForDocumentsResp represents response for waiting documents
+type WaitForDocumentsResp struct {
+	// The final progress of the documents, re-uploaded documents are replaced by the new ones.
+	Documents []*DocumentProgress
+
+	// The documents which failed to process.
+	Failed []*DocumentProgress
+
+	// The re-uploaded documents, keyed by the failed document id.
+	Reuploaded map[string]string
+
+	// The ids of the documents which the Process API did not return.
+	Missing []string
+}
+
+// DocumentsProcessError is returned by WaitForDocuments when some documents failed to process.
+type DocumentsProcessError struct {
+	Failed []*DocumentProgress
+
+	// The ids of the documents which were not found.
+	Missing []string
+}
+
+// Error implements the error interface
+func (e *DocumentsProcessError) Error() string {
+	var messages []string
+	if len(e.Failed) > 0 {
+		descriptions := make([]string, 0, len(e.Failed))
+		for _, progress := range e.Failed {
+			descriptions = append(descriptions, fmt.Sprintf("%s(%s): %s", progress.DocumentName, progress.DocumentID, progress.StatusDescript))
+		}
+		messages = append(messages, fmt.Sprintf("%d documents failed to process: %s", len(e.Failed), strings.Join(descriptions, "; ")))
+	}
+	if len(e.Missing) > 0 {
+		messages = append(messages, fmt.Sprintf("%d documents not found: %s", len(e.Missing), strings.Join(e.Missing, ", ")))
+	}
+	return strings.Join(messages, ", ")
+}
+
+func (opt *waitForDocumentsOption) sendProgress(ctx context.Context, progress *DocumentProgress) error {
+	if opt.progress == nil {
+		return nil
+	}
+	select {
+	case opt.progress <- progress:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *datasets) reuploadDocument(ctx context.Context, datasetID string, failed *DocumentProgress, policy *DocumentReuploadPolicy, attempts map[string]int) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	if attempts[failed.DocumentID] >= maxAttempts {
+		return "", nil
+	}
+
+	var base *DocumentBase
+	if policy.Source != nil {
+		var err error
+		if base, err = policy.Source(ctx, failed); err != nil {
+			return "", err
+		}
+	} else if failed.URL != "" {
+		var interval *int
+		if failed.UpdateType == DocumentUpdateTypeAutoUpdate {
+			interval = ptr(failed.UpdateInterval)
+		}
+		base = DocumentBaseBuildWebPage(failed.DocumentName, failed.URL, interval)
+	}
+	if base == nil {
+		return "", nil
+	}
+
+	id, err := strconv.ParseInt(datasetID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid dataset id %s: %w", datasetID, err)
+	}
+	created, err := r.Documents.Create(ctx, &CreateDatasetsDocumentsReq{
+		DatasetID:     id,
+		DocumentBases: []*DocumentBase{base},
+		ChunkStrategy: policy.ChunkStrategy,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(created.DocumentInfos) == 0 {
+		return "", fmt.Errorf("no document created for %s", failed.DocumentID)
+	}
+	if !policy.KeepFailed {
+		if failedID, err := strconv.ParseInt(failed.DocumentID, 10, 64); err == nil {
+			if _, err := r.Documents.Delete(ctx, &DeleteDatasetsDocumentsReq{DocumentIDs: []int64{failedID}}); err != nil {
+				logger.Warnf(ctx, "delete failed document %s failed, err=%s", failed.DocumentID, err)
+			}
+		}
+	}
+	return created.DocumentInfos[0].DocumentID, nil
+}
+
+func documentProgressChanged(prev, cur *DocumentProgress) bool {
+	return prev.Status != cur.Status ||
+		prev.Progress != cur.Progress ||
+		prev.RemainingTime != cur.RemainingTime ||
+		prev.StatusDescript != cur.StatusDescript
+}
+
+func replaceString(list []string, old, replacement string) []string {
+	for i, s := range list {
+		if s == old {
+			list[i] = replacement
+		}
+	}
+	return list
+}
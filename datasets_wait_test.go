@@ -0,0 +1,123 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatasetsWaitForDocuments(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("wait with progress and reupload", func(t *testing.T) {
+		polls := 0
+		var deleted []int64
+		datasets := newDatasets(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/v1/datasets/1/process":
+				body := &ProcessDocumentsReq{}
+				as.Nil(json.NewDecoder(req.Body).Decode(body))
+				polls++
+				var data []*DocumentProgress
+				for _, id := range body.DocumentIDs {
+					switch {
+					case id == "101" && polls == 1:
+						data = append(data, &DocumentProgress{DocumentID: id, DocumentName: "a.txt", Status: DocumentStatusProcessing, Progress: 50, RemainingTime: 3})
+					case id == "101":
+						data = append(data, &DocumentProgress{DocumentID: id, DocumentName: "a.txt", Status: DocumentStatusCompleted, Progress: 100})
+					case id == "102":
+						data = append(data, &DocumentProgress{DocumentID: id, DocumentName: "web", URL: "https://example.com", Status: DocumentStatusFailed, StatusDescript: "timeout"})
+					case id == "103":
+						data = append(data, &DocumentProgress{DocumentID: id, DocumentName: "web", URL: "https://example.com", Status: DocumentStatusCompleted, Progress: 100})
+					}
+				}
+				return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: data}})
+			case "/open_api/knowledge/document/create":
+				body := &CreateDatasetsDocumentsReq{}
+				as.Nil(json.NewDecoder(req.Body).Decode(body))
+				as.Equal("https://example.com", *body.DocumentBases[0].SourceInfo.WebUrl)
+				return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{
+					CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{DocumentInfos: []*Document{{DocumentID: "103"}}},
+				})
+			case "/open_api/knowledge/document/delete":
+				body := &DeleteDatasetsDocumentsReq{}
+				as.Nil(json.NewDecoder(req.Body).Decode(body))
+				deleted = append(deleted, body.DocumentIDs...)
+				return mockResponse(http.StatusOK, &deleteDatasetsDocumentsResp{})
+			}
+			return nil, nil
+		})))
+
+		ch := make(chan *DocumentProgress, 10)
+		resp, err := datasets.WaitForDocuments(context.Background(), "1", []string{"101", "102"},
+			WithDocumentsPollInterval(time.Millisecond, time.Millisecond),
+			WithDocumentsProgress(ch),
+			WithDocumentsReupload(&DocumentReuploadPolicy{}))
+		as.Nil(err)
+		as.Len(resp.Documents, 2)
+		as.Equal("101", resp.Documents[0].DocumentID)
+		as.Equal("103", resp.Documents[1].DocumentID)
+		as.Equal("103", resp.Reuploaded["102"])
+		as.Equal([]int64{102}, deleted)
+		close(ch)
+		var updates []*DocumentProgress
+		for progress := range ch {
+			updates = append(updates, progress)
+		}
+		as.Len(updates, 4)
+		as.Equal(50, updates[0].Progress)
+	})
+
+	t.Run("failed documents", func(t *testing.T) {
+		datasets := newDatasets(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: []*DocumentProgress{
+				{DocumentID: "101", DocumentName: "a.pdf", Status: DocumentStatusFailed, StatusDescript: "parse failed"},
+			}}})
+		})))
+		resp, err := datasets.WaitForDocuments(context.Background(), "1", []string{"101"}, WithDocumentsReupload(&DocumentReuploadPolicy{}))
+		as.NotNil(err)
+		processErr, ok := err.(*DocumentsProcessError)
+		as.True(ok)
+		as.Contains(processErr.Error(), "parse failed")
+		as.Len(resp.Failed, 1)
+	})
+
+	t.Run("missing documents", func(t *testing.T) {
+		polls := 0
+		datasets := newDatasets(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			polls++
+			// 102 shows up late, 103 never
+			data := []*DocumentProgress{{DocumentID: "101", Status: DocumentStatusCompleted}}
+			if polls == 2 {
+				data = append(data, &DocumentProgress{DocumentID: "102", Status: DocumentStatusCompleted})
+			}
+			return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: data}})
+		})))
+		resp, err := datasets.WaitForDocuments(context.Background(), "1", []string{"101", "102", "103"}, WithDocumentsPollInterval(time.Millisecond, time.Millisecond))
+		as.NotNil(err)
+		processErr, ok := err.(*DocumentsProcessError)
+		as.True(ok)
+		as.Equal([]string{"103"}, processErr.Missing)
+		as.Contains(processErr.Error(), "1 documents not found: 103")
+		as.Equal([]string{"103"}, resp.Missing)
+		as.Len(resp.Documents, 2)
+		as.Empty(resp.Failed)
+		as.Equal(3, polls)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		datasets := newDatasets(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockResponse(http.StatusOK, &processDocumentsResp{Data: &ProcessDocumentsResp{Data: []*DocumentProgress{
+				{DocumentID: "101", Status: DocumentStatusProcessing},
+			}}})
+		})))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := datasets.WaitForDocuments(ctx, "1", []string{"101"}, WithDocumentsPollInterval(5*time.Millisecond, 5*time.Millisecond))
+		as.ErrorIs(err, context.DeadlineExceeded)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/coze-dev/coze-go"
+	"github.com/coze-dev/coze-go/audio"
 )
 
 type handler struct {
@@ -57,22 +58,18 @@ func main() {
 	}
 	defer transcriptionsClient.Close()
 
-	// Simulate sending audio data (in a real implementation, this would be actual audio data)
-	// For this example, we'll just send some dummy data
+	// Send the audio file at real-time pace, as if it came from a microphone
 	fmt.Println("Sending audio data...")
-	audioData, err := os.ReadFile(cozeAudioFile)
+	audioFile, err := os.Open(cozeAudioFile)
 	if err != nil {
-		log.Fatalf("Failed to read audio file: %v", err)
+		log.Fatalf("Failed to open audio file: %v", err)
 	}
+	defer audioFile.Close()
 
-	if err := transcriptionsClient.InputAudioBufferAppend(&coze.WebSocketInputAudioBufferAppendEventData{
-		Delta: audioData,
-	}); err != nil {
-		log.Fatalf("Failed to append audio: %v", err)
-	}
-
-	if err := transcriptionsClient.InputAudioBufferComplete(nil); err != nil {
-		log.Fatalf("Failed to complete audio buffer: %v", err)
+	streamer := audio.NewStreamer(transcriptionsClient, nil)
+	streamer.Complete = true
+	if _, err := streamer.Stream(context.Background(), audioFile); err != nil {
+		log.Fatalf("Failed to stream audio: %v", err)
 	}
 
 	// Wait for transcription completion
@@ -6,12 +6,48 @@ import (
 	"net/http"
 )
 
-func (r *files) Upload(ctx context.Context, req *UploadFilesReq) (*UploadFilesResp, error) {
+func (r *files) Upload(ctx context.Context, req *UploadFilesReq, options ...CozeAPIOption) (*UploadFilesResp, error) {
+	cache := r.core.fileCache
+	if len(options) > 0 {
+		opt := &clientOption{}
+		for _, o := range options {
+			o(opt)
+		}
+		if opt.fileCache != nil {
+			cache = opt.fileCache
+		}
+	}
+	if cache != nil {
+		return cache.upload(ctx, r, req, options)
+	}
+	return r.upload(ctx, req, options)
+}
+
+// UploadMessageObject uploads the file and returns a multimodal message object referencing it,
+// typ is one of MessageObjectStringTypeImage, MessageObjectStringTypeFile and
+// MessageObjectStringTypeAudio.
+func (r *files) UploadMessageObject(ctx context.Context, typ MessageObjectStringType, file FileTypes, options ...CozeAPIOption) (*MessageObjectString, error) {
+	uploaded, err := r.Upload(ctx, &UploadFilesReq{File: file}, options...)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case MessageObjectStringTypeImage:
+		return NewImageMessageObjectByID(uploaded.ID), nil
+	case MessageObjectStringTypeAudio:
+		return NewAudioMessageObjectByID(uploaded.ID), nil
+	default:
+		return NewFileMessageObjectByID(uploaded.ID), nil
+	}
+}
+
+func (r *files) upload(ctx context.Context, req *UploadFilesReq, options []CozeAPIOption) (*UploadFilesResp, error) {
 	request := &RawRequestReq{
-		Method: http.MethodPost,
-		URL:    "/v1/files/upload",
-		Body:   req,
-		IsFile: true,
+		Method:  http.MethodPost,
+		URL:     "/v1/files/upload",
+		Body:    req,
+		IsFile:  true,
+		options: options,
 	}
 	response := new(uploadFilesResp)
 	err := r.core.rawRequest(ctx, request, response)
@@ -0,0 +1,212 @@
+package coze
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileCache lets Files.Upload return the FileInfo of a file whose content was already uploaded.
+// Files are keyed by the sha256 of their content, so the file name of a cache hit is the name used
+// by the first upload. Cached files are checked with Files.Retrieve before they are returned.
+// Readers which cannot seek are uploaded without the cache, as hashing them would need to buffer
+// the whole content.
+//
+// The cache is enabled by passing WithFileCache when creating the client, which also covers the
+// helpers that upload through Files.Upload, or to a single request.
+type FileCache struct {
+	store FileCacheStore
+
+	// The time an uploaded file is reused, 0 means no expiration.
+	ttl time.Duration
+}
+
+// NewFileCache creates a file cache
+func NewFileCache(store FileCacheStore, ttl time.Duration) *FileCache {
+	return &FileCache{store: store, ttl: ttl}
+}
+
+// WithFileCache sets the cache used by Files.Upload
+func WithFileCache(cache *FileCache) CozeAPIOption {
+	return func(opt *clientOption) {
+		opt.fileCache = cache
+	}
+}
+
+// FileCacheStore stores the cache entries, Get returns nil when the key does not exist.
+type FileCacheStore interface {
+	Get(ctx context.Context, key string) (*FileCacheEntry, error)
+	Set(ctx context.Context, key string, entry *FileCacheEntry) error
+	Delete(ctx context.Context, key string) error
+}
+
+// FileCacheEntry represents an uploaded file in the cache
+type FileCacheEntry struct {
+	FileInfo FileInfo  `json:"file_info"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// NewMemoryFileCacheStore creates a store that keeps the entries in memory
+func NewMemoryFileCacheStore() FileCacheStore {
+	return &memoryFileCacheStore{entries: map[string]*FileCacheEntry{}}
+}
+
+// NewDirFileCacheStore creates a store that keeps one json file per entry in dir, so the cache can
+// be shared by processes.
+func NewDirFileCacheStore(dir string) (FileCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirFileCacheStore{dir: dir}, nil
+}
+
+func (c *FileCache) upload(ctx context.Context, files *files, req *UploadFilesReq, options []CozeAPIOption) (*UploadFilesResp, error) {
+	key, ok, err := hashUploadFile(req.File)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return files.upload(ctx, req, options)
+	}
+
+	entry, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && (c.ttl <= 0 || time.Since(entry.CachedAt) < c.ttl) {
+		retrieved, err := files.Retrieve(ctx, &RetrieveFilesReq{FileID: entry.FileInfo.ID})
+		if err == nil && retrieved != nil && retrieved.ID == entry.FileInfo.ID {
+			return &UploadFilesResp{baseModel: retrieved.baseModel, FileInfo: retrieved.FileInfo}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if entry != nil {
+		if err := c.store.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	uploaded, err := files.upload(ctx, req, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.store.Set(ctx, key, &FileCacheEntry{FileInfo: uploaded.FileInfo, CachedAt: time.Now()}); err != nil {
+		return uploaded, err
+	}
+	return uploaded, nil
+}
+
+// hashUploadFile returns the content hash of the file, the reader is rewound after hashing. It
+// returns false for readers which cannot seek.
+func hashUploadFile(file FileTypes) (string, bool, error) {
+	if file == nil {
+		return "", false, errors.New("file is required")
+	}
+	reader := io.Reader(file)
+	if impl, ok := file.(*implFileInterface); ok {
+		reader = impl.Reader
+	}
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		return "", false, nil
+	}
+
+	hash := sha256.New()
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := io.Copy(hash, seeker); err != nil {
+		return "", false, err
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return "", false, err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), true, nil
+}
+
+type memoryFileCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]*FileCacheEntry
+}
+
+func (s *memoryFileCacheStore) Get(ctx context.Context, key string) (*FileCacheEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *memoryFileCacheStore) Set(ctx context.Context, key string, entry *FileCacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *memoryFileCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+type dirFileCacheStore struct {
+	dir string
+}
+
+func (s *dirFileCacheStore) Get(ctx context.Context, key string) (*FileCacheEntry, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entry := &FileCacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		// a corrupted entry is treated as missing and overwritten by the next upload
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (s *dirFileCacheStore) Set(ctx context.Context, key string, entry *FileCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *dirFileCacheStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *dirFileCacheStore) path(key string) string {
+	return filepath.Join(s.dir, strings.ReplaceAll(key, ":", "-")+".json")
+}
@@ -0,0 +1,132 @@
+package coze
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCache(t *testing.T) {
+	as := assert.New(t)
+
+	newServer := func(uploads, retrieves *int, missing map[string]bool) *files {
+		return newFiles(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/v1/files/upload":
+				*uploads++
+				return mockResponse(http.StatusOK, &uploadFilesResp{Data: &UploadFilesResp{FileInfo: FileInfo{
+					ID: fmt.Sprintf("file%d", *uploads), FileName: "a.txt",
+				}}})
+			case "/v1/files/retrieve":
+				*retrieves++
+				id := req.URL.Query().Get("file_id")
+				if missing[id] {
+					return mockResponse(http.StatusOK, &baseResponse{Code: 4000, Msg: "file not found"})
+				}
+				return mockResponse(http.StatusOK, &retrieveFilesResp{Data: &RetrieveFilesResp{FileInfo: FileInfo{ID: id, FileName: "a.txt"}}})
+			}
+			return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+		})))
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		var uploads, retrieves int
+		missing := map[string]bool{}
+		files := newServer(&uploads, &retrieves, missing)
+		cache := WithFileCache(NewFileCache(NewMemoryFileCacheStore(), 0))
+
+		resp, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader("hello"), "a.txt")}, cache)
+		as.Nil(err)
+		as.Equal("file1", resp.ID)
+
+		resp, err = files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader("hello"), "b.txt")}, cache)
+		as.Nil(err)
+		as.Equal("file1", resp.ID)
+		as.Equal(1, uploads)
+		as.Equal(1, retrieves)
+
+		resp, err = files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader("world"), "a.txt")}, cache)
+		as.Nil(err)
+		as.Equal("file2", resp.ID)
+
+		missing["file1"] = true
+		resp, err = files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader("hello"), "a.txt")}, cache)
+		as.Nil(err)
+		as.Equal("file3", resp.ID)
+		as.Equal(3, uploads)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		var uploads, retrieves int
+		files := newServer(&uploads, &retrieves, nil)
+		store := NewMemoryFileCacheStore()
+		as.Nil(store.Set(context.Background(), "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", &FileCacheEntry{
+			FileInfo: FileInfo{ID: "old"},
+			CachedAt: time.Now().Add(-2 * time.Hour),
+		}))
+		resp, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader("hello"), "a.txt")}, WithFileCache(NewFileCache(store, time.Hour)))
+		as.Nil(err)
+		as.Equal("file1", resp.ID)
+		as.Equal(0, retrieves)
+	})
+
+	t.Run("dir store with seekable file", func(t *testing.T) {
+		var uploads, retrieves int
+		files := newServer(&uploads, &retrieves, nil)
+		dir := t.TempDir()
+		store, err := NewDirFileCacheStore(filepath.Join(dir, "cache"))
+		as.Nil(err)
+		path := filepath.Join(dir, "a.txt")
+		as.Nil(os.WriteFile(path, []byte("hello"), 0o644))
+
+		for i := 0; i < 2; i++ {
+			f, err := os.Open(path)
+			as.Nil(err)
+			resp, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(f, "a.txt")}, WithFileCache(NewFileCache(store, 0)))
+			f.Close()
+			as.Nil(err)
+			as.Equal("file1", resp.ID)
+		}
+		as.Equal(1, uploads)
+		entries, err := os.ReadDir(filepath.Join(dir, "cache"))
+		as.Nil(err)
+		as.Len(entries, 1)
+
+		as.Nil(store.Delete(context.Background(), "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+		entry, err := store.Get(context.Background(), "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+		as.Nil(err)
+		as.Nil(entry)
+	})
+
+	t.Run("reader which cannot seek", func(t *testing.T) {
+		var uploads, retrieves int
+		files := newServer(&uploads, &retrieves, nil)
+		store := NewMemoryFileCacheStore()
+		for i := 0; i < 2; i++ {
+			// the reader is streamed without the cache
+			reader := io.MultiReader(strings.NewReader("hello"))
+			resp, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(reader, "a.txt")}, WithFileCache(NewFileCache(store, 0)))
+			as.Nil(err)
+			as.Equal(fmt.Sprintf("file%d", i+1), resp.ID)
+		}
+		as.Equal(2, uploads)
+		as.Equal(0, retrieves)
+	})
+
+	t.Run("message object", func(t *testing.T) {
+		var uploads, retrieves int
+		files := newServer(&uploads, &retrieves, nil)
+		object, err := files.UploadMessageObject(context.Background(), MessageObjectStringTypeImage, NewUploadFile(strings.NewReader("png"), "a.png"))
+		as.Nil(err)
+		as.Equal(MessageObjectStringTypeImage, object.Type)
+		as.Equal("file1", object.FileID)
+	})
+}
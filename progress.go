@@ -0,0 +1,142 @@
+package coze
+
+import (
+	"io"
+	"time"
+)
+
+// TransferDirection is the direction of a transfer reported by a ProgressFunc
+type TransferDirection string
+
+const (
+	// TransferDirectionUpload means the request body is being sent
+	TransferDirectionUpload TransferDirection = "upload"
+	// TransferDirectionDownload means the response body is being read
+	TransferDirectionDownload TransferDirection = "download"
+)
+
+// TransferProgress represents the progress of an upload or a download
+type TransferProgress struct {
+	// The method and url of the request.
+	Method string
+	URL    string
+
+	Direction TransferDirection
+
+	// The number of bytes transferred so far.
+	BytesDone int64
+
+	// The total number of bytes, -1 if unknown.
+	Total int64
+
+	// The average transfer rate in bytes per second.
+	Rate float64
+
+	// The time elapsed since the first byte was transferred.
+	Elapsed time.Duration
+
+	// Whether the transfer is finished.
+	Done bool
+}
+
+// Percent returns the completed percentage, -1 if the total is unknown
+func (p *TransferProgress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.BytesDone) * 100 / float64(p.Total)
+}
+
+// ProgressFunc receives the transfer progress, it is called from the goroutine reading the body,
+// at most every 100ms and once more when the transfer is finished.
+type ProgressFunc func(progress *TransferProgress)
+
+// WithProgress reports the progress of request bodies such as Files.Upload, Audio.Voices.Clone,
+// Audio.Transcriptions.Create and Datasets.Documents.Create, and of file responses such as
+// Audio.Speech.Create. It can be used when creating the client or passed to a single request.
+func WithProgress(fn ProgressFunc) CozeAPIOption {
+	return func(opt *clientOption) {
+		opt.progress = fn
+	}
+}
+
+const progressReportInterval = 100 * time.Millisecond
+
+type progressReader struct {
+	reader   io.Reader
+	fn       ProgressFunc
+	progress TransferProgress
+	start    time.Time
+	reported time.Time
+}
+
+func newProgressReader(reader io.Reader, total int64, direction TransferDirection, rawHttpReq *rawHttpRequest, fn ProgressFunc) *progressReader {
+	return &progressReader{
+		reader: reader,
+		fn:     fn,
+		progress: TransferProgress{
+			Method:    rawHttpReq.Method,
+			URL:       rawHttpReq.URL,
+			Direction: direction,
+			Total:     total,
+		},
+	}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+		r.reported = now
+	}
+	n, err := r.reader.Read(p)
+	if r.progress.Done {
+		return n, err
+	}
+	r.progress.BytesDone += int64(n)
+	done := err == io.EOF || (r.progress.Total > 0 && r.progress.BytesDone >= r.progress.Total)
+	if done || time.Since(r.reported) >= progressReportInterval {
+		r.report(done)
+	}
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *progressReader) report(done bool) {
+	now := time.Now()
+	r.reported = now
+	r.progress.Elapsed = now.Sub(r.start)
+	if seconds := r.progress.Elapsed.Seconds(); seconds > 0 {
+		r.progress.Rate = float64(r.progress.BytesDone) / seconds
+	}
+	r.progress.Done = done
+	progress := r.progress
+	r.fn(&progress)
+}
+
+// setProgress 包装请求体以上报上传进度, 包装后 http.NewRequest 无法推断长度, 需要提前计算 Content-Length
+func (r *rawHttpRequest) setProgress(fn ProgressFunc) {
+	if fn == nil {
+		return
+	}
+	r.progress = fn
+	if r.Body == nil {
+		return
+	}
+	total := r.ContentLength
+	if total <= 0 {
+		if size, ok := readerSize(r.Body); ok {
+			total = size
+			r.ContentLength = size
+		} else {
+			total = -1
+		}
+	}
+	r.Body = newProgressReader(r.Body, total, TransferDirectionUpload, r, fn)
+}
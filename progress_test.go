@@ -0,0 +1,105 @@
+package coze
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type progressRecorder struct {
+	mu      sync.Mutex
+	updates []*TransferProgress
+}
+
+func (r *progressRecorder) record(progress *TransferProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, progress)
+}
+
+func (r *progressRecorder) last() *TransferProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.updates) == 0 {
+		return nil
+	}
+	return r.updates[len(r.updates)-1]
+}
+
+func TestProgress(t *testing.T) {
+	as := assert.New(t)
+	content := strings.Repeat("0123456789", 1000)
+
+	t.Run("upload", func(t *testing.T) {
+		var sent int64
+		files := newFiles(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			bs, err := io.ReadAll(req.Body)
+			as.Nil(err)
+			sent = int64(len(bs))
+			as.Equal(sent, req.ContentLength)
+			return mockResponse(http.StatusOK, &uploadFilesResp{Data: &UploadFilesResp{FileInfo: FileInfo{ID: "1"}}})
+		})))
+		recorder := &progressRecorder{}
+		_, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader(content), "a.txt")}, WithProgress(recorder.record))
+		as.Nil(err)
+		last := recorder.last()
+		as.NotNil(last)
+		as.True(last.Done)
+		as.Equal(TransferDirectionUpload, last.Direction)
+		as.Equal(sent, last.BytesDone)
+		as.Equal(sent, last.Total)
+		as.Equal(float64(100), last.Percent())
+		as.Equal(http.MethodPost, last.Method)
+	})
+
+	t.Run("upload unknown size", func(t *testing.T) {
+		transcriptions := newAudioTranscriptions(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			_, err := io.ReadAll(req.Body)
+			as.Nil(err)
+			return mockResponse(http.StatusOK, &createAudioTranscriptionsResp{CreateAudioTranscriptionsResp: &CreateAudioTranscriptionsResp{}})
+		})))
+		recorder := &progressRecorder{}
+		_, err := transcriptions.Create(context.Background(), &AudioSpeechTranscriptionsReq{
+			Filename: "a.wav",
+			Audio:    iotest.HalfReader(strings.NewReader(content)),
+		}, WithProgress(recorder.record))
+		as.Nil(err)
+		last := recorder.last()
+		as.True(last.Done)
+		as.Equal(int64(-1), last.Total)
+		as.Equal(float64(-1), last.Percent())
+		as.Greater(last.BytesDone, int64(len(content)))
+	})
+
+	t.Run("download", func(t *testing.T) {
+		recorder := &progressRecorder{}
+		core := newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{},
+				Body:          io.NopCloser(strings.NewReader(content)),
+				ContentLength: int64(len(content)),
+			}, nil
+		}))
+		core.progress = recorder.record
+		speech := newAudioSpeech(core)
+		resp, err := speech.Create(context.Background(), &CreateAudioSpeechReq{Input: "hello", VoiceID: "voice"})
+		as.Nil(err)
+
+		bs, err := io.ReadAll(resp.Data)
+		as.Nil(err)
+		as.Nil(resp.Data.Close())
+		as.Equal(content, string(bs))
+		last := recorder.last()
+		as.True(last.Done)
+		as.Equal(TransferDirectionDownload, last.Direction)
+		as.Equal(int64(len(content)), last.BytesDone)
+		as.Equal(int64(len(content)), last.Total)
+	})
+}
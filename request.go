@@ -32,6 +32,9 @@ type RawRequestReq struct {
 	NoNeedToken bool
 	Headers     map[string]string
 	options     []CozeAPIOption
+
+	// json 字段中以 base64 流式发送的文件
+	base64Streams []*base64Stream
 }
 
 func (r *core) rawRequest(ctx context.Context, req *RawRequestReq, resp interface{}) (err error) {
@@ -118,8 +121,24 @@ func (r *core) parseRawHttpRequest(ctx context.Context, req *RawRequestReq) (*ra
 	if err := rawHttpReq.parseRawRequestReqBody(req.Body, req.IsFile); err != nil {
 		return nil, err
 	}
+	if err := rawHttpReq.streamBase64Fields(req.base64Streams); err != nil {
+		return nil, err
+	}
 
-	// 3 return
+	// 3 progress
+	progress := r.progress
+	if len(req.options) > 0 {
+		opt := &clientOption{}
+		for _, o := range req.options {
+			o(opt)
+		}
+		if opt.progress != nil {
+			progress = opt.progress
+		}
+	}
+	rawHttpReq.setProgress(progress)
+
+	// 4 return
 	return rawHttpReq, nil
 }
 
@@ -137,6 +156,9 @@ func (r *core) doRequest(ctx context.Context, rawHttpReq *rawHttpRequest, realRe
 	for k, v := range rawHttpReq.Headers {
 		req.Header.Set(k, v)
 	}
+	if rawHttpReq.ContentLength > 0 {
+		req.ContentLength = rawHttpReq.ContentLength
+	}
 
 	resp, err := r.client.Do(req)
 	if err != nil {
@@ -160,6 +182,9 @@ func (r *core) doRequest(ctx context.Context, rawHttpReq *rawHttpRequest, realRe
 		respContent, err := r.parseStreamResponse(resp, realResponse)
 		return resp, respContent, err
 	default:
+		if rawHttpReq.progress != nil && resp.StatusCode == http.StatusOK {
+			resp.Body = newProgressReader(resp.Body, resp.ContentLength, TransferDirectionDownload, rawHttpReq, rawHttpReq.progress)
+		}
 		respContent, err := r.parseFileResponse(resp, realResponse, respFilename)
 		// file 返回
 		return resp, respContent, err
@@ -333,12 +358,13 @@ func (r *rawHttpRequest) parseRawRequestReqBody(body interface{}, isFile bool) e
 		if fileKey == "" {
 			fileKey = "file"
 		}
-		contentType, bod, err := newFileUploadRequest(fileData, fileKey, fileName, reader)
+		contentType, bod, contentLength, err := newFileUploadRequest(fileData, fileKey, fileName, reader)
 		if err != nil {
 			return err
 		}
 		r.Headers["Content-Type"] = contentType
 		r.Body = bod
+		r.ContentLength = contentLength
 		r.RawBody = []byte("<FILE>")
 	}
 
@@ -350,36 +376,47 @@ func (r *rawHttpRequest) parseRawRequestReqBody(body interface{}, isFile bool) e
 }
 
 type rawHttpRequest struct {
-	Method  string
-	URL     string
-	Body    io.Reader
-	RawBody []byte
-	Headers map[string]string
-	Timeout time.Duration
+	Method        string
+	URL           string
+	Body          io.Reader
+	RawBody       []byte
+	ContentLength int64 // 0 表示由 http.NewRequest 推断, 流式请求体未知长度时使用 chunked 编码
+	Headers       map[string]string
+	Timeout       time.Duration
+	progress      ProgressFunc
 }
 
-func newFileUploadRequest(params map[string]string, filekey, fileName string, reader io.Reader) (string, io.Reader, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// newFileUploadRequest 构造 multipart 请求体, 文件内容不会被读入内存, 而是在发送请求时直接从 reader 读取。
+// 文件大小已知时返回完整的 Content-Length, 否则返回 -1
+func newFileUploadRequest(params map[string]string, filekey, fileName string, reader io.Reader) (string, io.Reader, int64, error) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	var head []byte
 	if reader != nil {
-		part, err := writer.CreateFormFile(filekey, fileName)
-		if err != nil {
-			return "", nil, err
-		}
-		if _, err = io.Copy(part, reader); err != nil {
-			return "", nil, err
+		if _, err := writer.CreateFormFile(filekey, fileName); err != nil {
+			return "", nil, 0, err
 		}
+		head = append(head, buf.Bytes()...)
+		buf.Reset()
 	}
 	for key, val := range params {
 		if err := writer.WriteField(key, val); err != nil {
-			return "", nil, err
+			return "", nil, 0, err
 		}
 	}
 	if err := writer.Close(); err != nil {
-		return "", nil, err
+		return "", nil, 0, err
+	}
+	tail := buf.Bytes()
+	if reader == nil {
+		return writer.FormDataContentType(), bytes.NewReader(tail), int64(len(tail)), nil
 	}
 
-	return writer.FormDataContentType(), body, nil
+	contentLength := int64(-1)
+	if size, ok := readerSize(reader); ok {
+		contentLength = int64(len(head)) + size + int64(len(tail))
+	}
+	return writer.FormDataContentType(), io.MultiReader(bytes.NewReader(head), reader, bytes.NewReader(tail)), contentLength, nil
 }
 
 type readerSetter interface {
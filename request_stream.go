@@ -0,0 +1,141 @@
+package coze
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 上传文件时不再把文件读入内存，请求体由多个 reader 拼接而成，边读边发送
+
+// readerSize 返回 reader 剩余的字节数，未知时返回 false
+func readerSize(reader io.Reader) (int64, bool) {
+	switch r := reader.(type) {
+	case nil:
+		return 0, true
+	case *implFileInterface:
+		return readerSize(r.Reader)
+	case interface{ Len() int }:
+		// *bytes.Buffer, *bytes.Reader, *strings.Reader
+		return int64(r.Len()), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	case interface {
+		Size() int64
+		io.Seeker
+	}:
+		// *io.SectionReader, Size 是总大小，需要减去已读取的部分
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return r.Size() - offset, true
+	}
+	return 0, false
+}
+
+// base64Stream 表示 json 请求体中需要以 base64 流式写入的字段，json 中先以 placeholder 占位
+type base64Stream struct {
+	placeholder string
+	reader      io.Reader
+}
+
+func newBase64Stream(reader io.Reader) (*base64Stream, error) {
+	random, err := generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &base64Stream{
+		placeholder: "coze-base64-stream-" + random,
+		reader:      reader,
+	}, nil
+}
+
+// streamBase64Fields 把 RawBody 中的占位符替换为对应 reader 的 base64 编码流
+func (r *rawHttpRequest) streamBase64Fields(streams []*base64Stream) error {
+	if len(streams) == 0 {
+		return nil
+	}
+	if r.RawBody == nil {
+		return errors.New("base64 stream requires a json body")
+	}
+
+	readers := make([]io.Reader, 0, len(streams)*2+1)
+	rawBody := r.RawBody
+	rest := r.RawBody
+	contentLength := int64(0)
+	sizeKnown := true
+	for _, stream := range streams {
+		placeholder := []byte(stream.placeholder)
+		idx := bytes.Index(rest, placeholder)
+		if idx < 0 {
+			return fmt.Errorf("base64 stream placeholder %s not found in body", stream.placeholder)
+		}
+		readers = append(readers, bytes.NewReader(rest[:idx]), newBase64Reader(stream.reader))
+		contentLength += int64(idx)
+		if size, ok := readerSize(stream.reader); ok {
+			contentLength += int64(base64.StdEncoding.EncodedLen(int(size)))
+		} else {
+			sizeKnown = false
+		}
+		rest = rest[idx+len(placeholder):]
+		rawBody = bytes.Replace(rawBody, placeholder, []byte("<FILE>"), 1)
+	}
+	readers = append(readers, bytes.NewReader(rest))
+	contentLength += int64(len(rest))
+
+	r.Body = io.MultiReader(readers...)
+	r.RawBody = rawBody
+	r.ContentLength = 0
+	if sizeKnown {
+		r.ContentLength = contentLength
+	}
+	return nil
+}
+
+// base64Reader 从 src 读取数据，输出标准 base64 编码，内存占用恒定
+type base64Reader struct {
+	src io.Reader
+	in  []byte
+	out []byte
+	err error
+}
+
+func newBase64Reader(src io.Reader) *base64Reader {
+	return &base64Reader{src: src, in: make([]byte, 3*1024)}
+}
+
+func (r *base64Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		n, err := io.ReadFull(r.src, r.in)
+		if n > 0 {
+			buf := make([]byte, base64.StdEncoding.EncodedLen(n))
+			base64.StdEncoding.Encode(buf, r.in[:n])
+			r.out = buf
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			r.err = io.EOF
+		default:
+			r.err = err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFileUploadRequest(t *testing.T) {
+	as := assert.New(t)
+
+	t.Run("known size", func(t *testing.T) {
+		content := strings.Repeat("hello", 1000)
+		contentType, body, contentLength, err := newFileUploadRequest(map[string]string{"name": "voice"}, "file", "a.txt", strings.NewReader(content))
+		as.Nil(err)
+		bs, err := io.ReadAll(body)
+		as.Nil(err)
+		as.Equal(int64(len(bs)), contentLength)
+
+		_, params, err := mime.ParseMediaType(contentType)
+		as.Nil(err)
+		form, err := multipart.NewReader(bytes.NewReader(bs), params["boundary"]).ReadForm(1 << 20)
+		as.Nil(err)
+		as.Equal([]string{"voice"}, form.Value["name"])
+		as.Equal("a.txt", form.File["file"][0].Filename)
+		f, err := form.File["file"][0].Open()
+		as.Nil(err)
+		fileContent, _ := io.ReadAll(f)
+		as.Equal(content, string(fileContent))
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		_, body, contentLength, err := newFileUploadRequest(nil, "file", "a.txt", iotest.OneByteReader(strings.NewReader("abc")))
+		as.Nil(err)
+		as.Equal(int64(-1), contentLength)
+		bs, _ := io.ReadAll(body)
+		as.Contains(string(bs), "abc")
+	})
+
+	t.Run("without file", func(t *testing.T) {
+		_, body, contentLength, err := newFileUploadRequest(map[string]string{"name": "voice"}, "file", "", nil)
+		as.Nil(err)
+		bs, _ := io.ReadAll(body)
+		as.Equal(int64(len(bs)), contentLength)
+		as.NotContains(string(bs), "filename")
+	})
+}
+
+func TestReaderSize(t *testing.T) {
+	as := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	as.Nil(os.WriteFile(path, []byte("0123456789"), 0o644))
+	f, err := os.Open(path)
+	as.Nil(err)
+	defer f.Close()
+	_, err = f.Seek(4, io.SeekStart)
+	as.Nil(err)
+
+	size, ok := readerSize(f)
+	as.True(ok)
+	as.Equal(int64(6), size)
+
+	size, ok = readerSize(NewUploadFile(bytes.NewReader([]byte("abc")), "a.txt"))
+	as.True(ok)
+	as.Equal(int64(3), size)
+
+	// a partly read section reader
+	section := io.NewSectionReader(strings.NewReader("0123456789"), 2, 6)
+	_, err = section.Read(make([]byte, 4))
+	as.Nil(err)
+	size, ok = readerSize(section)
+	as.True(ok)
+	as.Equal(int64(2), size)
+
+	_, ok = readerSize(io.LimitReader(f, 1))
+	as.False(ok)
+}
+
+func TestBase64Reader(t *testing.T) {
+	as := assert.New(t)
+	for _, n := range []int{0, 1, 2, 3, 3071, 3072, 3073, 10000} {
+		content := bytes.Repeat([]byte{'a', 'b', 'c', 'd'}, n)[:n]
+		bs, err := io.ReadAll(newBase64Reader(iotest.HalfReader(bytes.NewReader(content))))
+		as.Nil(err)
+		as.Equal(base64.StdEncoding.EncodeToString(content), string(bs), "size %d", n)
+	}
+
+	_, err := io.ReadAll(newBase64Reader(iotest.ErrReader(io.ErrClosedPipe)))
+	as.ErrorIs(err, io.ErrClosedPipe)
+}
+
+func TestStreamUpload(t *testing.T) {
+	as := assert.New(t)
+	content := strings.Repeat("0123456789", 1000)
+
+	t.Run("files upload", func(t *testing.T) {
+		files := newFiles(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			bs, err := io.ReadAll(req.Body)
+			as.Nil(err)
+			as.Equal(int64(len(bs)), req.ContentLength)
+			req.Body = io.NopCloser(bytes.NewReader(bs))
+			as.Nil(req.ParseMultipartForm(1 << 20))
+			as.Equal("a.txt", req.MultipartForm.File["file"][0].Filename)
+			return mockResponse(http.StatusOK, &uploadFilesResp{Data: &UploadFilesResp{FileInfo: FileInfo{ID: "1"}}})
+		})))
+		_, err := files.Upload(context.Background(), &UploadFilesReq{File: NewUploadFile(strings.NewReader(content), "a.txt")})
+		as.Nil(err)
+	})
+
+	t.Run("document base64 stream", func(t *testing.T) {
+		documents := newDatasetsDocuments(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			bs, err := io.ReadAll(req.Body)
+			as.Nil(err)
+			as.Equal(int64(len(bs)), req.ContentLength)
+			body := &CreateDatasetsDocumentsReq{}
+			as.Nil(json.Unmarshal(bs, body))
+			as.Len(body.DocumentBases, 3)
+			as.Equal(base64.StdEncoding.EncodeToString([]byte(content)), *body.DocumentBases[0].SourceInfo.FileBase64)
+			as.Equal("https://example.com", *body.DocumentBases[1].SourceInfo.WebUrl)
+			as.Equal(base64.StdEncoding.EncodeToString([]byte("abc")), *body.DocumentBases[2].SourceInfo.FileBase64)
+			as.Equal("md", *body.DocumentBases[2].SourceInfo.FileType)
+			return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{}})
+		})))
+		req := &CreateDatasetsDocumentsReq{
+			DatasetID: 1,
+			DocumentBases: []*DocumentBase{
+				DocumentBaseBuildLocalFileReader("a.txt", strings.NewReader(content), "txt"),
+				DocumentBaseBuildWebPage("web", "https://example.com", nil),
+				DocumentBaseBuildLocalFileReader("b.md", strings.NewReader("abc"), "md"),
+			},
+		}
+		_, err := documents.Create(context.Background(), req)
+		as.Nil(err)
+		as.Nil(req.DocumentBases[0].SourceInfo.FileBase64)
+	})
+
+	t.Run("document base64 stream unknown size", func(t *testing.T) {
+		documents := newDatasetsDocuments(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			body := &CreateDatasetsDocumentsReq{}
+			as.Nil(json.NewDecoder(req.Body).Decode(body))
+			as.Equal(base64.StdEncoding.EncodeToString([]byte("abcd")), *body.DocumentBases[0].SourceInfo.FileBase64)
+			return mockResponse(http.StatusOK, &createDatasetsDocumentsResp{CreateDatasetsDocumentsResp: &CreateDatasetsDocumentsResp{}})
+		})))
+		_, err := documents.Create(context.Background(), &CreateDatasetsDocumentsReq{
+			DatasetID:     1,
+			DocumentBases: []*DocumentBase{DocumentBaseBuildLocalFileReader("a.txt", iotest.OneByteReader(strings.NewReader("abcd")), "txt")},
+		})
+		as.Nil(err)
+	})
+}
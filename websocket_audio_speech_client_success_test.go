@@ -2,11 +2,9 @@ package coze
 
 import (
 	"context"
-	"os"
 	"sync"
 	"testing"
 
-	"github.com/coze-dev/coze-go/examples/websockets/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,20 +24,9 @@ func (r *speechSuccessTestdataHandler) OnSpeechAudioUpdate(ctx context.Context,
 func (r *speechSuccessTestdataHandler) assert(t *testing.T) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	as := assert.New(t)
-
-	f, err := os.CreateTemp("", "*-coze-ws-speech.wav")
-	as.Nil(err)
-	defer f.Close()
-	defer os.Remove(f.Name())
-
-	as.Nil(util.WritePCMToWavFile(f.Name(), r.audio))
 
-	expected, err := os.ReadFile("testdata/websocket_speech_success.wav")
-	as.Nil(err)
-	actual, err := os.ReadFile(f.Name())
-	as.Nil(err)
-	as.Equal(expected, actual)
+	// audio
+	assertWAVFile(t, "testdata/websocket_speech_success.wav", r.audio)
 }
 
 func TestWebSocketSpeechSuccess(t *testing.T) {
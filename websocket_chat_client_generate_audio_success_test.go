@@ -2,11 +2,9 @@ package coze
 
 import (
 	"context"
-	"os"
 	"sync"
 	"testing"
 
-	"github.com/coze-dev/coze-go/examples/websockets/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,21 +24,9 @@ func (r *chatGenerateAudioSuccessTestdataHandler) OnConversationAudioDelta(ctx c
 func (r *chatGenerateAudioSuccessTestdataHandler) assert(t *testing.T) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	as := assert.New(t)
-
-	f, err := os.CreateTemp("", "*-coze-ws-chat.wav")
-	as.Nil(err)
-	defer f.Close()
-	defer os.Remove(f.Name())
-
-	as.Nil(util.WritePCMToWavFile(f.Name(), r.audio))
 
 	// audio
-	expected, err := os.ReadFile("testdata/websocket_chat_generate_audio_success.wav")
-	as.Nil(err)
-	actual, err := os.ReadFile(f.Name())
-	as.Nil(err)
-	as.Equal(expected, actual)
+	assertWAVFile(t, "testdata/websocket_chat_generate_audio_success.wav", r.audio)
 }
 
 func TestWebSocketChatGenerateAudioSuccess(t *testing.T) {
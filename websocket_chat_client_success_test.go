@@ -2,12 +2,9 @@ package coze
 
 import (
 	"context"
-	"fmt"
-	"os"
 	"sync"
 	"testing"
 
-	"github.com/coze-dev/coze-go/examples/websockets/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,20 +34,8 @@ func (r *chatSuccessTestdataHandler) assert(t *testing.T) {
 	defer r.mu.Unlock()
 	as := assert.New(t)
 
-	f, err := os.CreateTemp("", "*-coze-ws-chat.wav")
-	as.Nil(err)
-	defer f.Close()
-	defer os.Remove(f.Name())
-
-	as.Nil(util.WritePCMToWavFile(f.Name(), r.audio))
-
 	// audio
-	expected, err := os.ReadFile("testdata/websocket_chat_success.wav")
-	as.Nil(err)
-	fmt.Println(f.Name())
-	actual, err := os.ReadFile(f.Name())
-	as.Nil(err)
-	as.Equal(expected, actual)
+	assertWAVFile(t, "testdata/websocket_chat_success.wav", r.audio)
 
 	// text
 	as.Equal("是啊，好天气总能让人心情也跟着变好呢！你有没有打算趁着这好天气出门走走，做点有意思的事儿？  ", r.text)
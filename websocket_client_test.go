@@ -1,18 +1,50 @@
 package coze
 
 import (
+	"bytes"
 	_ "embed"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
+	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 )
 
+// assertWAVFile checks the WAV file holds exactly pcm as the 24kHz mono 16-bit audio returned by
+// the websocket APIs, header included.
+func assertWAVFile(t *testing.T, expectedFile string, pcm []byte) {
+	as := assert.New(t)
+	expected, err := os.ReadFile(expectedFile)
+	as.Nil(err)
+
+	header := &bytes.Buffer{}
+	header.WriteString("RIFF")
+	_ = binary.Write(header, binary.LittleEndian, uint32(36+len(pcm)))
+	header.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16),    // fmt chunk size
+		uint16(1),     // pcm
+		uint16(1),     // channels
+		uint32(24000), // sample rate
+		uint32(48000), // byte rate
+		uint16(2),     // block align
+		uint16(16),    // bits per sample
+	} {
+		_ = binary.Write(header, binary.LittleEndian, v)
+	}
+	header.WriteString("data")
+	_ = binary.Write(header, binary.LittleEndian, uint32(len(pcm)))
+	as.Equal(append(header.Bytes(), pcm...), expected)
+}
+
 //go:embed testdata/websocket_speech_success.txt
 var websocketSpeechSuccessTestData string
 
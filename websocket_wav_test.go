@@ -0,0 +1,28 @@
+package coze_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coze-dev/coze-go/examples/websockets/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// The audio of the websocket testdata is saved as the examples save it.
+func TestWritePCMToWavFile(t *testing.T) {
+	as := assert.New(t)
+	for _, name := range []string{
+		"websocket_speech_success.wav",
+		"websocket_chat_success.wav",
+		"websocket_chat_generate_audio_success.wav",
+	} {
+		expected, err := os.ReadFile(filepath.Join("testdata", name))
+		as.Nil(err)
+		file := filepath.Join(t.TempDir(), name)
+		as.Nil(util.WritePCMToWavFile(file, expected[44:]))
+		actual, err := os.ReadFile(file)
+		as.Nil(err)
+		as.Equal(expected, actual, name)
+	}
+}
@@ -0,0 +1,640 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkflowRegressionSuite 描述一组工作流回归用例
+//
+// Record 执行所有用例并保存 golden 输出，Check 重新执行用例并与 golden 输出比较。
+type WorkflowRegressionSuite struct {
+	// The ID of the workflow.
+	WorkflowID string
+
+	// The workflow version to run, the latest version is used if empty.
+	WorkflowVersion string
+
+	// The associated Bot ID required for some workflow executions.
+	BotID string
+
+	AppID string
+
+	// Run the cases through Runs.Stream and join the message contents, otherwise Runs.Create is used.
+	Stream bool
+
+	// The maximum number of cases running at the same time, default is 5.
+	Concurrency int
+
+	// The cases to run. If empty, Check runs the cases stored in the golden set.
+	Cases []*WorkflowRegressionCase
+
+	// The comparators used by Check, default is ExactComparator.
+	Comparators []WorkflowOutputComparator
+}
+
+// WorkflowRegressionCase is a recorded input set of a workflow.
+type WorkflowRegressionCase struct {
+	// The unique name of the case.
+	Name string `json:"name"`
+
+	// Input parameters for the starting node of the workflow.
+	Parameters map[string]any `json:"parameters,omitempty"`
+
+	// The comparators used for this case, override WorkflowRegressionSuite.Comparators.
+	Comparators []WorkflowOutputComparator `json:"-"`
+}
+
+// WorkflowGoldenSet stores the golden outputs of a suite.
+type WorkflowGoldenSet struct {
+	WorkflowID      string                     `json:"workflow_id"`
+	WorkflowVersion string                     `json:"workflow_version,omitempty"`
+	RecordedAt      time.Time                  `json:"recorded_at"`
+	Outputs         map[string]*WorkflowGolden `json:"outputs"`
+}
+
+// WorkflowGolden is the golden output of a case.
+type WorkflowGolden struct {
+	Parameters map[string]any `json:"parameters,omitempty"`
+	Output     string         `json:"output"`
+	DebugURL   string         `json:"debug_url,omitempty"`
+}
+
+// LoadWorkflowGoldenSet loads a golden set saved by WorkflowGoldenSet.Save.
+func LoadWorkflowGoldenSet(path string) (*WorkflowGoldenSet, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	golden := &WorkflowGoldenSet{}
+	if err := json.Unmarshal(bs, golden); err != nil {
+		return nil, fmt.Errorf("invalid golden file %s: %w", path, err)
+	}
+	return golden, nil
+}
+
+// Save writes the golden set to path as JSON.
+func (g *WorkflowGoldenSet) Save(path string) error {
+	bs, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bs, 0o644)
+}
+
+// Record runs all cases and returns their outputs as a golden set. Any failed case fails the
+// whole recording.
+func (s *WorkflowRegressionSuite) Record(ctx context.Context, client *CozeAPI) (*WorkflowGoldenSet, error) {
+	if err := checkWorkflowRegressionCases(s.Cases); err != nil {
+		return nil, err
+	}
+	results := s.runCases(ctx, client, s.Cases)
+	golden := &WorkflowGoldenSet{
+		WorkflowID:      s.WorkflowID,
+		WorkflowVersion: s.WorkflowVersion,
+		RecordedAt:      time.Now(),
+		Outputs:         map[string]*WorkflowGolden{},
+	}
+	for i, result := range results {
+		if result.err != nil {
+			return nil, fmt.Errorf("record case %s failed: %w", s.Cases[i].Name, result.err)
+		}
+		golden.Outputs[s.Cases[i].Name] = &WorkflowGolden{
+			Parameters: s.Cases[i].Parameters,
+			Output:     result.output,
+			DebugURL:   result.debugURL,
+		}
+	}
+	return golden, nil
+}
+
+// Check re-runs the cases and compares their outputs with the golden set. A golden set recorded
+// with another workflow version and the golden outputs of cases which are not in the suite are
+// reported in WorkflowRegressionReport.Warnings.
+func (s *WorkflowRegressionSuite) Check(ctx context.Context, client *CozeAPI, golden *WorkflowGoldenSet) (*WorkflowRegressionReport, error) {
+	if golden == nil {
+		return nil, errors.New("golden set is required")
+	}
+	if err := checkWorkflowRegressionCases(s.Cases); err != nil {
+		return nil, err
+	}
+	cases := s.Cases
+	if len(cases) == 0 {
+		for name, output := range golden.Outputs {
+			cases = append(cases, &WorkflowRegressionCase{Name: name, Parameters: output.Parameters})
+		}
+		sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	}
+
+	start := time.Now()
+	runs := s.runCases(ctx, client, cases)
+	report := &WorkflowRegressionReport{
+		WorkflowID:      s.WorkflowID,
+		WorkflowVersion: s.WorkflowVersion,
+	}
+	if golden.WorkflowVersion != s.WorkflowVersion {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("golden set was recorded with workflow version %s, but version %s is checked",
+			workflowVersionName(golden.WorkflowVersion), workflowVersionName(s.WorkflowVersion)))
+	}
+	if len(s.Cases) > 0 {
+		names := make(map[string]bool, len(s.Cases))
+		for _, c := range s.Cases {
+			names[c.Name] = true
+		}
+		var missing []string
+		for name := range golden.Outputs {
+			if !names[name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("golden case %s is not in the suite", name))
+		}
+	}
+	for i, run := range runs {
+		c := cases[i]
+		result := &WorkflowRegressionResult{
+			Name:     c.Name,
+			Output:   run.output,
+			DebugURL: run.debugURL,
+			Duration: run.duration,
+		}
+		expected, ok := golden.Outputs[c.Name]
+		switch {
+		case run.err != nil:
+			result.Error = run.err.Error()
+		case !ok:
+			result.Error = "golden output not found"
+		default:
+			result.Expected = expected.Output
+			comparators := c.Comparators
+			if len(comparators) == 0 {
+				comparators = s.Comparators
+			}
+			if len(comparators) == 0 {
+				comparators = []WorkflowOutputComparator{ExactComparator()}
+			}
+			for _, comparator := range comparators {
+				result.Diffs = append(result.Diffs, comparator.Compare(expected.Output, run.output)...)
+			}
+			result.Passed = len(result.Diffs) == 0
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// checkWorkflowRegressionCases rejects the cases whose names are not unique, as the golden outputs
+// are keyed by name.
+func checkWorkflowRegressionCases(cases []*WorkflowRegressionCase) error {
+	names := make(map[string]bool, len(cases))
+	for _, c := range cases {
+		if names[c.Name] {
+			return fmt.Errorf("duplicate case name %q", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+func workflowVersionName(version string) string {
+	if version == "" {
+		return "latest"
+	}
+	return version
+}
+
+// workflowRegressionOutput unwraps the output of a workflow, an output which is a string is returned
+// without the JSON quotes.
+func workflowRegressionOutput(data string) string {
+	raw := unwrapWorkflowOutput(json.RawMessage(data))
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+type workflowRegressionRun struct {
+	output   string
+	debugURL string
+	duration time.Duration
+	err      error
+}
+
+func (s *WorkflowRegressionSuite) runCases(ctx context.Context, client *CozeAPI, cases []*WorkflowRegressionCase) []*workflowRegressionRun {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	sem := make(chan struct{}, concurrency)
+	results := make([]*workflowRegressionRun, len(cases))
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		go func(i int, c *WorkflowRegressionCase) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			result := s.runCase(ctx, client, c)
+			result.duration = time.Since(start)
+			results[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *WorkflowRegressionSuite) runCase(ctx context.Context, client *CozeAPI, c *WorkflowRegressionCase) *workflowRegressionRun {
+	req := &RunWorkflowsReq{
+		WorkflowID:      s.WorkflowID,
+		Parameters:      c.Parameters,
+		BotID:           s.BotID,
+		AppID:           s.AppID,
+		WorkflowVersion: s.WorkflowVersion,
+	}
+	if !s.Stream {
+		resp, err := client.Workflows.Runs.Create(ctx, req)
+		if err != nil {
+			return &workflowRegressionRun{err: newWorkflowRunErrorFromResp(s.WorkflowID, resp, err)}
+		}
+		return &workflowRegressionRun{
+			output:   workflowRegressionOutput(resp.Data),
+			debugURL: resp.DebugURL,
+		}
+	}
+
+	stream, err := client.Workflows.Runs.Stream(ctx, req)
+	if err != nil {
+		return &workflowRegressionRun{err: err}
+	}
+	defer stream.Close()
+	run := &workflowRegressionRun{}
+	content := &strings.Builder{}
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			run.err = err
+			return run
+		}
+		switch event.Event {
+		case WorkflowEventTypeMessage:
+			content.WriteString(event.Message.Content)
+		case WorkflowEventTypeError:
+			run.err = NewError(event.Error.ErrorCode, event.Error.ErrorMessage, stream.Response().LogID())
+			return run
+		case WorkflowEventTypeInterrupt:
+			run.err = fmt.Errorf("workflow interrupted at node %s", event.Interrupt.NodeTitle)
+			return run
+		case WorkflowEventTypeDone:
+			if event.DebugURL != nil {
+				run.debugURL = event.DebugURL.URL
+			}
+		}
+		if event.IsDone() {
+			break
+		}
+	}
+	run.output = workflowRegressionOutput(content.String())
+	return run
+}
+
+// WorkflowRegressionReport is the result of WorkflowRegressionSuite.Check.
+type WorkflowRegressionReport struct {
+	WorkflowID      string                      `json:"workflow_id"`
+	WorkflowVersion string                      `json:"workflow_version,omitempty"`
+	Duration        time.Duration               `json:"duration"`
+	Results         []*WorkflowRegressionResult `json:"results"`
+	// Problems of the check which do not fail the cases, such as a golden set recorded with another
+	// workflow version.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// WorkflowRegressionResult is the result of a case.
+type WorkflowRegressionResult struct {
+	Name     string                `json:"name"`
+	Passed   bool                  `json:"passed"`
+	Expected string                `json:"expected,omitempty"`
+	Output   string                `json:"output,omitempty"`
+	Diffs    []*WorkflowOutputDiff `json:"diffs,omitempty"`
+	// The error occurred when running the case.
+	Error    string        `json:"error,omitempty"`
+	DebugURL string        `json:"debug_url,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Passed reports whether all cases passed.
+func (r *WorkflowRegressionReport) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteJUnit writes the report as JUnit XML.
+func (r *WorkflowRegressionReport) WriteJUnit(w io.Writer) error {
+	suite := &junitTestSuite{
+		Name:  "workflow " + r.WorkflowID,
+		Tests: len(r.Results),
+		Time:  formatJUnitSeconds(r.Duration),
+	}
+	if len(r.Warnings) > 0 {
+		suite.SystemErr = strings.Join(r.Warnings, "\n")
+	}
+	for _, result := range r.Results {
+		testCase := &junitTestCase{
+			Name:      result.Name,
+			ClassName: "workflow." + r.WorkflowID,
+			Time:      formatJUnitSeconds(result.Duration),
+		}
+		switch {
+		case result.Error != "":
+			suite.Errors++
+			testCase.Error = &junitMessage{Message: result.Error, Content: result.DebugURL}
+		case !result.Passed:
+			suite.Failures++
+			lines := make([]string, 0, len(result.Diffs))
+			for _, diff := range result.Diffs {
+				lines = append(lines, diff.String())
+			}
+			testCase.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d difference(s)", len(result.Diffs)),
+				Content: strings.Join(append(lines, "debug_url: "+result.DebugURL), "\n"),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(&junitTestSuites{Suites: []*junitTestSuite{suite}})
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	SystemErr string           `xml:"system-err,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+func formatJUnitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// WorkflowOutputDiff describes a difference between the golden output and the actual output.
+type WorkflowOutputDiff struct {
+	// The JSON field path, empty means the whole output.
+	Path     string `json:"path,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Message  string `json:"message"`
+}
+
+func (d *WorkflowOutputDiff) String() string {
+	path := d.Path
+	if path == "" {
+		path = "<output>"
+	}
+	return fmt.Sprintf("%s: %s, expected=%s, actual=%s", path, d.Message, d.Expected, d.Actual)
+}
+
+// WorkflowOutputComparator compares the golden output with the actual output.
+type WorkflowOutputComparator interface {
+	Compare(expected, actual string) []*WorkflowOutputDiff
+}
+
+// WorkflowOutputComparatorFunc is an adapter to use a function as a WorkflowOutputComparator.
+type WorkflowOutputComparatorFunc func(expected, actual string) []*WorkflowOutputDiff
+
+func (f WorkflowOutputComparatorFunc) Compare(expected, actual string) []*WorkflowOutputDiff {
+	return f(expected, actual)
+}
+
+// ExactComparator requires the actual output to be equal to the golden output.
+func ExactComparator() WorkflowOutputComparator {
+	return WorkflowOutputComparatorFunc(func(expected, actual string) []*WorkflowOutputDiff {
+		if expected == actual {
+			return nil
+		}
+		return []*WorkflowOutputDiff{{Expected: expected, Actual: actual, Message: "output mismatch"}}
+	})
+}
+
+// JSONSubsetComparator compares the given JSON field paths, such as "data.items.0.name". If no
+// path is given, every field of the golden output must exist in the actual output with the same
+// value, extra fields of the actual output are ignored.
+func JSONSubsetComparator(paths ...string) WorkflowOutputComparator {
+	return WorkflowOutputComparatorFunc(func(expected, actual string) []*WorkflowOutputDiff {
+		expectedValue, actualValue, diff := decodeComparedJSON(expected, actual)
+		if diff != nil {
+			return []*WorkflowOutputDiff{diff}
+		}
+		if len(paths) == 0 {
+			return diffJSONSubset("", expectedValue, actualValue)
+		}
+		var diffs []*WorkflowOutputDiff
+		for _, path := range paths {
+			e, eok := lookupJSONPath(expectedValue, path)
+			a, aok := lookupJSONPath(actualValue, path)
+			if !eok && !aok {
+				continue
+			}
+			if !aok {
+				diffs = append(diffs, &WorkflowOutputDiff{Path: path, Expected: mustToJson(e), Message: "field missing"})
+				continue
+			}
+			if !reflect.DeepEqual(e, a) {
+				diffs = append(diffs, &WorkflowOutputDiff{Path: path, Expected: mustToJson(e), Actual: mustToJson(a), Message: "value mismatch"})
+			}
+		}
+		return diffs
+	})
+}
+
+// RegexComparator requires the actual value at path to match pattern, the golden output is
+// ignored. An empty path matches the whole output.
+func RegexComparator(path, pattern string) WorkflowOutputComparator {
+	re, compileErr := regexp.Compile(pattern)
+	return WorkflowOutputComparatorFunc(func(expected, actual string) []*WorkflowOutputDiff {
+		if compileErr != nil {
+			return []*WorkflowOutputDiff{{Path: path, Expected: pattern, Message: compileErr.Error()}}
+		}
+		value := actual
+		if path != "" {
+			var actualValue any
+			if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+				return []*WorkflowOutputDiff{{Path: path, Expected: pattern, Actual: actual, Message: "actual output is not json"}}
+			}
+			v, ok := lookupJSONPath(actualValue, path)
+			if !ok {
+				return []*WorkflowOutputDiff{{Path: path, Expected: pattern, Message: "field missing"}}
+			}
+			if s, ok := v.(string); ok {
+				value = s
+			} else {
+				value = mustToJson(v)
+			}
+		}
+		if !re.MatchString(value) {
+			return []*WorkflowOutputDiff{{Path: path, Expected: pattern, Actual: value, Message: "pattern not matched"}}
+		}
+		return nil
+	})
+}
+
+// NumericToleranceComparator requires the numbers at path to differ by at most tolerance. An
+// empty path compares the whole output. Numbers encoded as strings are also accepted.
+func NumericToleranceComparator(path string, tolerance float64) WorkflowOutputComparator {
+	return WorkflowOutputComparatorFunc(func(expected, actual string) []*WorkflowOutputDiff {
+		expectedValue, actualValue, diff := decodeComparedJSON(expected, actual)
+		if diff != nil {
+			return []*WorkflowOutputDiff{diff}
+		}
+		e, eok := lookupJSONPath(expectedValue, path)
+		a, aok := lookupJSONPath(actualValue, path)
+		if !eok || !aok {
+			return []*WorkflowOutputDiff{{Path: path, Expected: mustToJson(e), Actual: mustToJson(a), Message: "field missing"}}
+		}
+		ef, eok := toFloat(e)
+		af, aok := toFloat(a)
+		if !eok || !aok {
+			return []*WorkflowOutputDiff{{Path: path, Expected: mustToJson(e), Actual: mustToJson(a), Message: "value is not a number"}}
+		}
+		if math.Abs(ef-af) > tolerance {
+			return []*WorkflowOutputDiff{{
+				Path:     path,
+				Expected: mustToJson(e),
+				Actual:   mustToJson(a),
+				Message:  fmt.Sprintf("difference exceeds tolerance %v", tolerance),
+			}}
+		}
+		return nil
+	})
+}
+
+func decodeComparedJSON(expected, actual string) (any, any, *WorkflowOutputDiff) {
+	var expectedValue, actualValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		return nil, nil, &WorkflowOutputDiff{Expected: expected, Actual: actual, Message: "golden output is not json"}
+	}
+	if err := json.Unmarshal([]byte(actual), &actualValue); err != nil {
+		return nil, nil, &WorkflowOutputDiff{Expected: expected, Actual: actual, Message: "actual output is not json"}
+	}
+	return expectedValue, actualValue, nil
+}
+
+func diffJSONSubset(path string, expected, actual any) []*WorkflowOutputDiff {
+	expectedMap, ok := expected.(map[string]any)
+	if !ok {
+		if reflect.DeepEqual(expected, actual) {
+			return nil
+		}
+		return []*WorkflowOutputDiff{{Path: path, Expected: mustToJson(expected), Actual: mustToJson(actual), Message: "value mismatch"}}
+	}
+	actualMap, ok := actual.(map[string]any)
+	if !ok {
+		return []*WorkflowOutputDiff{{Path: path, Expected: mustToJson(expected), Actual: mustToJson(actual), Message: "type mismatch"}}
+	}
+	keys := make([]string, 0, len(expectedMap))
+	for key := range expectedMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var diffs []*WorkflowOutputDiff
+	for _, key := range keys {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		actualField, ok := actualMap[key]
+		if !ok {
+			diffs = append(diffs, &WorkflowOutputDiff{Path: fieldPath, Expected: mustToJson(expectedMap[key]), Message: "field missing"})
+			continue
+		}
+		diffs = append(diffs, diffJSONSubset(fieldPath, expectedMap[key], actualField)...)
+	}
+	return diffs
+}
+
+// lookupJSONPath looks up a dot separated path in a decoded JSON value, numeric segments index
+// into arrays.
+func lookupJSONPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch value := v.(type) {
+		case map[string]any:
+			field, ok := value[segment]
+			if !ok {
+				return nil, false
+			}
+			v = field
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			v = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
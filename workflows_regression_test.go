@@ -0,0 +1,193 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowRegressionSuite(t *testing.T) {
+	as := assert.New(t)
+	outputs := map[string]string{
+		"a": `{"output":"{\"answer\":\"hello\",\"score\":0.9}"}`,
+		"b": `{"output":"{\"answer\":\"world\",\"score\":1}"}`,
+	}
+	client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+		body := &RunWorkflowsReq{}
+		as.Nil(json.NewDecoder(req.Body).Decode(body))
+		as.Equal("v2", body.WorkflowVersion)
+		return mockResponse(http.StatusOK, &runWorkflowsResp{
+			RunWorkflowsResp: &RunWorkflowsResp{
+				Data:     outputs[body.Parameters["case"].(string)],
+				DebugURL: "https://debug.example.com",
+			},
+		})
+	}))
+	suite := &WorkflowRegressionSuite{
+		WorkflowID:      "workflow1",
+		WorkflowVersion: "v2",
+		Cases: []*WorkflowRegressionCase{
+			{Name: "a", Parameters: map[string]any{"case": "a"}},
+			{Name: "b", Parameters: map[string]any{"case": "b"}},
+		},
+	}
+
+	golden, err := suite.Record(context.Background(), client)
+	as.Nil(err)
+	as.Equal(`{"answer":"hello","score":0.9}`, golden.Outputs["a"].Output)
+
+	path := filepath.Join(t.TempDir(), "golden.json")
+	as.Nil(golden.Save(path))
+	golden, err = LoadWorkflowGoldenSet(path)
+	as.Nil(err)
+
+	t.Run("check passed", func(t *testing.T) {
+		report, err := suite.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.True(report.Passed())
+		as.Empty(report.Warnings)
+	})
+
+	t.Run("golden case not in the suite", func(t *testing.T) {
+		partial := &WorkflowRegressionSuite{
+			WorkflowID:      "workflow1",
+			WorkflowVersion: "v2",
+			Cases:           []*WorkflowRegressionCase{{Name: "a", Parameters: map[string]any{"case": "a"}}},
+		}
+		report, err := partial.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.True(report.Passed())
+		as.Equal([]string{"golden case b is not in the suite"}, report.Warnings)
+	})
+
+	t.Run("string output", func(t *testing.T) {
+		outputs["c"] = `{"output":"hello"}`
+		defer delete(outputs, "c")
+		stringSuite := &WorkflowRegressionSuite{
+			WorkflowID:      "workflow1",
+			WorkflowVersion: "v2",
+			Cases:           []*WorkflowRegressionCase{{Name: "c", Parameters: map[string]any{"case": "c"}}},
+		}
+		recorded, err := stringSuite.Record(context.Background(), client)
+		as.Nil(err)
+		as.Equal("hello", recorded.Outputs["c"].Output)
+
+		handWritten := &WorkflowGoldenSet{WorkflowVersion: "v2", Outputs: map[string]*WorkflowGolden{"c": {Output: "hello"}}}
+		stringSuite.Comparators = []WorkflowOutputComparator{ExactComparator(), RegexComparator("", "^hello$")}
+		report, err := stringSuite.Check(context.Background(), client, handWritten)
+		as.Nil(err)
+		as.True(report.Passed(), report.Results[0].Diffs)
+		as.Equal("hello", report.Results[0].Output)
+	})
+
+	t.Run("duplicate case names", func(t *testing.T) {
+		duplicate := &WorkflowRegressionSuite{
+			WorkflowID:      "workflow1",
+			WorkflowVersion: "v2",
+			Cases: []*WorkflowRegressionCase{
+				{Name: "a", Parameters: map[string]any{"case": "a"}},
+				{Name: "a", Parameters: map[string]any{"case": "b"}},
+			},
+		}
+		_, err := duplicate.Record(context.Background(), client)
+		as.NotNil(err)
+		as.Contains(err.Error(), `duplicate case name "a"`)
+		_, err = duplicate.Check(context.Background(), client, golden)
+		as.NotNil(err)
+	})
+
+	t.Run("check with comparators", func(t *testing.T) {
+		outputs["a"] = `{"output":"{\"answer\":\"hello!\",\"score\":0.85,\"extra\":1}"}`
+		defer func() { outputs["a"] = `{"output":"{\"answer\":\"hello\",\"score\":0.9}"}` }()
+
+		replay := &WorkflowRegressionSuite{WorkflowID: "workflow1", WorkflowVersion: "v2"}
+		report, err := replay.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.False(report.Passed())
+		as.Equal("a", report.Results[0].Name)
+		as.False(report.Results[0].Passed)
+		as.True(report.Results[1].Passed)
+
+		replay.Comparators = []WorkflowOutputComparator{
+			RegexComparator("answer", "^(hello|world)"),
+			NumericToleranceComparator("score", 0.1),
+		}
+		report, err = replay.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.True(report.Passed())
+
+		replay.Comparators = []WorkflowOutputComparator{JSONSubsetComparator()}
+		report, err = replay.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.False(report.Passed())
+		as.Len(report.Results[0].Diffs, 2)
+
+		buf := &bytes.Buffer{}
+		as.Nil(report.WriteJUnit(buf))
+		suites := &junitTestSuites{}
+		as.Nil(xml.Unmarshal(buf.Bytes(), suites))
+		as.Equal(2, suites.Suites[0].Tests)
+		as.Equal(1, suites.Suites[0].Failures)
+		as.NotNil(suites.Suites[0].TestCases[0].Failure)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			as.Equal("/v1/workflow/stream_run", req.URL.Path)
+			return mockStreamResponse(`id:0
+event:Message
+data:{"content":"{\"answer\":\"hel","node_title":"End","node_seq_id":"0","node_is_finish":false}
+
+id:1
+event:Message
+data:{"content":"lo\",\"score\":0.9}","node_title":"End","node_seq_id":"1","node_is_finish":true}
+
+id:2
+event:Done
+data:{"debug_url":"https://www.coze.cn/work_flow?***"}
+`)
+		}))
+		streamSuite := &WorkflowRegressionSuite{
+			WorkflowID: "workflow1",
+			Stream:     true,
+			Cases:      []*WorkflowRegressionCase{{Name: "a"}},
+		}
+		report, err := streamSuite.Check(context.Background(), client, golden)
+		as.Nil(err)
+		as.True(report.Passed())
+		as.Equal("https://www.coze.cn/work_flow?***", report.Results[0].DebugURL)
+		// the golden set was recorded with v2
+		as.Equal([]string{
+			"golden set was recorded with workflow version v2, but version latest is checked",
+			"golden case b is not in the suite",
+		}, report.Warnings)
+
+		buf := &bytes.Buffer{}
+		as.Nil(report.WriteJUnit(buf))
+		suites := &junitTestSuites{}
+		as.Nil(xml.Unmarshal(buf.Bytes(), suites))
+		as.Contains(suites.Suites[0].SystemErr, "workflow version v2")
+	})
+}
+
+func TestWorkflowOutputComparators(t *testing.T) {
+	as := assert.New(t)
+	as.Empty(ExactComparator().Compare("a", "a"))
+	as.Len(ExactComparator().Compare("a", "b"), 1)
+
+	as.Empty(JSONSubsetComparator("items.0.id").Compare(`{"items":[{"id":1}]}`, `{"items":[{"id":1,"x":2}]}`))
+	as.Len(JSONSubsetComparator("items.0.id").Compare(`{"items":[{"id":1}]}`, `{"items":[]}`), 1)
+	as.Len(JSONSubsetComparator().Compare(`{"a":1}`, `not json`), 1)
+
+	as.Empty(RegexComparator("", `^\d+$`).Compare("", "123"))
+	as.Len(RegexComparator("", `(`).Compare("", "123"), 1)
+
+	as.Empty(NumericToleranceComparator("", 0.5).Compare(`1`, `"1.2"`))
+	as.Len(NumericToleranceComparator("v", 0.5).Compare(`{"v":1}`, `{"v":2}`), 1)
+}
@@ -0,0 +1,215 @@
+package coze
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// WorkflowStreamAggregator 按节点聚合 Runs.Stream 返回的消息
+//
+// 不同节点的消息分片会交错返回，聚合器按 node_title 归组，根据 node_is_finish 判断节点结束，
+// 并回调 IWorkflowStreamHandler。同一个节点结束后再次输出（例如循环中）会作为新的节点记录。
+type WorkflowStreamAggregator struct {
+	handler IWorkflowStreamHandler
+	active  map[string]*WorkflowNodeOutput
+	summary *WorkflowStreamSummary
+}
+
+// NewWorkflowStreamAggregator creates an aggregator, handler can be nil.
+func NewWorkflowStreamAggregator(handler IWorkflowStreamHandler) *WorkflowStreamAggregator {
+	if handler == nil {
+		handler = BaseWorkflowStreamHandler{}
+	}
+	return &WorkflowStreamAggregator{
+		handler: handler,
+		active:  map[string]*WorkflowNodeOutput{},
+		summary: &WorkflowStreamSummary{},
+	}
+}
+
+// AggregateWorkflowStream reads the stream until it is done and returns the summary. The stream
+// is not closed.
+func AggregateWorkflowStream(stream Stream[WorkflowEvent], handler IWorkflowStreamHandler) (*WorkflowStreamSummary, error) {
+	return NewWorkflowStreamAggregator(handler).Aggregate(stream)
+}
+
+// Aggregate reads the stream until it is done and returns the summary.
+func (a *WorkflowStreamAggregator) Aggregate(stream Stream[WorkflowEvent]) (*WorkflowStreamSummary, error) {
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return a.Summary(), err
+		}
+		if err := a.Add(event); err != nil {
+			return a.Summary(), err
+		}
+		if event.IsDone() {
+			break
+		}
+	}
+	return a.Summary(), nil
+}
+
+// Add handles a workflow event, the error returned by the handler is returned.
+func (a *WorkflowStreamAggregator) Add(event *WorkflowEvent) error {
+	if event == nil {
+		return nil
+	}
+	switch event.Event {
+	case WorkflowEventTypeMessage:
+		return a.addMessage(event.ID, event.Message)
+	case WorkflowEventTypeInterrupt:
+		a.summary.Interrupts = append(a.summary.Interrupts, event.Interrupt)
+		return a.handler.OnInterrupt(event.Interrupt)
+	case WorkflowEventTypeError:
+		a.summary.Errors = append(a.summary.Errors, event.Error)
+		return a.handler.OnError(event.Error)
+	case WorkflowEventTypeDone:
+		a.summary.IsDone = true
+		if event.DebugURL != nil {
+			a.summary.DebugURL = event.DebugURL.URL
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Summary returns the aggregated result so far.
+func (a *WorkflowStreamAggregator) Summary() *WorkflowStreamSummary {
+	return a.summary
+}
+
+func (a *WorkflowStreamAggregator) addMessage(id int, message *WorkflowEventMessage) error {
+	if message == nil {
+		return nil
+	}
+	node, ok := a.active[message.NodeTitle]
+	if !ok {
+		node = &WorkflowNodeOutput{
+			NodeTitle:    message.NodeTitle,
+			FirstEventID: id,
+			content:      &strings.Builder{},
+		}
+		a.active[message.NodeTitle] = node
+		a.summary.Nodes = append(a.summary.Nodes, node)
+		if err := a.handler.OnNodeStarted(node); err != nil {
+			return err
+		}
+	}
+
+	node.LastEventID = id
+	node.SeqIDs = append(node.SeqIDs, message.NodeSeqID)
+	node.content.WriteString(message.Content)
+	node.Content = node.content.String()
+	if message.Ext != nil {
+		node.Ext = message.Ext
+	}
+	node.Usage = addChatUsage(node.Usage, message.Usage)
+	a.summary.Usage = addChatUsage(a.summary.Usage, message.Usage)
+	if err := a.handler.OnNodeDelta(node, message); err != nil {
+		return err
+	}
+
+	if message.NodeIsFinish {
+		node.IsFinish = true
+		delete(a.active, message.NodeTitle)
+		return a.handler.OnNodeFinished(node)
+	}
+	return nil
+}
+
+// WorkflowNodeOutput is the assembled output of a node.
+type WorkflowNodeOutput struct {
+	// The name of the node, such as the message node or end node.
+	NodeTitle string
+
+	// The node_seq_id of the received messages, in order.
+	SeqIDs []string
+
+	// The content of all the received messages.
+	Content string
+
+	// Whether the last data packet of the node is received.
+	IsFinish bool
+
+	// The ext of the last message which has ext.
+	Ext map[string]any
+
+	// Token consumption reported by the messages of this node.
+	Usage *ChatUsage
+
+	// The event IDs of the first and the last message.
+	FirstEventID int
+	LastEventID  int
+
+	content *strings.Builder
+}
+
+// WorkflowStreamSummary is the result of a WorkflowStreamAggregator.
+type WorkflowStreamSummary struct {
+	// The nodes in the order they started.
+	Nodes []*WorkflowNodeOutput
+
+	// Token consumption accumulated across nodes.
+	Usage *ChatUsage
+
+	Interrupts []*WorkflowEventInterrupt
+	Errors     []*WorkflowEventError
+
+	// Whether the done event is received.
+	IsDone   bool
+	DebugURL string
+}
+
+// Node returns the last output of the node with the title, or nil.
+func (s *WorkflowStreamSummary) Node(nodeTitle string) *WorkflowNodeOutput {
+	for i := len(s.Nodes) - 1; i >= 0; i-- {
+		if s.Nodes[i].NodeTitle == nodeTitle {
+			return s.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Err returns the first error event as *Error, or nil.
+func (s *WorkflowStreamSummary) Err() error {
+	if len(s.Errors) == 0 {
+		return nil
+	}
+	return NewError(s.Errors[0].ErrorCode, s.Errors[0].ErrorMessage, "")
+}
+
+type IWorkflowStreamHandler interface {
+	OnNodeStarted(node *WorkflowNodeOutput) error
+	OnNodeDelta(node *WorkflowNodeOutput, message *WorkflowEventMessage) error
+	OnNodeFinished(node *WorkflowNodeOutput) error
+	OnInterrupt(interrupt *WorkflowEventInterrupt) error
+	OnError(err *WorkflowEventError) error
+}
+
+type BaseWorkflowStreamHandler struct{}
+
+func (BaseWorkflowStreamHandler) OnNodeStarted(node *WorkflowNodeOutput) error {
+	return nil
+}
+
+func (BaseWorkflowStreamHandler) OnNodeDelta(node *WorkflowNodeOutput, message *WorkflowEventMessage) error {
+	return nil
+}
+
+func (BaseWorkflowStreamHandler) OnNodeFinished(node *WorkflowNodeOutput) error {
+	return nil
+}
+
+func (BaseWorkflowStreamHandler) OnInterrupt(interrupt *WorkflowEventInterrupt) error {
+	return nil
+}
+
+func (BaseWorkflowStreamHandler) OnError(err *WorkflowEventError) error {
+	return nil
+}
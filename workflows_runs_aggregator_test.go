@@ -0,0 +1,113 @@
+package coze
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordWorkflowStreamHandler struct {
+	BaseWorkflowStreamHandler
+	calls []string
+}
+
+func (h *recordWorkflowStreamHandler) OnNodeStarted(node *WorkflowNodeOutput) error {
+	h.calls = append(h.calls, "started:"+node.NodeTitle)
+	return nil
+}
+
+func (h *recordWorkflowStreamHandler) OnNodeDelta(node *WorkflowNodeOutput, message *WorkflowEventMessage) error {
+	h.calls = append(h.calls, "delta:"+node.NodeTitle+":"+message.Content)
+	return nil
+}
+
+func (h *recordWorkflowStreamHandler) OnNodeFinished(node *WorkflowNodeOutput) error {
+	h.calls = append(h.calls, "finished:"+node.NodeTitle+":"+node.Content)
+	return nil
+}
+
+func TestWorkflowStreamAggregator(t *testing.T) {
+	as := assert.New(t)
+	workflowRuns := newWorkflowRun(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+		return mockStreamResponse(`id:0
+event:Message
+data:{"content":"Hel","node_title":"A","node_seq_id":"0","node_is_finish":false}
+
+id:1
+event:Message
+data:{"content":"Wor","node_title":"B","node_seq_id":"0","node_is_finish":false}
+
+id:2
+event:Message
+data:{"content":"lo","node_title":"A","node_seq_id":"1","node_is_finish":true,"usage":{"token_count":3,"input_count":1,"output_count":2}}
+
+id:3
+event:Message
+data:{"content":"ld","node_title":"B","node_seq_id":"1","node_is_finish":true,"usage":{"token_count":4,"input_count":2,"output_count":2}}
+
+id:4
+event:Interrupt
+data:{"interrupt_data":{"event_id":"e1","type":2},"node_title":"Question"}
+
+id:5
+event:Done
+data:{"debug_url":"https://www.coze.cn/work_flow?***"}
+`)
+	})))
+
+	t.Run("aggregate success", func(t *testing.T) {
+		stream, err := workflowRuns.Stream(context.Background(), &RunWorkflowsReq{WorkflowID: "workflow1"})
+		as.Nil(err)
+		defer stream.Close()
+
+		handler := &recordWorkflowStreamHandler{}
+		summary, err := AggregateWorkflowStream(stream, handler)
+		as.Nil(err)
+		as.Equal([]string{
+			"started:A", "delta:A:Hel",
+			"started:B", "delta:B:Wor",
+			"delta:A:lo", "finished:A:Hello",
+			"delta:B:ld", "finished:B:World",
+		}, handler.calls)
+		as.Len(summary.Nodes, 2)
+		as.Equal("Hello", summary.Node("A").Content)
+		as.Equal([]string{"0", "1"}, summary.Node("B").SeqIDs)
+		as.Equal(4, summary.Node("B").Usage.TokenCount)
+		as.Equal(7, summary.Usage.TokenCount)
+		as.Len(summary.Interrupts, 1)
+		as.Equal("e1", summary.Interrupts[0].InterruptData.EventID)
+		as.True(summary.IsDone)
+		as.Equal("https://www.coze.cn/work_flow?***", summary.DebugURL)
+		as.Nil(summary.Err())
+	})
+
+	t.Run("repeated node and error", func(t *testing.T) {
+		aggregator := NewWorkflowStreamAggregator(nil)
+		as.Nil(aggregator.Add(&WorkflowEvent{ID: 0, Event: WorkflowEventTypeMessage, Message: &WorkflowEventMessage{Content: "1", NodeTitle: "Loop", NodeIsFinish: true}}))
+		as.Nil(aggregator.Add(&WorkflowEvent{ID: 1, Event: WorkflowEventTypeMessage, Message: &WorkflowEventMessage{Content: "2", NodeTitle: "Loop", NodeIsFinish: true}}))
+		as.Nil(aggregator.Add(&WorkflowEvent{ID: 2, Event: WorkflowEventTypeError, Error: &WorkflowEventError{ErrorCode: 1, ErrorMessage: "failed"}}))
+		summary := aggregator.Summary()
+		as.Len(summary.Nodes, 2)
+		as.Equal("2", summary.Node("Loop").Content)
+		cozeErr, ok := AsCozeError(summary.Err())
+		as.True(ok)
+		as.Equal(1, cozeErr.Code)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		aggregator := NewWorkflowStreamAggregator(&failedWorkflowStreamHandler{})
+		err := aggregator.Add(&WorkflowEvent{Event: WorkflowEventTypeMessage, Message: &WorkflowEventMessage{NodeTitle: "A"}})
+		as.NotNil(err)
+	})
+}
+
+type failedWorkflowStreamHandler struct {
+	BaseWorkflowStreamHandler
+}
+
+func (failedWorkflowStreamHandler) OnNodeStarted(node *WorkflowNodeOutput) error {
+	return errors.New("stop")
+}
@@ -0,0 +1,500 @@
+package coze
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Trace 构建一次工作流执行的完整调用树
+//
+// 会递归拉取子工作流的执行历史，并发获取每个节点（包括子工作流节点）的输出，节点按结束时间排序。
+// 子工作流的执行历史使用 sub_execute_id 查询，workflow_id 依次取执行历史中返回的子工作流 ID、
+// SubWorkflowIDs 和父工作流的 workflow_id，最后一种只是尽力而为，查询失败时记录在节点的 Error 中。
+// 超过 MaxDepth 的子工作流节点标记为 Truncated。
+func (r *workflowRunsHistories) Trace(ctx context.Context, req *TraceWorkflowRunReq) (*WorkflowTrace, error) {
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	maxDepth := req.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 5
+	}
+	builder := &workflowTraceBuilder{
+		histories:      r,
+		sem:            make(chan struct{}, concurrency),
+		maxDepth:       maxDepth,
+		skipNodeOutput: req.SkipNodeOutput,
+		subWorkflowIDs: req.SubWorkflowIDs,
+	}
+	return builder.build(ctx, req.WorkflowID, req.ExecuteID, 0)
+}
+
+// TraceWorkflowRunReq represents request for tracing a workflow execution
+type TraceWorkflowRunReq struct {
+	// The ID of the workflow.
+	WorkflowID string
+
+	// The ID of the workflow execute.
+	ExecuteID string
+
+	// The maximum number of concurrent node output requests, default is 5.
+	Concurrency int
+
+	// The maximum depth of sub-workflow recursion, default is 5.
+	MaxDepth int
+
+	// Do not fetch the output of each node.
+	SkipNodeOutput bool
+
+	// The workflow IDs of the sub-workflow nodes keyed by node ID. The run history does not
+	// document the sub-workflow ID of a node, without it the sub-execution is queried with the
+	// workflow ID of the parent, which may not find it.
+	SubWorkflowIDs map[string]string
+}
+
+// WorkflowTrace is the execution tree of a workflow run.
+type WorkflowTrace struct {
+	WorkflowID string `json:"workflow_id"`
+	ExecuteID  string `json:"execute_id"`
+
+	// The run history returned by Runs.Histories.Retrieve.
+	History *WorkflowRunHistory `json:"history"`
+
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Duration  time.Duration `json:"duration"`
+
+	// The executed nodes, ordered by update time.
+	Nodes []*WorkflowTraceNode `json:"nodes"`
+}
+
+// WorkflowTraceNode is a node execution in a WorkflowTrace.
+//
+// The start and end time of a node are used when the API returns them. Otherwise the API only
+// reports when a node was last updated, and the start time is estimated as the end time of the node
+// which ended before it (or the start time of the run for the first node), which is wrong for nodes
+// of parallel branches.
+type WorkflowTraceNode struct {
+	// The key of the node in WorkflowRunHistory.NodeExecuteStatus.
+	Key             string `json:"key"`
+	NodeID          string `json:"node_id"`
+	NodeExecuteUUID string `json:"node_execute_uuid"`
+	IsFinish        bool   `json:"is_finish"`
+	LoopIndex       *int   `json:"loop_index,omitempty"`
+	BatchIndex      *int   `json:"batch_index,omitempty"`
+
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Duration  time.Duration `json:"duration"`
+	// Whether the start time is estimated from the end time of the previous node.
+	StartTimeEstimated bool `json:"start_time_estimated,omitempty"`
+
+	// The node output returned by ExecuteNodes.Retrieve.
+	Output string `json:"output,omitempty"`
+	// The error occurred when fetching the node output or the sub-workflow trace.
+	Error string `json:"error,omitempty"`
+
+	// The ID of the sub-workflow executed by this node.
+	SubWorkflowID string `json:"sub_workflow_id,omitempty"`
+	// The trace of the sub-workflow executed by this node.
+	SubTrace *WorkflowTrace `json:"sub_trace,omitempty"`
+	// Whether the sub-workflow was not traced because it is deeper than MaxDepth.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// WriteJSON writes the trace as indented JSON.
+func (t *WorkflowTrace) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// WriteChromeTrace writes the trace in the Chrome trace event format, which can be opened by
+// chrome://tracing or https://ui.perfetto.dev.
+func (t *WorkflowTrace) WriteChromeTrace(w io.Writer) error {
+	events := make([]*chromeTraceEvent, 0)
+	t.appendChromeTraceEvents(&events, 0)
+	return json.NewEncoder(w).Encode(map[string]any{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
+
+// WriteOTLP writes the trace as OTLP/JSON spans, which can be imported by OpenTelemetry
+// compatible backends.
+func (t *WorkflowTrace) WriteOTLP(w io.Writer) error {
+	traceID := traceHexID(t.ExecuteID, 16)
+	spans := make([]*otlpSpan, 0)
+	t.appendOTLPSpans(&spans, traceID, "")
+	return json.NewEncoder(w).Encode(map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": []*otlpAttribute{newOTLPAttribute("service.name", "coze-workflow")},
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "github.com/coze-dev/coze-go"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	})
+}
+
+type workflowTraceBuilder struct {
+	histories      *workflowRunsHistories
+	sem            chan struct{}
+	maxDepth       int
+	skipNodeOutput bool
+	subWorkflowIDs map[string]string
+
+	// guards the errors of the nodes, set by both the output and the sub-workflow goroutines
+	mu sync.Mutex
+}
+
+// traceRunHistoriesResp decodes the run history with the undocumented fields of the node statuses
+// which the trace uses when they are returned, they are kept out of WorkflowRunHistory.
+type traceRunHistoriesResp struct {
+	baseResponse
+	Data []*traceRunHistory `json:"data"`
+}
+
+type traceRunHistory struct {
+	*WorkflowRunHistory
+	NodeExecuteStatus map[string]*traceNodeExecuteStatus `json:"node_execute_status"`
+}
+
+type traceNodeExecuteStatus struct {
+	*WorkflowRunHistoryNodeExecuteStatus
+	SubWorkflowID string `json:"sub_workflow_id"`
+	StartTime     int    `json:"start_time"`
+	EndTime       int    `json:"end_time"`
+}
+
+func (b *workflowTraceBuilder) retrieve(ctx context.Context, workflowID, executeID string) (*traceRunHistory, error) {
+	response := new(traceRunHistoriesResp)
+	if err := b.histories.core.rawRequest(ctx, &RawRequestReq{
+		Method: http.MethodGet,
+		URL:    "/v1/workflows/:workflow_id/run_histories/:execute_id",
+		Body:   &RetrieveWorkflowsRunsHistoriesReq{WorkflowID: workflowID, ExecuteID: executeID},
+	}, response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 || response.Data[0].WorkflowRunHistory == nil {
+		return nil, errors.New("workflow run history not found")
+	}
+	history := response.Data[0]
+	history.WorkflowRunHistory.NodeExecuteStatus = map[string]*WorkflowRunHistoryNodeExecuteStatus{}
+	for key, status := range history.NodeExecuteStatus {
+		if status != nil && status.WorkflowRunHistoryNodeExecuteStatus != nil {
+			history.WorkflowRunHistory.NodeExecuteStatus[key] = status.WorkflowRunHistoryNodeExecuteStatus
+		}
+	}
+	return history, nil
+}
+
+// subWorkflowID returns the workflow ID of the sub-workflow executed by a node.
+func (b *workflowTraceBuilder) subWorkflowID(workflowID string, status *traceNodeExecuteStatus) string {
+	if status.SubWorkflowID != "" {
+		return status.SubWorkflowID
+	}
+	if id := b.subWorkflowIDs[status.NodeID]; id != "" {
+		return id
+	}
+	return workflowID
+}
+
+func (b *workflowTraceBuilder) setError(node *WorkflowTraceNode, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if node.Error != "" {
+		node.Error += "; "
+	}
+	node.Error += err.Error()
+}
+
+func (b *workflowTraceBuilder) build(ctx context.Context, workflowID, executeID string, depth int) (*WorkflowTrace, error) {
+	traced, err := b.retrieve(ctx, workflowID, executeID)
+	if err != nil {
+		return nil, err
+	}
+	history := traced.WorkflowRunHistory
+	trace := &WorkflowTrace{
+		WorkflowID: workflowID,
+		ExecuteID:  executeID,
+		History:    history,
+		StartTime:  unixToTime(history.CreateTime),
+		EndTime:    unixToTime(history.UpdateTime),
+	}
+
+	for key, status := range traced.NodeExecuteStatus {
+		if status == nil || status.WorkflowRunHistoryNodeExecuteStatus == nil {
+			continue
+		}
+		node := &WorkflowTraceNode{
+			Key:             key,
+			NodeID:          status.NodeID,
+			NodeExecuteUUID: status.NodeExecuteUUID,
+			IsFinish:        status.IsFinish,
+			LoopIndex:       status.LoopIndex,
+			BatchIndex:      status.BatchIndex,
+			StartTime:       unixToTime(status.StartTime),
+			EndTime:         unixToTime(status.EndTime),
+		}
+		if node.EndTime.IsZero() {
+			node.EndTime = unixToTime(status.UpdateTime)
+		}
+		trace.Nodes = append(trace.Nodes, node)
+	}
+	sort.SliceStable(trace.Nodes, func(i, j int) bool {
+		if !trace.Nodes[i].EndTime.Equal(trace.Nodes[j].EndTime) {
+			return trace.Nodes[i].EndTime.Before(trace.Nodes[j].EndTime)
+		}
+		return trace.Nodes[i].Key < trace.Nodes[j].Key
+	})
+	start := trace.StartTime
+	for _, node := range trace.Nodes {
+		if node.StartTime.IsZero() {
+			node.StartTimeEstimated = true
+			node.StartTime = start
+			if node.EndTime.Before(start) {
+				node.StartTime = node.EndTime
+			}
+		}
+		node.Duration = node.EndTime.Sub(node.StartTime)
+		start = node.EndTime
+		if trace.EndTime.Before(node.EndTime) {
+			trace.EndTime = node.EndTime
+		}
+	}
+	trace.Duration = trace.EndTime.Sub(trace.StartTime)
+
+	var wg sync.WaitGroup
+	for _, node := range trace.Nodes {
+		status := traced.NodeExecuteStatus[node.Key]
+		if status.SubExecuteID != nil && *status.SubExecuteID != "" {
+			node.SubWorkflowID = b.subWorkflowID(workflowID, status)
+			if depth+1 < b.maxDepth {
+				wg.Add(1)
+				go func(node *WorkflowTraceNode, subExecuteID string) {
+					defer wg.Done()
+					subTrace, err := b.build(ctx, node.SubWorkflowID, subExecuteID, depth+1)
+					if err != nil {
+						b.setError(node, err)
+						return
+					}
+					node.SubTrace = subTrace
+				}(node, *status.SubExecuteID)
+			} else {
+				node.Truncated = true
+			}
+		}
+		if b.skipNodeOutput || node.NodeExecuteUUID == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(node *WorkflowTraceNode) {
+			defer wg.Done()
+			b.sem <- struct{}{}
+			defer func() { <-b.sem }()
+			output, err := b.histories.ExecuteNodes.Retrieve(ctx, &RetrieveWorkflowsRunsHistoriesExecuteNodesReq{
+				WorkflowID:      workflowID,
+				ExecuteID:       executeID,
+				NodeExecuteUUID: node.NodeExecuteUUID,
+			})
+			if err != nil {
+				b.setError(node, err)
+				return
+			}
+			node.Output = output.NodeOutput
+		}(node)
+	}
+	wg.Wait()
+
+	return trace, nil
+}
+
+type chromeTraceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`
+	Dur  int64          `json:"dur"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+func (t *WorkflowTrace) appendChromeTraceEvents(events *[]*chromeTraceEvent, depth int) {
+	*events = append(*events, &chromeTraceEvent{
+		Name: "workflow " + t.WorkflowID,
+		Cat:  "workflow",
+		Ph:   "X",
+		Ts:   t.StartTime.UnixMicro(),
+		Dur:  t.Duration.Microseconds(),
+		Pid:  1,
+		Tid:  depth * 2,
+		Args: map[string]any{
+			"execute_id":     t.ExecuteID,
+			"execute_status": t.History.ExecuteStatus,
+			"debug_url":      t.History.DebugURL,
+		},
+	})
+	for _, node := range t.Nodes {
+		args := map[string]any{
+			"node_execute_uuid": node.NodeExecuteUUID,
+			"is_finish":         node.IsFinish,
+		}
+		if node.LoopIndex != nil {
+			args["loop_index"] = *node.LoopIndex
+		}
+		if node.BatchIndex != nil {
+			args["batch_index"] = *node.BatchIndex
+		}
+		if node.Output != "" {
+			args["output"] = node.Output
+		}
+		if node.Error != "" {
+			args["error"] = node.Error
+		}
+		if node.Truncated {
+			args["truncated"] = true
+		}
+		*events = append(*events, &chromeTraceEvent{
+			Name: node.NodeID,
+			Cat:  "node",
+			Ph:   "X",
+			Ts:   node.StartTime.UnixMicro(),
+			Dur:  node.Duration.Microseconds(),
+			Pid:  1,
+			Tid:  depth*2 + 1,
+			Args: args,
+		})
+		if node.SubTrace != nil {
+			node.SubTrace.appendChromeTraceEvents(events, depth+1)
+		}
+	}
+}
+
+type otlpSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus      `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+func newOTLPAttribute(key, value string) *otlpAttribute {
+	return &otlpAttribute{Key: key, Value: map[string]string{"stringValue": value}}
+}
+
+func (t *WorkflowTrace) appendOTLPSpans(spans *[]*otlpSpan, traceID, parentSpanID string) {
+	spanID := traceHexID(t.WorkflowID+"/"+t.ExecuteID, 8)
+	status := &otlpStatus{Code: otlpStatusCodeOK}
+	if t.History.ExecuteStatus == WorkflowExecuteStatusFail {
+		status = &otlpStatus{Code: otlpStatusCodeError, Message: t.History.ErrorMessage}
+	}
+	*spans = append(*spans, &otlpSpan{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		ParentSpanID:      parentSpanID,
+		Name:              "workflow " + t.WorkflowID,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(t.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(t.EndTime.UnixNano(), 10),
+		Attributes: []*otlpAttribute{
+			newOTLPAttribute("coze.workflow_id", t.WorkflowID),
+			newOTLPAttribute("coze.execute_id", t.ExecuteID),
+			newOTLPAttribute("coze.debug_url", t.History.DebugURL),
+		},
+		Status: status,
+	})
+	for _, node := range t.Nodes {
+		nodeSpanID := traceHexID(t.ExecuteID+"/"+node.Key+"/"+node.NodeExecuteUUID, 8)
+		attributes := []*otlpAttribute{
+			newOTLPAttribute("coze.node_id", node.NodeID),
+			newOTLPAttribute("coze.node_execute_uuid", node.NodeExecuteUUID),
+		}
+		if node.LoopIndex != nil {
+			attributes = append(attributes, newOTLPAttribute("coze.loop_index", strconv.Itoa(*node.LoopIndex)))
+		}
+		if node.BatchIndex != nil {
+			attributes = append(attributes, newOTLPAttribute("coze.batch_index", strconv.Itoa(*node.BatchIndex)))
+		}
+		if node.Output != "" {
+			attributes = append(attributes, newOTLPAttribute("coze.node_output", node.Output))
+		}
+		if node.Truncated {
+			attributes = append(attributes, newOTLPAttribute("coze.truncated", "true"))
+		}
+		nodeStatus := &otlpStatus{Code: otlpStatusCodeOK}
+		if node.Error != "" {
+			nodeStatus = &otlpStatus{Code: otlpStatusCodeError, Message: node.Error}
+		} else if !node.IsFinish && t.History.ExecuteStatus == WorkflowExecuteStatusFail {
+			nodeStatus = &otlpStatus{Code: otlpStatusCodeError, Message: t.History.ErrorMessage}
+		}
+		*spans = append(*spans, &otlpSpan{
+			TraceID:           traceID,
+			SpanID:            nodeSpanID,
+			ParentSpanID:      spanID,
+			Name:              node.NodeID,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(node.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(node.EndTime.UnixNano(), 10),
+			Attributes:        attributes,
+			Status:            nodeStatus,
+		})
+		if node.SubTrace != nil {
+			node.SubTrace.appendOTLPSpans(spans, traceID, nodeSpanID)
+		}
+	}
+}
+
+// traceHexID derives a stable hex id of size bytes from s.
+func traceHexID(s string, size int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:size])
+}
+
+// unixToTime converts a unix timestamp in seconds or milliseconds to time.Time.
+func unixToTime(v int) time.Time {
+	if v <= 0 {
+		return time.Time{}
+	}
+	if v > 1e12 {
+		return time.UnixMilli(int64(v))
+	}
+	return time.Unix(int64(v), 0)
+}
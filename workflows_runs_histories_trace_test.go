@@ -0,0 +1,164 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowRunsHistoriesTrace(t *testing.T) {
+	as := assert.New(t)
+	histories := newWorkflowRunsHistories(newCoreWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/v1/workflows/workflow1/run_histories/exec1":
+			// sub_workflow_id, start_time and end_time are used when they are returned
+			return mockResponse(http.StatusOK, map[string]any{
+				"code": 0,
+				"data": []any{map[string]any{
+					"execute_id":     "exec1",
+					"execute_status": WorkflowExecuteStatusSuccess,
+					"create_time":    1000,
+					"update_time":    1010,
+					"node_execute_status": map[string]any{
+						"end": map[string]any{"node_id": "end", "is_finish": true, "update_time": 1009, "start_time": 1007, "end_time": 1009, "node_execute_uuid": "uuid-end"},
+						"llm": map[string]any{"node_id": "llm", "is_finish": true, "update_time": 1003, "node_execute_uuid": "uuid-llm"},
+						"sub": map[string]any{"node_id": "sub", "is_finish": true, "update_time": 1006, "node_execute_uuid": "uuid-sub", "sub_execute_id": "exec2", "sub_workflow_id": "workflow2"},
+					},
+				}},
+			})
+		case "/v1/workflows/workflow1/run_histories/exec4":
+			return mockResponse(http.StatusOK, &retrieveWorkflowRunsHistoriesResp{
+				RetrieveWorkflowRunsHistoriesResp: &RetrieveWorkflowRunsHistoriesResp{
+					Histories: []*WorkflowRunHistory{{
+						ExecuteID:  "exec4",
+						CreateTime: 1000,
+						UpdateTime: 1010,
+						NodeExecuteStatus: map[string]*WorkflowRunHistoryNodeExecuteStatus{
+							"flow": {NodeID: "flow", IsFinish: true, UpdateTime: 1006, SubExecuteID: ptr("exec2")},
+						},
+					}},
+				},
+			})
+		case "/v1/workflows/workflow2/run_histories/exec2":
+			return mockResponse(http.StatusOK, &retrieveWorkflowRunsHistoriesResp{
+				RetrieveWorkflowRunsHistoriesResp: &RetrieveWorkflowRunsHistoriesResp{
+					Histories: []*WorkflowRunHistory{{
+						ExecuteID:     "exec2",
+						ExecuteStatus: WorkflowExecuteStatusSuccess,
+						CreateTime:    1003,
+						UpdateTime:    1006,
+						NodeExecuteStatus: map[string]*WorkflowRunHistoryNodeExecuteStatus{
+							"code": {NodeID: "code", IsFinish: true, UpdateTime: 1005, NodeExecuteUUID: "uuid-code", LoopIndex: ptr(0)},
+						},
+					}},
+				},
+			})
+		}
+		if strings.Contains(req.URL.Path, "/execute_nodes/") {
+			parts := strings.Split(req.URL.Path, "/")
+			return mockResponse(http.StatusOK, &retrieveWorkflowRunsHistoriesExecuteNodeResp{
+				Data: &RetrieveWorkflowRunsHistoriesExecuteNodesResp{
+					IsFinish:   true,
+					NodeOutput: "output of " + parts[len(parts)-1],
+				},
+			})
+		}
+		return mockResponse(http.StatusNotFound, &baseResponse{Code: 404, Msg: "not found"})
+	})))
+
+	trace, err := histories.Trace(context.Background(), &TraceWorkflowRunReq{
+		WorkflowID: "workflow1",
+		ExecuteID:  "exec1",
+	})
+	as.Nil(err)
+	as.Equal(10*time.Second, trace.Duration)
+	as.Len(trace.Nodes, 3)
+	as.Equal("llm", trace.Nodes[0].NodeID)
+	as.Equal(3*time.Second, trace.Nodes[0].Duration)
+	as.Equal("output of uuid-llm", trace.Nodes[0].Output)
+	as.Equal("sub", trace.Nodes[1].NodeID)
+	as.Equal("output of uuid-sub", trace.Nodes[1].Output)
+	as.Equal("workflow2", trace.Nodes[1].SubWorkflowID)
+	as.NotNil(trace.Nodes[1].SubTrace)
+	as.Equal("workflow2", trace.Nodes[1].SubTrace.WorkflowID)
+	as.False(trace.Nodes[1].Truncated)
+	as.Equal("output of uuid-code", trace.Nodes[1].SubTrace.Nodes[0].Output)
+	as.True(trace.Nodes[0].StartTimeEstimated)
+	// the end node reports its own start time
+	as.Equal(2*time.Second, trace.Nodes[2].Duration)
+	as.False(trace.Nodes[2].StartTimeEstimated)
+	as.Equal(WorkflowExecuteStatusSuccess, trace.History.ExecuteStatus)
+	as.Len(trace.History.NodeExecuteStatus, 3)
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		as.Nil(trace.WriteJSON(buf))
+		as.Contains(buf.String(), `"sub_trace"`)
+	})
+
+	t.Run("chrome trace", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		as.Nil(trace.WriteChromeTrace(buf))
+		result := struct {
+			TraceEvents []*chromeTraceEvent `json:"traceEvents"`
+		}{}
+		as.Nil(json.Unmarshal(buf.Bytes(), &result))
+		as.Len(result.TraceEvents, 6)
+		as.Equal(int64(3e6), result.TraceEvents[1].Dur)
+		as.Equal(int64(2e6), result.TraceEvents[5].Dur)
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		as.Nil(trace.WriteOTLP(buf))
+		as.Contains(buf.String(), `"parentSpanId"`)
+		as.Contains(buf.String(), `"coze.loop_index"`)
+	})
+
+	t.Run("skip node output", func(t *testing.T) {
+		trace, err := histories.Trace(context.Background(), &TraceWorkflowRunReq{
+			WorkflowID:     "workflow1",
+			ExecuteID:      "exec1",
+			SkipNodeOutput: true,
+			MaxDepth:       1,
+		})
+		as.Nil(err)
+		as.Empty(trace.Nodes[0].Output)
+		as.Nil(trace.Nodes[1].SubTrace)
+		as.True(trace.Nodes[1].Truncated)
+	})
+
+	t.Run("sub workflow ids", func(t *testing.T) {
+		// without the sub-workflow id the parent workflow is queried
+		trace, err := histories.Trace(context.Background(), &TraceWorkflowRunReq{
+			WorkflowID: "workflow1",
+			ExecuteID:  "exec4",
+		})
+		as.Nil(err)
+		as.Nil(trace.Nodes[0].SubTrace)
+		as.NotEmpty(trace.Nodes[0].Error)
+
+		trace, err = histories.Trace(context.Background(), &TraceWorkflowRunReq{
+			WorkflowID:     "workflow1",
+			ExecuteID:      "exec4",
+			SubWorkflowIDs: map[string]string{"flow": "workflow2"},
+		})
+		as.Nil(err)
+		as.Empty(trace.Nodes[0].Error)
+		as.Equal("exec2", trace.Nodes[0].SubTrace.ExecuteID)
+	})
+
+	t.Run("history not found", func(t *testing.T) {
+		_, err := histories.Trace(context.Background(), &TraceWorkflowRunReq{
+			WorkflowID: "workflow1",
+			ExecuteID:  "exec3",
+		})
+		as.NotNil(err)
+	})
+}
@@ -0,0 +1,343 @@
+package coze
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RunWorkflow 以类型化的入参执行工作流，并把执行结果解码为 Out
+//
+// in 会被序列化为工作流开始节点的 parameters，返回的 data 会自动去掉 output 包装和多重 JSON 编码。
+func RunWorkflow[In, Out any](ctx context.Context, client *CozeAPI, workflowID string, in In, opts ...RunWorkflowOption) (*WorkflowResult[Out], error) {
+	req, err := newTypedRunWorkflowsReq(workflowID, in, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Workflows.Runs.Create(ctx, req)
+	if err != nil {
+		return nil, newWorkflowRunErrorFromResp(workflowID, resp, err)
+	}
+
+	result := &WorkflowResult[Out]{
+		ExecuteID: resp.ExecuteID,
+		DebugURL:  resp.DebugURL,
+		Usage:     resp.Usage,
+		RawData:   resp.Data,
+		LogID:     resp.LogID(),
+	}
+	if req.IsAsync {
+		return result, nil
+	}
+	if err := DecodeWorkflowOutput(resp.Data, &result.Output); err != nil {
+		return nil, newWorkflowRunErrorFromResp(workflowID, resp, err)
+	}
+	return result, nil
+}
+
+// StreamWorkflow 以类型化的入参流式执行工作流，每个节点消息都会尝试解码为 Out
+func StreamWorkflow[In, Out any](ctx context.Context, client *CozeAPI, workflowID string, in In, opts ...RunWorkflowOption) (*WorkflowStream[Out], error) {
+	req, err := newTypedRunWorkflowsReq(workflowID, in, opts)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.Workflows.Runs.Stream(ctx, req)
+	if err != nil {
+		return nil, &WorkflowRunError{WorkflowID: workflowID, Err: err}
+	}
+	return &WorkflowStream[Out]{workflowID: workflowID, stream: stream}, nil
+}
+
+// RunWorkflowOption customizes the request sent by RunWorkflow and StreamWorkflow.
+type RunWorkflowOption func(*RunWorkflowsReq)
+
+// WithWorkflowBotID sets the associated bot ID.
+func WithWorkflowBotID(botID string) RunWorkflowOption {
+	return func(req *RunWorkflowsReq) {
+		req.BotID = botID
+	}
+}
+
+// WithWorkflowAppID sets the app ID the workflow belongs to.
+func WithWorkflowAppID(appID string) RunWorkflowOption {
+	return func(req *RunWorkflowsReq) {
+		req.AppID = appID
+	}
+}
+
+// WithWorkflowVersion pins the workflow version to run.
+func WithWorkflowVersion(version string) RunWorkflowOption {
+	return func(req *RunWorkflowsReq) {
+		req.WorkflowVersion = version
+	}
+}
+
+// WithWorkflowExt sets the additional ext fields.
+func WithWorkflowExt(ext map[string]string) RunWorkflowOption {
+	return func(req *RunWorkflowsReq) {
+		req.Ext = ext
+	}
+}
+
+// WithWorkflowAsync runs the workflow asynchronously, the result only contains the ExecuteID.
+func WithWorkflowAsync() RunWorkflowOption {
+	return func(req *RunWorkflowsReq) {
+		req.IsAsync = true
+	}
+}
+
+// WorkflowResult is the typed result of RunWorkflow.
+type WorkflowResult[Out any] struct {
+	// The decoded workflow output.
+	Output Out
+
+	// Execution ID, only returned for asynchronous execution.
+	ExecuteID string
+
+	// The raw data string returned by the workflow.
+	RawData string
+
+	// Workflow trial runs debugging page.
+	DebugURL string
+
+	// Detailed information about Token consumption.
+	Usage *ChatUsage
+
+	LogID string
+}
+
+// WorkflowRunError is returned by the typed workflow helpers, it carries the debug url and
+// usage of the run so that failures can be inspected.
+type WorkflowRunError struct {
+	WorkflowID string
+	ExecuteID  string
+	DebugURL   string
+	Usage      *ChatUsage
+	LogID      string
+	Err        error
+}
+
+// Error implements the error interface
+func (e *WorkflowRunError) Error() string {
+	return fmt.Sprintf("workflow %s run failed, debug_url=%s, logid=%s, err=%s", e.WorkflowID, e.DebugURL, e.LogID, e.Err)
+}
+
+// Unwrap returns the parent error
+func (e *WorkflowRunError) Unwrap() error {
+	return e.Err
+}
+
+// AsWorkflowRunError checks if the error is of type WorkflowRunError
+func AsWorkflowRunError(err error) (*WorkflowRunError, bool) {
+	var runErr *WorkflowRunError
+	if errors.As(err, &runErr) {
+		return runErr, true
+	}
+	return nil, false
+}
+
+// WorkflowStreamEvent is a workflow event with the message content decoded into Out.
+type WorkflowStreamEvent[Out any] struct {
+	*WorkflowEvent
+
+	// Output is the decoded message content. It is nil when the event is not a message or the
+	// content can not be decoded into Out, e.g. a partial chunk of a streaming node.
+	Output *Out
+}
+
+// WorkflowStream is a typed wrapper of Stream[WorkflowEvent].
+type WorkflowStream[Out any] struct {
+	workflowID string
+	stream     Stream[WorkflowEvent]
+	debugURL   string
+	usage      *ChatUsage
+}
+
+// Recv returns the next message or interrupt event. Ping and unknown events are skipped,
+// error events are returned as *WorkflowRunError, and io.EOF is returned after the done event.
+func (s *WorkflowStream[Out]) Recv() (*WorkflowStreamEvent[Out], error) {
+	for {
+		event, err := s.stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, s.newError(err)
+		}
+		switch event.Event {
+		case WorkflowEventTypeMessage:
+			s.usage = addChatUsage(s.usage, event.Message.Usage)
+			typed := &WorkflowStreamEvent[Out]{WorkflowEvent: event}
+			var out Out
+			if DecodeWorkflowOutput(event.Message.Content, &out) == nil {
+				typed.Output = &out
+			}
+			return typed, nil
+		case WorkflowEventTypeInterrupt:
+			return &WorkflowStreamEvent[Out]{WorkflowEvent: event}, nil
+		case WorkflowEventTypeError:
+			return nil, s.newError(NewError(event.Error.ErrorCode, event.Error.ErrorMessage, s.stream.Response().LogID()))
+		case WorkflowEventTypeDone:
+			if event.DebugURL != nil {
+				s.debugURL = event.DebugURL.URL
+			}
+			return nil, io.EOF
+		default:
+			continue
+		}
+	}
+}
+
+// DebugURL returns the debug url, it is available after the stream is done.
+func (s *WorkflowStream[Out]) DebugURL() string {
+	return s.debugURL
+}
+
+// Usage returns the token usage accumulated from the received messages.
+func (s *WorkflowStream[Out]) Usage() *ChatUsage {
+	return s.usage
+}
+
+// Close closes the underlying stream
+func (s *WorkflowStream[Out]) Close() error {
+	return s.stream.Close()
+}
+
+func (s *WorkflowStream[Out]) Response() HTTPResponse {
+	return s.stream.Response()
+}
+
+func (s *WorkflowStream[Out]) newError(err error) *WorkflowRunError {
+	return &WorkflowRunError{
+		WorkflowID: s.workflowID,
+		DebugURL:   s.debugURL,
+		Usage:      s.usage,
+		LogID:      s.stream.Response().LogID(),
+		Err:        err,
+	}
+}
+
+// DecodeWorkflowOutput decodes the data returned by a workflow into out.
+//
+// The data is unwrapped before decoding: a JSON string holding JSON is decoded again, and an
+// object whose only field is "output" is replaced by the value of that field. If out is a
+// *string and the unwrapped value is not a JSON string, the raw JSON text is stored.
+func DecodeWorkflowOutput(data string, out any) error {
+	raw := unwrapWorkflowOutput(json.RawMessage(data))
+	if err := json.Unmarshal(raw, out); err != nil {
+		if s, ok := out.(*string); ok {
+			*s = string(raw)
+			return nil
+		}
+		return fmt.Errorf("decode workflow output: %w", err)
+	}
+	return nil
+}
+
+func unwrapWorkflowOutput(raw json.RawMessage) json.RawMessage {
+	for {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			return json.RawMessage("null")
+		}
+		switch raw[0] {
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return raw
+			}
+			inner := bytes.TrimSpace([]byte(s))
+			if len(inner) == 0 || (inner[0] != '{' && inner[0] != '[' && inner[0] != '"') || !json.Valid(inner) {
+				return raw
+			}
+			raw = inner
+		case '{':
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &envelope); err != nil || len(envelope) != 1 {
+				return raw
+			}
+			output, ok := envelope["output"]
+			if !ok {
+				return raw
+			}
+			raw = output
+		default:
+			if !json.Valid(raw) {
+				// not json at all, treat it as a plain string
+				quoted, _ := json.Marshal(string(raw))
+				return quoted
+			}
+			return raw
+		}
+	}
+}
+
+func newTypedRunWorkflowsReq(workflowID string, in any, opts []RunWorkflowOption) (*RunWorkflowsReq, error) {
+	parameters, err := toWorkflowParameters(in)
+	if err != nil {
+		return nil, err
+	}
+	req := &RunWorkflowsReq{
+		WorkflowID: workflowID,
+		Parameters: parameters,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	return req, nil
+}
+
+func toWorkflowParameters(in any) (map[string]any, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if parameters, ok := in.(map[string]any); ok {
+		return parameters, nil
+	}
+	bs, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("marshal workflow parameters: %w", err)
+	}
+	if string(bs) == "null" {
+		return nil, nil
+	}
+	parameters := map[string]any{}
+	if err := json.Unmarshal(bs, &parameters); err != nil {
+		return nil, fmt.Errorf("workflow parameters must be a json object: %w", err)
+	}
+	return parameters, nil
+}
+
+func newWorkflowRunErrorFromResp(workflowID string, resp *RunWorkflowsResp, err error) *WorkflowRunError {
+	runErr := &WorkflowRunError{WorkflowID: workflowID, Err: err}
+	if resp != nil {
+		runErr.ExecuteID = resp.ExecuteID
+		runErr.DebugURL = resp.DebugURL
+		runErr.Usage = resp.Usage
+		if resp.httpResponse != nil {
+			runErr.LogID = resp.LogID()
+		}
+	}
+	if runErr.LogID == "" {
+		if cozeErr, ok := AsCozeError(err); ok {
+			runErr.LogID = cozeErr.LogID
+		}
+	}
+	return runErr
+}
+
+func addChatUsage(total, usage *ChatUsage) *ChatUsage {
+	if usage == nil {
+		return total
+	}
+	if total == nil {
+		total = &ChatUsage{}
+	}
+	total.TokenCount += usage.TokenCount
+	total.OutputCount += usage.OutputCount
+	total.InputCount += usage.InputCount
+	return total
+}
@@ -0,0 +1,182 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedWorkflowIn struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+type typedWorkflowOut struct {
+	Answer string `json:"answer"`
+	Score  int    `json:"score"`
+}
+
+func newCozeAPIWithTransport(transport http.RoundTripper) *CozeAPI {
+	client := NewCozeAPI(NewTokenAuth("token"), WithBaseURL(CnBaseURL), WithHttpClient(&http.Client{Transport: transport}))
+	return &client
+}
+
+func TestRunWorkflow(t *testing.T) {
+	as := assert.New(t)
+	t.Run("run with struct input and double encoded output", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			as.Equal("/v1/workflow/run", req.URL.Path)
+			body := &RunWorkflowsReq{}
+			as.Nil(json.NewDecoder(req.Body).Decode(body))
+			as.Equal("workflow1", body.WorkflowID)
+			as.Equal("v1", body.WorkflowVersion)
+			as.Equal("hi", body.Parameters["query"])
+			as.Equal(float64(3), body.Parameters["limit"])
+			return mockResponse(http.StatusOK, &runWorkflowsResp{
+				RunWorkflowsResp: &RunWorkflowsResp{
+					Data:     `{"output":"{\"answer\":\"ok\",\"score\":9}"}`,
+					DebugURL: "https://debug.example.com",
+					Usage:    &ChatUsage{TokenCount: 10},
+				},
+			})
+		}))
+		resp, err := RunWorkflow[typedWorkflowIn, typedWorkflowOut](context.Background(), client, "workflow1",
+			typedWorkflowIn{Query: "hi", Limit: 3}, WithWorkflowVersion("v1"))
+		as.Nil(err)
+		as.Equal("ok", resp.Output.Answer)
+		as.Equal(9, resp.Output.Score)
+		as.Equal("https://debug.example.com", resp.DebugURL)
+		as.Equal(10, resp.Usage.TokenCount)
+		as.Equal("test_log_id", resp.LogID)
+	})
+
+	t.Run("decode error carries debug url", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockResponse(http.StatusOK, &runWorkflowsResp{
+				RunWorkflowsResp: &RunWorkflowsResp{
+					Data:     `{"output":[1,2]}`,
+					DebugURL: "https://debug.example.com",
+				},
+			})
+		}))
+		_, err := RunWorkflow[map[string]any, typedWorkflowOut](context.Background(), client, "workflow1", nil)
+		as.NotNil(err)
+		runErr, ok := AsWorkflowRunError(err)
+		as.True(ok)
+		as.Equal("https://debug.example.com", runErr.DebugURL)
+		as.Equal("workflow1", runErr.WorkflowID)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockResponse(http.StatusOK, &runWorkflowsResp{
+				baseResponse: baseResponse{Code: 4000, Msg: "invalid"},
+				RunWorkflowsResp: &RunWorkflowsResp{
+					DebugURL: "https://debug.example.com",
+				},
+			})
+		}))
+		_, err := RunWorkflow[typedWorkflowIn, string](context.Background(), client, "workflow1", typedWorkflowIn{})
+		runErr, ok := AsWorkflowRunError(err)
+		as.True(ok)
+		as.Equal("https://debug.example.com", runErr.DebugURL)
+		cozeErr, ok := AsCozeError(err)
+		as.True(ok)
+		as.Equal(4000, cozeErr.Code)
+	})
+
+	t.Run("input must be an object", func(t *testing.T) {
+		_, err := RunWorkflow[[]int, string](context.Background(), newCozeAPIWithTransport(nil), "workflow1", []int{1})
+		as.NotNil(err)
+	})
+}
+
+func TestStreamWorkflow(t *testing.T) {
+	as := assert.New(t)
+	t.Run("stream success", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockStreamResponse(`id:0
+event:Message
+data:{"content":"{\"answer\":\"a\",\"score\":1}","node_title":"End","node_seq_id":"0","node_is_finish":true,"usage":{"token_count":5}}
+
+id:1
+event:PING
+data:{}
+
+id:2
+event:Done
+data:{"debug_url":"https://www.coze.cn/work_flow?***"}
+`)
+		}))
+		stream, err := StreamWorkflow[typedWorkflowIn, typedWorkflowOut](context.Background(), client, "workflow1", typedWorkflowIn{})
+		as.Nil(err)
+		defer stream.Close()
+
+		event, err := stream.Recv()
+		as.Nil(err)
+		as.Equal(WorkflowEventTypeMessage, event.Event)
+		as.NotNil(event.Output)
+		as.Equal("a", event.Output.Answer)
+
+		_, err = stream.Recv()
+		as.Equal(io.EOF, err)
+		as.Equal("https://www.coze.cn/work_flow?***", stream.DebugURL())
+		as.Equal(5, stream.Usage().TokenCount)
+	})
+
+	t.Run("stream error event", func(t *testing.T) {
+		client := newCozeAPIWithTransport(newMockTransport(func(req *http.Request) (*http.Response, error) {
+			return mockStreamResponse(`id:0
+event:Message
+data:{"content":"partial","node_title":"End","node_seq_id":"0","node_is_finish":false,"usage":{"token_count":3}}
+
+id:1
+event:Error
+data:{"error_code":4000,"error_message":"failed"}
+`)
+		}))
+		stream, err := StreamWorkflow[typedWorkflowIn, typedWorkflowOut](context.Background(), client, "workflow1", typedWorkflowIn{})
+		as.Nil(err)
+		defer stream.Close()
+
+		event, err := stream.Recv()
+		as.Nil(err)
+		as.Nil(event.Output)
+
+		_, err = stream.Recv()
+		runErr, ok := AsWorkflowRunError(err)
+		as.True(ok)
+		as.Equal(3, runErr.Usage.TokenCount)
+		cozeErr, ok := AsCozeError(err)
+		as.True(ok)
+		as.Equal(4000, cozeErr.Code)
+	})
+}
+
+func TestDecodeWorkflowOutput(t *testing.T) {
+	as := assert.New(t)
+
+	var s string
+	as.Nil(DecodeWorkflowOutput(`{"output":"hello"}`, &s))
+	as.Equal("hello", s)
+
+	as.Nil(DecodeWorkflowOutput(`plain text`, &s))
+	as.Equal("plain text", s)
+
+	as.Nil(DecodeWorkflowOutput(`{"a":1,"b":2}`, &s))
+	as.Equal(`{"a":1,"b":2}`, s)
+
+	var out typedWorkflowOut
+	as.Nil(DecodeWorkflowOutput(`"{\"output\":{\"answer\":\"x\"}}"`, &out))
+	as.Equal("x", out.Answer)
+
+	var m map[string]int
+	as.Nil(DecodeWorkflowOutput(`{"a":1,"b":2}`, &m))
+	as.Equal(2, m["b"])
+
+	as.NotNil(DecodeWorkflowOutput(`[1]`, &out))
+}